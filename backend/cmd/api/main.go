@@ -1,18 +1,28 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/auth"
 	"github.com/mochammadshenna/4me-backend/internal/config"
 	"github.com/mochammadshenna/4me-backend/internal/database"
 	"github.com/mochammadshenna/4me-backend/internal/handlers"
+	"github.com/mochammadshenna/4me-backend/internal/jwks"
+	"github.com/mochammadshenna/4me-backend/internal/mailer"
 	"github.com/mochammadshenna/4me-backend/internal/middleware"
+	"github.com/mochammadshenna/4me-backend/internal/oauth"
+	"github.com/mochammadshenna/4me-backend/internal/ratelimit"
+	"github.com/mochammadshenna/4me-backend/internal/recurrence"
 )
 
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Connect to database
 	db, err := database.NewDatabase(cfg.DatabaseURL)
@@ -26,80 +36,237 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Load the keys that sign access tokens
+	keys, err := jwks.NewFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	// Initialize mailer
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure mailer: %v", err)
+	}
+
+	// Initialize sign-in providers
+	providers, err := oauth.NewRegistryFromConfig(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure sign-in providers: %v", err)
+	}
+
+	// Initialize rate limiting
+	limitStore, err := ratelimit.NewStore(cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to configure rate limiting: %v", err)
+	}
+	limiter := ratelimit.NewFromConfig(cfg, limitStore)
+	apiLimiter := ratelimit.NewAPIFromConfig(cfg, limitStore)
+
+	// Create the next instances of recurring tasks in the background
+	scheduler := recurrence.NewScheduler(db, cfg.RecurrenceInterval, cfg.MaxTasksPerBoard)
+	go scheduler.Run(context.Background())
+
 	// Initialize Gin router
 	router := gin.Default()
 
 	// Middleware
-	router.Use(middleware.CORSMiddleware(cfg.FrontendURL))
+	cors, err := middleware.CORSMiddleware(cfg.CORSAllowedOrigins, cfg.CORSMaxAge, "/.well-known/jwks.json", "/health")
+	if err != nil {
+		log.Fatalf("Invalid CORS_ALLOWED_ORIGINS: %v", err)
+	}
+	router.Use(cors)
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, cfg)
-	projectHandler := handlers.NewProjectHandler(db)
+	sessions := auth.NewSessions(db)
+	tokens := auth.NewAccessTokens(db)
+	authHandler := handlers.NewAuthHandler(db, cfg, providers, sessions, mail, limiter, keys)
+	sessionHandler := handlers.NewSessionHandler(sessions, cfg)
+	jwksHandler := handlers.NewJWKSHandler(keys)
+	tokenHandler := handlers.NewAccessTokenHandler(db, tokens)
+	projectHandler := handlers.NewProjectHandler(db, cfg)
+	memberHandler := handlers.NewMemberHandler(db)
+	invitationHandler := handlers.NewInvitationHandler(db, cfg, mail)
 	boardHandler := handlers.NewBoardHandler(db)
-	taskHandler := handlers.NewTaskHandler(db)
+	taskHandler := handlers.NewTaskHandler(db, cfg)
 	labelHandler := handlers.NewLabelHandler(db)
+	customFieldHandler := handlers.NewCustomFieldHandler(db)
+	statusHandler := handlers.NewStatusHandler(db)
+	priorityHandler := handlers.NewPriorityHandler(db)
+	timeEntryHandler := handlers.NewTimeEntryHandler(db)
+	estimateHandler := handlers.NewEstimateHandler(db)
+	checklistHandler := handlers.NewChecklistHandler(db)
+	dependencyHandler := handlers.NewDependencyHandler(db)
 	commentHandler := handlers.NewCommentHandler(db)
 	attachmentHandler := handlers.NewAttachmentHandler(db, cfg)
 
-	// Public routes
-	api := router.Group("/api")
+	// Public routes; in the cookie auth mode mutating requests need a CSRF
+	// token
+	api := router.Group("/api", apiLimiter.ByIP())
+	if cfg.CookieMode() {
+		api.Use(middleware.CSRFMiddleware())
+	}
+
 	{
 		// Auth routes
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
+			// Credential checks are throttled per client IP
+			limited := auth.Group("", limiter.ByIP())
+			limited.POST("/register", authHandler.Register)
+			limited.POST("/login", authHandler.Login)
+			limited.POST("/refresh", authHandler.Refresh)
+			limited.POST("/exchange", authHandler.Exchange)
+			limited.POST("/password/forgot", authHandler.ForgotPassword)
+			limited.POST("/password/reset", authHandler.ResetPassword)
+			limited.POST("/email/verify", authHandler.VerifyEmail)
+			limited.POST("/2fa/verify", middleware.MFAPendingMiddleware(cfg.JWTSecret), authHandler.VerifyTwoFactor)
+
+			auth.GET("/csrf", authHandler.CSRF)
+			auth.GET("/providers", authHandler.Providers)
+			auth.GET("/oauth/:provider", authHandler.OAuthLogin)
+			auth.GET("/oauth/:provider/callback", authHandler.OAuthCallback)
+			auth.GET("/oauth/:provider/link", authHandler.OAuthLink)
 			auth.GET("/google", authHandler.GoogleLogin)
 			auth.GET("/google/callback", authHandler.GoogleCallback)
 		}
 	}
 
-	// Protected routes
+	// Protected routes; personal access tokens are limited to the route
+	// groups their scopes allow
 	protected := api.Group("")
-	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	protected.Use(middleware.AuthMiddleware(cfg, keys, sessions, tokens), apiLimiter.ByUser())
 	{
-		// User routes
 		protected.GET("/auth/me", authHandler.Me)
+	}
 
-		// Project routes
-		protected.POST("/projects", projectHandler.Create)
-		protected.GET("/projects", projectHandler.List)
-		protected.GET("/projects/:id", projectHandler.Get)
-		protected.PUT("/projects/:id", projectHandler.Update)
-		protected.DELETE("/projects/:id", projectHandler.Delete)
-
-		// Board routes (under projects)
-		protected.POST("/projects/:id/boards", boardHandler.Create)
-		protected.GET("/projects/:id/boards", boardHandler.List)
-		protected.PUT("/boards/:id", boardHandler.Update)
-		protected.DELETE("/boards/:id", boardHandler.Delete)
-
-		// Task routes
-		protected.POST("/boards/:id/tasks", taskHandler.Create)
-		protected.GET("/tasks/:id", taskHandler.Get)
-		protected.PUT("/tasks/:id", taskHandler.Update)
-		protected.PATCH("/tasks/:id/move", taskHandler.Move)
-		protected.DELETE("/tasks/:id", taskHandler.Delete)
-		protected.GET("/tasks/:id/history", taskHandler.GetHistory)
-
-		// Label routes
-		protected.POST("/projects/:id/labels", labelHandler.Create)
-		protected.GET("/projects/:id/labels", labelHandler.List)
-		protected.PUT("/labels/:id", labelHandler.Update)
-		protected.DELETE("/labels/:id", labelHandler.Delete)
-
-		// Comment routes
-		protected.POST("/tasks/:id/comments", commentHandler.Create)
-		protected.GET("/tasks/:id/comments", commentHandler.List)
-		protected.PUT("/comments/:id", commentHandler.Update)
-		protected.DELETE("/comments/:id", commentHandler.Delete)
-
-		// Attachment routes
-		protected.POST("/tasks/:id/attachments", attachmentHandler.Upload)
-		protected.GET("/tasks/:id/attachments", attachmentHandler.List)
-		protected.DELETE("/attachments/:id", attachmentHandler.Delete)
+	// Account routes, which need an interactive login
+	account := protected.Group("", middleware.RequireSession())
+	{
+		account.PUT("/auth/password", authHandler.ChangePassword)
+		account.PUT("/auth/email", authHandler.ChangeEmail)
+		account.POST("/auth/email/verification", authHandler.ResendVerification)
+		account.GET("/auth/2fa", authHandler.TwoFactorStatus)
+		account.POST("/auth/2fa/setup", authHandler.SetupTwoFactor)
+		account.POST("/auth/2fa/enable", authHandler.EnableTwoFactor)
+		account.POST("/auth/2fa/disable", authHandler.DisableTwoFactor)
+		account.POST("/auth/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+		account.POST("/auth/logout", sessionHandler.Logout)
+		account.GET("/auth/sessions", sessionHandler.List)
+		account.DELETE("/auth/sessions", sessionHandler.LogoutAll)
+		account.DELETE("/auth/sessions/:id", sessionHandler.Revoke)
+		account.GET("/auth/identities", authHandler.ListIdentities)
+		account.POST("/auth/link/confirm", authHandler.ConfirmLink)
+		account.POST("/auth/identities/:provider", authHandler.LinkIdentity)
+		account.DELETE("/auth/identities/:provider", authHandler.UnlinkIdentity)
+		account.POST("/auth/tokens", tokenHandler.Create)
+		account.GET("/auth/tokens", tokenHandler.List)
+		account.DELETE("/auth/tokens/:id", tokenHandler.Revoke)
+
+		// Responding to invitations
+		account.POST("/invitations/accept", invitationHandler.AcceptToken)
+		account.POST("/invitations/:id/accept", invitationHandler.Accept)
+		account.POST("/invitations/:id/decline", invitationHandler.Decline)
+	}
+
+	// Reading projects with their boards, members, labels and task settings
+	// (custom fields, workflow and priorities)
+	projectsRead := protected.Group("", middleware.RequireScope(auth.ScopeProjectsRead))
+	{
+		projectsRead.GET("/projects", projectHandler.List)
+		projectsRead.GET("/projects/:id", projectHandler.Get)
+		projectsRead.GET("/projects/:id/members", memberHandler.List)
+		projectsRead.GET("/projects/:id/boards", boardHandler.List)
+		projectsRead.GET("/projects/:id/labels", labelHandler.List)
+		projectsRead.GET("/projects/:id/custom-fields", customFieldHandler.List)
+		projectsRead.GET("/projects/:id/workflow", statusHandler.Workflow)
+		projectsRead.GET("/projects/:id/priorities", priorityHandler.List)
 	}
 
+	// Creating and editing projects with their boards, labels and task settings
+	projectsWrite := protected.Group("", middleware.RequireScope(auth.ScopeProjectsWrite))
+	{
+		projectsWrite.POST("/projects", projectHandler.Create)
+		projectsWrite.PUT("/projects/:id", projectHandler.Update)
+		projectsWrite.POST("/projects/:id/boards", boardHandler.Create)
+		projectsWrite.PUT("/boards/:id", boardHandler.Update)
+		projectsWrite.DELETE("/boards/:id", boardHandler.Delete)
+		projectsWrite.POST("/projects/:id/labels", labelHandler.Create)
+		projectsWrite.PUT("/labels/:id", labelHandler.Update)
+		projectsWrite.DELETE("/labels/:id", labelHandler.Delete)
+		projectsWrite.POST("/projects/:id/custom-fields", customFieldHandler.Create)
+		projectsWrite.PUT("/custom-fields/:id", customFieldHandler.Update)
+		projectsWrite.DELETE("/custom-fields/:id", customFieldHandler.Delete)
+		projectsWrite.POST("/projects/:id/statuses", statusHandler.Create)
+		projectsWrite.PUT("/statuses/:id", statusHandler.Update)
+		projectsWrite.DELETE("/statuses/:id", statusHandler.Delete)
+		projectsWrite.PUT("/projects/:id/transitions", statusHandler.UpdateTransitions)
+		projectsWrite.POST("/projects/:id/priorities", priorityHandler.Create)
+		projectsWrite.PUT("/priorities/:id", priorityHandler.Update)
+		projectsWrite.DELETE("/priorities/:id", priorityHandler.Delete)
+	}
+
+	// Deleting projects and managing members and invitations
+	projectsAdmin := protected.Group("", middleware.RequireScope(auth.ScopeProjectsAdmin))
+	{
+		projectsAdmin.DELETE("/projects/:id", projectHandler.Delete)
+		projectsAdmin.POST("/projects/:id/members", memberHandler.Add)
+		projectsAdmin.PUT("/projects/:id/members/:userId", memberHandler.Update)
+		projectsAdmin.DELETE("/projects/:id/members/:userId", memberHandler.Remove)
+		projectsAdmin.POST("/projects/:id/invitations", invitationHandler.Create)
+		projectsAdmin.GET("/projects/:id/invitations", invitationHandler.List)
+		projectsAdmin.DELETE("/invitations/:id", invitationHandler.Revoke)
+	}
+
+	// Reading tasks, comments, attachments and logged time
+	tasksRead := protected.Group("", middleware.RequireScope(auth.ScopeTasksRead))
+	{
+		tasksRead.GET("/projects/:id/tasks", taskHandler.ListByProject)
+		tasksRead.GET("/boards/:id/tasks", taskHandler.List)
+		tasksRead.GET("/tasks", taskHandler.ListAll)
+		tasksRead.GET("/tasks/:id", taskHandler.Get)
+		tasksRead.GET("/tasks/:id/history", taskHandler.GetHistory)
+		tasksRead.GET("/tasks/:id/subtasks", taskHandler.ListSubtasks)
+		tasksRead.GET("/tasks/:id/checklist", checklistHandler.List)
+		tasksRead.GET("/tasks/:id/dependencies", dependencyHandler.List)
+		tasksRead.GET("/projects/:id/dependencies", dependencyHandler.Graph)
+		tasksRead.GET("/projects/:id/estimates", estimateHandler.Rollup)
+		tasksRead.GET("/tasks/:id/comments", commentHandler.List)
+		tasksRead.GET("/tasks/:id/attachments", attachmentHandler.List)
+		tasksRead.GET("/tasks/:id/time-entries", timeEntryHandler.List)
+		tasksRead.GET("/timer", timeEntryHandler.RunningTimer)
+		tasksRead.GET("/timesheet", timeEntryHandler.Timesheet)
+	}
+
+	// Changing tasks, comments, attachments and logged time
+	tasksWrite := protected.Group("", middleware.RequireScope(auth.ScopeTasksWrite))
+	{
+		tasksWrite.POST("/boards/:id/tasks", taskHandler.Create)
+		tasksWrite.PUT("/tasks/:id", taskHandler.Update)
+		tasksWrite.PATCH("/tasks/:id/move", taskHandler.Move)
+		tasksWrite.DELETE("/tasks/:id", taskHandler.Delete)
+		tasksWrite.POST("/tasks/:id/subtasks", taskHandler.CreateSubtask)
+		tasksWrite.PUT("/tasks/:id/subtasks/order", taskHandler.ReorderSubtasks)
+		tasksWrite.POST("/tasks/:id/checklist", checklistHandler.Create)
+		tasksWrite.PUT("/tasks/:id/checklist/order", checklistHandler.Reorder)
+		tasksWrite.PUT("/checklist-items/:id", checklistHandler.Update)
+		tasksWrite.DELETE("/checklist-items/:id", checklistHandler.Delete)
+		tasksWrite.POST("/tasks/:id/dependencies", dependencyHandler.Create)
+		tasksWrite.DELETE("/dependencies/:id", dependencyHandler.Delete)
+		tasksWrite.POST("/tasks/:id/comments", commentHandler.Create)
+		tasksWrite.PUT("/comments/:id", commentHandler.Update)
+		tasksWrite.DELETE("/comments/:id", commentHandler.Delete)
+		tasksWrite.POST("/tasks/:id/attachments", attachmentHandler.Upload)
+		tasksWrite.DELETE("/attachments/:id", attachmentHandler.Delete)
+		tasksWrite.POST("/tasks/:id/time-entries", timeEntryHandler.Create)
+		tasksWrite.PUT("/time-entries/:id", timeEntryHandler.Update)
+		tasksWrite.DELETE("/time-entries/:id", timeEntryHandler.Delete)
+		tasksWrite.POST("/tasks/:id/timer/start", timeEntryHandler.StartTimer)
+		tasksWrite.POST("/tasks/:id/timer/stop", timeEntryHandler.StopTimer)
+	}
+
+	// Public keys for verifying access tokens
+	router.GET("/.well-known/jwks.json", jwksHandler.Get)
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
@@ -111,4 +278,3 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
-
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mochammadshenna/4me-backend/internal/config"
+	"github.com/mochammadshenna/4me-backend/internal/utils"
+)
+
+// Cookies and header of the cookie auth mode. The token cookies are
+// HttpOnly; the CSRF cookie is readable by the frontend, which echoes it in
+// the CSRF header of every mutating request.
+const (
+	AccessCookie  = "4me_access"
+	RefreshCookie = "4me_refresh"
+	CSRFCookie    = "4me_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+// refreshCookiePath limits the refresh token cookie to the refresh
+// endpoint.
+const refreshCookiePath = "/api/auth/refresh"
+
+// Cookies sets and clears the auth cookies.
+type Cookies struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+func NewCookies(cfg *config.Config) Cookies {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(cfg.CookieSameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return Cookies{
+		Domain:   cfg.CookieDomain,
+		Secure:   cfg.CookieSecure,
+		SameSite: sameSite,
+	}
+}
+
+// SetTokens sets the cookies of a new token pair with a new CSRF token,
+// which it returns.
+func (c Cookies) SetTokens(w http.ResponseWriter, token, refreshToken string) (string, error) {
+	c.set(w, AccessCookie, token, "/", int(utils.AccessTokenTTL.Seconds()), true)
+	c.set(w, RefreshCookie, refreshToken, refreshCookiePath, int(utils.RefreshTokenTTL.Seconds()), true)
+	return c.SetCSRF(w)
+}
+
+// SetCSRF sets a new CSRF token cookie and returns the token.
+func (c Cookies) SetCSRF(w http.ResponseWriter) (string, error) {
+	csrf, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	c.set(w, CSRFCookie, csrf, "/", int(utils.RefreshTokenTTL.Seconds()), false)
+	return csrf, nil
+}
+
+// Clear removes the auth cookies.
+func (c Cookies) Clear(w http.ResponseWriter) {
+	c.set(w, AccessCookie, "", "/", -1, true)
+	c.set(w, RefreshCookie, "", refreshCookiePath, -1, true)
+	c.set(w, CSRFCookie, "", "/", -1, false)
+}
+
+func (c Cookies) set(w http.ResponseWriter, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.Domain,
+		MaxAge:   maxAge,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	})
+}
@@ -0,0 +1,53 @@
+package auth
+
+import "strings"
+
+// Browsers are matched in order because most user agents mention several
+// engines, e.g. Edge also claims to be Chrome and Safari.
+var browsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"CriOS/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"PostmanRuntime/", "Postman"},
+}
+
+var systems = []struct{ token, name string }{
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// DeviceName returns a short label such as "Firefox on Windows" for a user
+// agent, falling back to "Unknown device".
+func DeviceName(userAgent string) string {
+	browser := match(userAgent, browsers)
+	system := match(userAgent, systems)
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
+
+func match(userAgent string, candidates []struct{ token, name string }) string {
+	for _, c := range candidates {
+		if strings.Contains(userAgent, c.token) {
+			return c.name
+		}
+	}
+	return ""
+}
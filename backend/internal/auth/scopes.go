@@ -0,0 +1,42 @@
+package auth
+
+// Scopes of personal access tokens. Sessions from an interactive login are
+// not limited by scopes.
+const (
+	ScopeProjectsRead  = "projects:read"
+	ScopeProjectsWrite = "projects:write"
+	ScopeProjectsAdmin = "projects:admin"
+	ScopeTasksRead     = "tasks:read"
+	ScopeTasksWrite    = "tasks:write"
+)
+
+// impliedScopes lists the scopes each scope includes besides itself.
+var impliedScopes = map[string][]string{
+	ScopeProjectsRead:  nil,
+	ScopeProjectsWrite: {ScopeProjectsRead},
+	ScopeProjectsAdmin: {ScopeProjectsWrite, ScopeProjectsRead},
+	ScopeTasksRead:     nil,
+	ScopeTasksWrite:    {ScopeTasksRead},
+}
+
+// ValidScope reports whether scope is a known scope.
+func ValidScope(scope string) bool {
+	_, ok := impliedScopes[scope]
+	return ok
+}
+
+// HasScope reports whether the granted scopes include required, directly
+// or through a broader scope.
+func HasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		if scope == required {
+			return true
+		}
+		for _, implied := range impliedScopes[scope] {
+			if implied == required {
+				return true
+			}
+		}
+	}
+	return false
+}
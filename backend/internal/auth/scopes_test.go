@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasScope(t *testing.T) {
+	assert.True(t, HasScope([]string{ScopeTasksRead}, ScopeTasksRead))
+	assert.True(t, HasScope([]string{ScopeTasksWrite}, ScopeTasksRead))
+	assert.True(t, HasScope([]string{ScopeProjectsAdmin}, ScopeProjectsRead))
+	assert.False(t, HasScope([]string{ScopeTasksRead}, ScopeTasksWrite))
+	assert.False(t, HasScope([]string{ScopeProjectsAdmin}, ScopeTasksRead))
+	assert.False(t, HasScope(nil, ScopeTasksRead))
+
+	assert.True(t, ValidScope("projects:write"))
+	assert.False(t, ValidScope("admin"))
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/utils"
+)
+
+// syncInterval bounds how long a session revoked by another server instance
+// keeps working on this one.
+const syncInterval = 30 * time.Second
+
+// syncOverlap re-reads recent revocations on every sync so that transactions
+// committing slightly out of order are not missed.
+const syncOverlap = time.Minute
+
+// Sessions records logins and answers whether a session was revoked. Revoked
+// session IDs are cached in memory and refreshed from the database every
+// syncInterval, so the check does not cost a query per request. Until the
+// cache was loaded once, sessions are checked in the database instead.
+type Sessions struct {
+	db *database.Database
+
+	mu       sync.RWMutex
+	revoked  map[int]time.Time
+	cursor   *time.Time
+	syncedAt time.Time
+	// loaded is set once a sync succeeded; before, the cache is empty
+	loaded bool
+
+	// syncing is held while a sync queries the database, outside mu
+	syncing sync.Mutex
+}
+
+func NewSessions(db *database.Database) *Sessions {
+	return &Sessions{
+		db:      db,
+		revoked: make(map[int]time.Time),
+	}
+}
+
+// Create starts a session for a new login.
+func (s *Sessions) Create(ctx context.Context, userID int, ipAddress, userAgent string) (int, error) {
+	var id int
+	err := s.db.Pool.QueryRow(ctx,
+		`INSERT INTO sessions (user_id, device, ip_address, user_agent)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING id`,
+		userID, DeviceName(userAgent), ipAddress, userAgent).Scan(&id)
+	return id, err
+}
+
+// Touch records that a session was used to obtain new tokens.
+func (s *Sessions) Touch(ctx context.Context, sessionID int, ipAddress string) error {
+	_, err := s.db.Pool.Exec(ctx,
+		"UPDATE sessions SET last_used_at = NOW(), ip_address = $2 WHERE id = $1",
+		sessionID, ipAddress)
+	return err
+}
+
+// List returns the active sessions of a user, most recently used first.
+func (s *Sessions) List(ctx context.Context, userID int) ([]models.Session, error) {
+	rows, err := s.db.Pool.Query(ctx,
+		`SELECT id, device, ip_address, user_agent, last_used_at, created_at
+		 FROM sessions
+		 WHERE user_id = $1 AND revoked_at IS NULL AND last_used_at > NOW() - make_interval(secs => $2)
+		 ORDER BY last_used_at DESC`,
+		userID, utils.RefreshTokenTTL.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.Device, &session.IPAddress, &session.UserAgent,
+			&session.LastUsedAt, &session.CreatedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Revoke ends one session of a user. It reports false when the user has no
+// such active session.
+func (s *Sessions) Revoke(ctx context.Context, userID, sessionID int) (bool, error) {
+	ids, err := s.revoke(ctx,
+		`UPDATE sessions SET revoked_at = NOW()
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		 RETURNING id, revoked_at`,
+		sessionID, userID)
+	return len(ids) > 0, err
+}
+
+// RevokeAll ends every session of a user.
+func (s *Sessions) RevokeAll(ctx context.Context, userID int) (int, error) {
+	ids, err := s.revoke(ctx,
+		`UPDATE sessions SET revoked_at = NOW()
+		 WHERE user_id = $1 AND revoked_at IS NULL
+		 RETURNING id, revoked_at`,
+		userID)
+	return len(ids), err
+}
+
+// RevokeOthers ends every session of a user except keepSessionID.
+func (s *Sessions) RevokeOthers(ctx context.Context, userID, keepSessionID int) (int, error) {
+	ids, err := s.revoke(ctx,
+		`UPDATE sessions SET revoked_at = NOW()
+		 WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+		 RETURNING id, revoked_at`,
+		userID, keepSessionID)
+	return len(ids), err
+}
+
+func (s *Sessions) revoke(ctx context.Context, sql string, args ...interface{}) ([]int, error) {
+	rows, err := s.db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := make(map[int]time.Time)
+	var ids []int
+	for rows.Next() {
+		var id int
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		revoked[id] = at
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Deny the sessions on this instance right away
+	s.mu.Lock()
+	for id, at := range revoked {
+		s.revoked[id] = at
+	}
+	s.mu.Unlock()
+
+	return ids, nil
+}
+
+// IsRevoked reports whether a session has been revoked. If the cache cannot
+// be refreshed, the last known denylist is used. Before the first load,
+// requests wait for it, and if it fails the session is looked up directly;
+// a session that cannot be looked up counts as revoked.
+func (s *Sessions) IsRevoked(ctx context.Context, sessionID int) bool {
+	s.mu.RLock()
+	stale := time.Since(s.syncedAt) > syncInterval
+	loaded := s.loaded
+	s.mu.RUnlock()
+
+	if stale || !loaded {
+		if err := s.sync(ctx, !loaded); err != nil {
+			log.Printf("Failed to sync revoked sessions: %v", err)
+		}
+	}
+
+	s.mu.RLock()
+	_, revoked := s.revoked[sessionID]
+	loaded = s.loaded
+	s.mu.RUnlock()
+	if loaded {
+		return revoked
+	}
+
+	err := s.db.Pool.QueryRow(ctx,
+		"SELECT revoked_at IS NOT NULL FROM sessions WHERE id = $1",
+		sessionID).Scan(&revoked)
+	if err != nil {
+		log.Printf("Failed to check session %d: %v", sessionID, err)
+		return true
+	}
+	return revoked
+}
+
+// sync loads sessions revoked since the last sync and forgets those whose
+// access tokens have all expired. The query runs without holding mu, and
+// requests arriving while another one syncs keep using the cache as it is,
+// unless wait is set.
+func (s *Sessions) sync(ctx context.Context, wait bool) error {
+	if wait {
+		s.syncing.Lock()
+	} else if !s.syncing.TryLock() {
+		return nil
+	}
+	defer s.syncing.Unlock()
+
+	// Another request may have synced before we got here. The first sync
+	// loads every session revoked within the lifetime of an access token.
+	s.mu.RLock()
+	fresh := time.Since(s.syncedAt) <= syncInterval
+	var since *time.Time
+	if s.cursor != nil {
+		t := s.cursor.Add(-syncOverlap)
+		since = &t
+	}
+	s.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	revoked, err := s.loadRevoked(ctx, since)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Retry on the next interval instead of on every request
+	s.syncedAt = time.Now()
+	if err != nil {
+		return err
+	}
+	s.loaded = true
+
+	for id, at := range revoked {
+		s.revoked[id] = at
+		if s.cursor == nil || at.After(*s.cursor) {
+			cursor := at
+			s.cursor = &cursor
+		}
+	}
+
+	if s.cursor != nil {
+		expired := s.cursor.Add(-utils.AccessTokenTTL - syncOverlap)
+		for id, at := range s.revoked {
+			if at.Before(expired) {
+				delete(s.revoked, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadRevoked returns the sessions revoked after since, or within the
+// lifetime of an access token when since is nil. revoked_at is a TIMESTAMP,
+// so since is compared as one too; as a TIMESTAMPTZ it would be shifted by
+// the session time zone's offset.
+func (s *Sessions) loadRevoked(ctx context.Context, since *time.Time) (map[int]time.Time, error) {
+	rows, err := s.db.Pool.Query(ctx,
+		`SELECT id, revoked_at FROM sessions
+		 WHERE revoked_at > COALESCE($1::timestamp, LOCALTIMESTAMP - make_interval(secs => $2))`,
+		since, utils.AccessTokenTTL.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := make(map[int]time.Time)
+	for rows.Next() {
+		var id int
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		revoked[id] = at
+	}
+	return revoked, rows.Err()
+}
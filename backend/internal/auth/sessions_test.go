@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+// A database session time zone ahead of UTC, where a revocation cursor
+// compared as TIMESTAMPTZ would skip the revocations after it
+const testTimeZone = "Asia/Jakarta"
+
+func setupTestDB(t *testing.T) *database.Database {
+	db, err := database.NewDatabase("postgres://localhost:5432/4me_todos_test?sslmode=disable&timezone=" + testTimeZone)
+	if err != nil {
+		t.Skipf("Skipping test: database not available - %v", err)
+	}
+
+	_, _ = db.Pool.Exec(context.Background(), "TRUNCATE users, sessions CASCADE")
+
+	return db
+}
+
+func TestSessionsSyncInNonUTCTimeZone(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	var zone string
+	err := db.Pool.QueryRow(ctx, "SHOW TimeZone").Scan(&zone)
+	assert.NoError(t, err)
+	assert.Equal(t, testTimeZone, zone)
+
+	var userID int
+	err = db.Pool.QueryRow(ctx,
+		"INSERT INTO users (username, email, password_hash) VALUES ('sessions', 'sessions@example.com', '') RETURNING id").
+		Scan(&userID)
+	assert.NoError(t, err)
+
+	other := NewSessions(db)
+	first, err := other.Create(ctx, userID, "127.0.0.1", "test")
+	assert.NoError(t, err)
+	second, err := other.Create(ctx, userID, "127.0.0.1", "test")
+	assert.NoError(t, err)
+
+	// The first load sets the cursor from the first revocation
+	_, err = other.Revoke(ctx, userID, first)
+	assert.NoError(t, err)
+	sessions := NewSessions(db)
+	assert.True(t, sessions.IsRevoked(ctx, first))
+	assert.False(t, sessions.IsRevoked(ctx, second))
+
+	// A revocation on another instance is loaded by the next sync
+	_, err = other.Revoke(ctx, userID, second)
+	assert.NoError(t, err)
+	sessions.mu.Lock()
+	sessions.syncedAt = time.Time{}
+	sessions.mu.Unlock()
+	assert.True(t, sessions.IsRevoked(ctx, second))
+}
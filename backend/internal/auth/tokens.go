@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/utils"
+)
+
+// AccessTokenPrefix starts every personal access token, so they can be told
+// apart from JWTs and recognized by secret scanners.
+const AccessTokenPrefix = "4me_pat_"
+
+// lastUsedInterval limits how often last_used_at is written for a token.
+const lastUsedInterval = time.Minute
+
+// Principal is the user a personal access token acts for, with the
+// permissions the token grants.
+type Principal struct {
+	TokenID   int
+	UserID    int
+	Username  string
+	Scopes    []string
+	ProjectID *int
+}
+
+// AccessTokens stores personal access tokens.
+type AccessTokens struct {
+	db *database.Database
+}
+
+func NewAccessTokens(db *database.Database) *AccessTokens {
+	return &AccessTokens{db: db}
+}
+
+// IsAccessToken reports whether a bearer token is a personal access token.
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// Create issues a token and returns it with its stored record. The token is
+// not stored and cannot be shown again.
+func (t *AccessTokens) Create(ctx context.Context, userID int, name string, scopes []string, projectID *int, expiresAt *time.Time) (string, models.PersonalAccessToken, error) {
+	var record models.PersonalAccessToken
+
+	random, err := utils.RandomToken(32)
+	if err != nil {
+		return "", record, err
+	}
+	token := AccessTokenPrefix + random
+
+	err = t.db.Pool.QueryRow(ctx,
+		`INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, project_id, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id, name, token_prefix, scopes, project_id, expires_at, last_used_at, created_at`,
+		userID, name, utils.HashToken(token), token[:len(AccessTokenPrefix)+8], scopes, projectID, expiresAt).
+		Scan(&record.ID, &record.Name, &record.TokenPrefix, &record.Scopes, &record.ProjectID,
+			&record.ExpiresAt, &record.LastUsedAt, &record.CreatedAt)
+	return token, record, err
+}
+
+// List returns the tokens of a user that have not been revoked, newest
+// first. Expired tokens are included so they can be cleaned up.
+func (t *AccessTokens) List(ctx context.Context, userID int) ([]models.PersonalAccessToken, error) {
+	rows, err := t.db.Pool.Query(ctx,
+		`SELECT id, name, token_prefix, scopes, project_id, expires_at, last_used_at, created_at
+		 FROM personal_access_tokens
+		 WHERE user_id = $1 AND revoked_at IS NULL
+		 ORDER BY created_at DESC`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.PersonalAccessToken{}
+	for rows.Next() {
+		var record models.PersonalAccessToken
+		if err := rows.Scan(&record.ID, &record.Name, &record.TokenPrefix, &record.Scopes, &record.ProjectID,
+			&record.ExpiresAt, &record.LastUsedAt, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, record)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Revoke disables a token of a user. It reports false when the user has no
+// such token.
+func (t *AccessTokens) Revoke(ctx context.Context, userID, tokenID int) (bool, error) {
+	result, err := t.db.Pool.Exec(ctx,
+		`UPDATE personal_access_tokens SET revoked_at = NOW()
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// Authenticate returns the principal of a valid token, or an error when the
+// token is unknown, revoked or expired.
+func (t *AccessTokens) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	var p Principal
+	err := t.db.Pool.QueryRow(ctx,
+		`SELECT t.id, t.user_id, u.username, t.scopes, t.project_id
+		 FROM personal_access_tokens t
+		 JOIN users u ON t.user_id = u.id
+		 WHERE t.token_hash = $1 AND t.revoked_at IS NULL
+		   AND (t.expires_at IS NULL OR t.expires_at > NOW())`,
+		utils.HashToken(token)).
+		Scan(&p.TokenID, &p.UserID, &p.Username, &p.Scopes, &p.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.db.Pool.Exec(ctx,
+		`UPDATE personal_access_tokens SET last_used_at = NOW()
+		 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - make_interval(secs => $2))`,
+		p.TokenID, lastUsedInterval.Seconds())
+	if err != nil {
+		log.Printf("Failed to update access token %d: %v", p.TokenID, err)
+	}
+
+	return &p, nil
+}
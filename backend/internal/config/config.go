@@ -1,22 +1,122 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// DefaultJWTSecret is the development secret used when JWT_SECRET is unset.
+// The server refuses to start with it in production.
+const DefaultJWTSecret = "your-secret-key-change-this"
+
+// DefaultTOTPEncryptionKey is the development key used when
+// TOTP_ENCRYPTION_KEY is unset. The server refuses to start with it in
+// production.
+const DefaultTOTPEncryptionKey = "your-totp-key-change-this"
+
+// providerNamePattern is what OIDC_NAME may contain, as it appears in routes
+// and is stored with each user identity.
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// builtinProviders are the sign-in providers OIDC_NAME must not replace;
+// identities stored under their names belong to their issuers.
+var builtinProviders = []string{"google", "github"}
+
 type Config struct {
-	DatabaseURL        string
-	JWTSecret          string
+	// Environment is "development" or "production"
+	Environment string
+
+	DatabaseURL string
+	JWTSecret   string
+
+	// Access tokens are signed with the asymmetric keys in JWTKeysDir when
+	// it is set, or with JWTSecret otherwise. Retired keys keep verifying
+	// tokens for JWTKeyGracePeriod.
+	JWTKeysDir        string
+	JWTKeyGracePeriod time.Duration
+
+	// TOTPEncryptionKey encrypts the stored TOTP secrets. Unlike the JWT
+	// keys it cannot be rotated without re-encrypting them.
+	TOTPEncryptionKey string
+
+	// AuthMode is "header" to return tokens in response bodies for the
+	// Authorization header, or "cookie" to keep them in HttpOnly cookies
+	// with double-submit CSRF protection
+	AuthMode       string
+	CookieDomain   string
+	CookieSecure   bool
+	CookieSameSite string
+
 	GoogleClientID     string
 	GoogleClientSecret string
 	GoogleRedirectURL  string
-	SupabaseURL        string
-	SupabaseKey        string
-	FrontendURL        string
-	Port               string
+
+	// Additional OAuth providers; each is enabled when its client ID is set
+	GitHubClientID     string
+	GitHubClientSecret string
+	GitHubRedirectURL  string
+	OIDCName           string
+	OIDCIssuerURL      string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCRedirectURL    string
+	OIDCScopes         string
+
+	SupabaseURL string
+	SupabaseKey string
+	FrontendURL string
+	Port        string
+
+	// CORSAllowedOrigins are the origins allowed to call the API, such as
+	// "https://app.example.com" or "https://*.example.com"
+	CORSAllowedOrigins []string
+	CORSMaxAge         time.Duration
+
+	// Mail delivery: MailDriver is "smtp", "file" or "log"
+	MailDriver   string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// RequireVerifiedEmail stops users from joining projects through
+	// invitations until they have verified their email address
+	RequireVerifiedEmail bool
+
+	// Rate limiting of the authentication endpoints. RateLimitStore is
+	// "memory" for a single instance or "postgres" to share limits between
+	// replicas. The limits are requests per minute.
+	RateLimitStore          string
+	AuthRateLimitPerIP      int
+	AuthRateLimitPerAccount int
+	LoginMaxFailures        int
+	LoginFailureWindow      time.Duration
+	LoginLockoutDuration    time.Duration
+
+	// Requests per minute to the whole API, per client IP, per user and per
+	// personal access token; 0 turns a limit off
+	APIRateLimitPerIP    int
+	APIRateLimitPerUser  int
+	APIRateLimitPerToken int
+
+	// Storage quotas; 0 means unlimited
+	MaxProjectsPerUser        int
+	MaxTasksPerBoard          int
+	MaxAttachmentBytesPerUser int64
+
+	// RecurrenceInterval is how often recurring tasks due for their next
+	// instance are looked for
+	RecurrenceInterval time.Duration
 }
 
 func LoadConfig() *Config {
@@ -25,22 +125,153 @@ func LoadConfig() *Config {
 		log.Println("No .env file found, using environment variables")
 	}
 
+	oidcName := getEnv("OIDC_NAME", "oidc")
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:5173")
+
 	return &Config{
+		Environment:        getEnv("APP_ENV", "development"),
 		DatabaseURL:        getEnv("DATABASE_URL", "postgres://localhost:5432/4me_todos?sslmode=disable"),
-		JWTSecret:          getEnv("JWT_SECRET", "your-secret-key-change-this"),
+		JWTSecret:          getEnv("JWT_SECRET", DefaultJWTSecret),
+		JWTKeysDir:         getEnv("JWT_KEYS_DIR", ""),
+		JWTKeyGracePeriod:  getEnvDuration("JWT_KEY_GRACE_PERIOD", 24*time.Hour),
+		TOTPEncryptionKey:  getEnv("TOTP_ENCRYPTION_KEY", DefaultTOTPEncryptionKey),
+		AuthMode:           getEnv("AUTH_MODE", "header"),
+		CookieDomain:       getEnv("COOKIE_DOMAIN", ""),
+		CookieSecure:       getEnv("COOKIE_SECURE", "true") == "true",
+		CookieSameSite:     getEnv("COOKIE_SAMESITE", "lax"),
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
 		GoogleRedirectURL:  getEnv("GOOGLE_REDIRECT_URL", "http://localhost:8080/api/auth/google/callback"),
+		GitHubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
+		GitHubRedirectURL:  getEnv("GITHUB_REDIRECT_URL", "http://localhost:8080/api/auth/oauth/github/callback"),
+		OIDCName:           oidcName,
+		OIDCIssuerURL:      getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID:       getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:   getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:    getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/auth/oauth/"+oidcName+"/callback"),
+		OIDCScopes:         getEnv("OIDC_SCOPES", "openid email profile"),
 		SupabaseURL:        getEnv("SUPABASE_URL", ""),
 		SupabaseKey:        getEnv("SUPABASE_KEY", ""),
-		FrontendURL:        getEnv("FRONTEND_URL", "http://localhost:5173"),
+		FrontendURL:        frontendURL,
 		Port:               getEnv("PORT", "8080"),
+
+		CORSAllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS", []string{frontendURL}),
+		CORSMaxAge:         getEnvDuration("CORS_MAX_AGE", 2*time.Hour),
+
+		MailDriver:   getEnv("MAIL_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "4me <no-reply@localhost>"),
+		MailDir:      getEnv("MAIL_DIR", "tmp/mail"),
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+		RequireVerifiedEmail: getEnv("REQUIRE_VERIFIED_EMAIL", "true") == "true",
+
+		RateLimitStore:          getEnv("RATE_LIMIT_STORE", "memory"),
+		AuthRateLimitPerIP:      getEnvInt("AUTH_RATE_LIMIT_PER_IP", 30),
+		AuthRateLimitPerAccount: getEnvInt("AUTH_RATE_LIMIT_PER_ACCOUNT", 10),
+		LoginMaxFailures:        getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginFailureWindow:      getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockoutDuration:    getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+
+		APIRateLimitPerIP:    getEnvInt("API_RATE_LIMIT_PER_IP", 600),
+		APIRateLimitPerUser:  getEnvInt("API_RATE_LIMIT_PER_USER", 300),
+		APIRateLimitPerToken: getEnvInt("API_RATE_LIMIT_PER_TOKEN", 120),
+
+		MaxProjectsPerUser:        getEnvInt("MAX_PROJECTS_PER_USER", 100),
+		MaxTasksPerBoard:          getEnvInt("MAX_TASKS_PER_BOARD", 1000),
+		MaxAttachmentBytesPerUser: int64(getEnvInt("MAX_ATTACHMENT_BYTES_PER_USER", 1<<30)),
+
+		RecurrenceInterval: getEnvDuration("RECURRENCE_INTERVAL", time.Minute),
 	}
 }
 
+// Validate reports settings that are unsafe for the environment.
+func (c *Config) Validate() error {
+	if c.AuthMode != "header" && c.AuthMode != "cookie" {
+		return fmt.Errorf("AUTH_MODE must be header or cookie, not %q", c.AuthMode)
+	}
+	if c.CookieMode() && strings.EqualFold(c.CookieSameSite, "none") && !c.CookieSecure {
+		return errors.New("COOKIE_SAMESITE=none requires COOKIE_SECURE=true")
+	}
+	if c.RecurrenceInterval <= 0 {
+		return errors.New("RECURRENCE_INTERVAL must be positive")
+	}
+	if !providerNamePattern.MatchString(c.OIDCName) {
+		return fmt.Errorf("OIDC_NAME must contain only lowercase letters, digits, _ and -, not %q", c.OIDCName)
+	}
+	for _, name := range builtinProviders {
+		if c.OIDCName == name {
+			return fmt.Errorf("OIDC_NAME must not be %q, the name of a built-in provider", name)
+		}
+	}
+
+	if c.Environment != "production" {
+		return nil
+	}
+	if c.JWTSecret == DefaultJWTSecret {
+		return errors.New("JWT_SECRET must be set to a random secret in production")
+	}
+	if len(c.JWTSecret) < 32 {
+		return errors.New("JWT_SECRET must be at least 32 characters in production")
+	}
+	if c.TOTPEncryptionKey == DefaultTOTPEncryptionKey {
+		return errors.New("TOTP_ENCRYPTION_KEY must be set to a random secret in production")
+	}
+	if len(c.TOTPEncryptionKey) < 32 {
+		return errors.New("TOTP_ENCRYPTION_KEY must be at least 32 characters in production")
+	}
+	return nil
+}
+
+// CookieMode reports whether tokens are kept in cookies.
+func (c *Config) CookieMode() bool {
+	return c.AuthMode == "cookie"
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return n
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return d
+}
+
+// getEnvList reads a comma separated list.
+func getEnvList(key string, defaultValue []string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values
+}
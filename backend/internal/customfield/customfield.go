@@ -0,0 +1,186 @@
+// Package customfield validates the options of custom fields and the values
+// tasks give them. Values are stored as JSON:
+//
+//	text, url       "string"
+//	number          12.5
+//	date            "2025-01-31"
+//	single_select   "option"
+//	multi_select    ["option", "other option"]
+//	user            42 (a user ID)
+//	checkbox        true
+package customfield
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+const (
+	maxOptions      = 100
+	maxOptionLength = 100
+	maxTextLength   = 5000
+	maxURLLength    = 2048
+)
+
+// IsSelect reports whether fields of the type choose from options.
+func IsSelect(fieldType string) bool {
+	return fieldType == models.CustomFieldSingleSelect || fieldType == models.CustomFieldMultiSelect
+}
+
+// Options validates the options of a field and returns them trimmed. Select
+// fields need at least one option, each unique; other fields take none.
+func Options(fieldType string, options []string) ([]string, error) {
+	if !IsSelect(fieldType) {
+		if len(options) > 0 {
+			return nil, fmt.Errorf("%s fields have no options", fieldType)
+		}
+		return []string{}, nil
+	}
+
+	if len(options) == 0 {
+		return nil, errors.New("select fields need at least one option")
+	}
+	if len(options) > maxOptions {
+		return nil, fmt.Errorf("select fields can have at most %d options", maxOptions)
+	}
+
+	out := make([]string, 0, len(options))
+	seen := map[string]bool{}
+	for _, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" || len(option) > maxOptionLength {
+			return nil, fmt.Errorf("options must be 1 to %d characters", maxOptionLength)
+		}
+		if seen[option] {
+			return nil, fmt.Errorf("option %q is listed twice", option)
+		}
+		seen[option] = true
+		out = append(out, option)
+	}
+	return out, nil
+}
+
+// Value validates a value for a field and returns it normalized: numbers as
+// float64, dates as YYYY-MM-DD, users as int and multi-select options in the
+// order of the field's options. It returns nil for null, an empty text or an
+// empty selection, which clears the value.
+func Value(field models.CustomField, raw json.RawMessage) (interface{}, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	switch field.Type {
+	case models.CustomFieldText:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be a string")
+		}
+		if len(s) > maxTextLength {
+			return nil, fmt.Errorf("must be at most %d characters", maxTextLength)
+		}
+		if strings.TrimSpace(s) == "" {
+			return nil, nil
+		}
+		return s, nil
+
+	case models.CustomFieldNumber:
+		var n float64
+		if err := json.Unmarshal(raw, &n); err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, errors.New("must be a number")
+		}
+		return n, nil
+
+	case models.CustomFieldDate:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be a date string")
+		}
+		if t, err := time.Parse("2006-01-02", s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t.UTC().Format("2006-01-02"), nil
+		}
+		return nil, errors.New("must be a date like 2025-01-31")
+
+	case models.CustomFieldSingleSelect:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be one of the field's options")
+		}
+		if !contains(field.Options, s) {
+			return nil, fmt.Errorf("%q is not one of the field's options", s)
+		}
+		return s, nil
+
+	case models.CustomFieldMultiSelect:
+		var selected []string
+		if err := json.Unmarshal(raw, &selected); err != nil {
+			return nil, errors.New("must be a list of the field's options")
+		}
+		for _, s := range selected {
+			if !contains(field.Options, s) {
+				return nil, fmt.Errorf("%q is not one of the field's options", s)
+			}
+		}
+		out := []string{}
+		for _, option := range field.Options {
+			if contains(selected, option) {
+				out = append(out, option)
+			}
+		}
+		if len(out) == 0 {
+			return nil, nil
+		}
+		return out, nil
+
+	case models.CustomFieldUser:
+		var id int
+		if err := json.Unmarshal(raw, &id); err != nil || id <= 0 {
+			return nil, errors.New("must be a user ID")
+		}
+		return id, nil
+
+	case models.CustomFieldURL:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be a URL string")
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, nil
+		}
+		u, err := url.ParseRequestURI(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(s) > maxURLLength {
+			return nil, errors.New("must be an http or https URL")
+		}
+		return s, nil
+
+	case models.CustomFieldCheckbox:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("unknown field type %q", field.Type)
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
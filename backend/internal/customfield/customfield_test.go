@@ -0,0 +1,81 @@
+package customfield
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions(t *testing.T) {
+	options, err := Options(models.CustomFieldSingleSelect, []string{" dev ", "prod"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dev", "prod"}, options)
+
+	options, err = Options(models.CustomFieldNumber, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, options)
+
+	for name, tt := range map[string]struct {
+		fieldType string
+		options   []string
+	}{
+		"no options":       {models.CustomFieldMultiSelect, nil},
+		"duplicate option": {models.CustomFieldMultiSelect, []string{"a", " a"}},
+		"empty option":     {models.CustomFieldSingleSelect, []string{""}},
+		"options on text":  {models.CustomFieldText, []string{"a"}},
+	} {
+		_, err := Options(tt.fieldType, tt.options)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestValue(t *testing.T) {
+	envs := []string{"dev", "staging", "prod"}
+	tests := []struct {
+		fieldType string
+		raw       string
+		want      interface{}
+	}{
+		{models.CustomFieldText, `"Acme"`, "Acme"},
+		{models.CustomFieldText, `"  "`, nil},
+		{models.CustomFieldNumber, `5`, 5.0},
+		{models.CustomFieldDate, `"2025-01-31"`, "2025-01-31"},
+		{models.CustomFieldDate, `"2025-01-31T23:00:00-02:00"`, "2025-02-01"},
+		{models.CustomFieldSingleSelect, `"prod"`, "prod"},
+		{models.CustomFieldMultiSelect, `["prod", "dev", "prod"]`, []string{"dev", "prod"}},
+		{models.CustomFieldMultiSelect, `[]`, nil},
+		{models.CustomFieldUser, `42`, 42},
+		{models.CustomFieldURL, `"https://example.com/release"`, "https://example.com/release"},
+		{models.CustomFieldCheckbox, `false`, false},
+		{models.CustomFieldNumber, `null`, nil},
+	}
+	for _, tt := range tests {
+		got, err := Value(models.CustomField{Type: tt.fieldType, Options: envs}, json.RawMessage(tt.raw))
+		require.NoError(t, err, "%s %s", tt.fieldType, tt.raw)
+		assert.Equal(t, tt.want, got, "%s %s", tt.fieldType, tt.raw)
+	}
+
+	invalid := []struct {
+		fieldType string
+		raw       string
+	}{
+		{models.CustomFieldText, `5`},
+		{models.CustomFieldNumber, `"5"`},
+		{models.CustomFieldDate, `"tomorrow"`},
+		{models.CustomFieldSingleSelect, `"qa"`},
+		{models.CustomFieldMultiSelect, `"dev"`},
+		{models.CustomFieldMultiSelect, `["dev", "qa"]`},
+		{models.CustomFieldUser, `1.5`},
+		{models.CustomFieldUser, `-1`},
+		{models.CustomFieldURL, `"javascript:alert(1)"`},
+		{models.CustomFieldURL, `"example.com"`},
+		{models.CustomFieldCheckbox, `"yes"`},
+	}
+	for _, tt := range invalid {
+		_, err := Value(models.CustomField{Type: tt.fieldType, Options: envs}, json.RawMessage(tt.raw))
+		assert.Error(t, err, "%s %s", tt.fieldType, tt.raw)
+	}
+}
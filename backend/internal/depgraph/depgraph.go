@@ -0,0 +1,125 @@
+// Package depgraph analyzes "blocks" dependencies between tasks. A task
+// blocks another when it has to be done before the other can start, so the
+// dependencies of a project must form a directed acyclic graph.
+package depgraph
+
+import "sort"
+
+// Edge says that task From blocks task To.
+type Edge struct {
+	From int
+	To   int
+}
+
+// Graph is a set of blocking dependencies.
+type Graph struct {
+	next map[int][]int
+	prev map[int][]int
+}
+
+func New(edges []Edge) *Graph {
+	g := &Graph{next: make(map[int][]int), prev: make(map[int][]int)}
+	for _, e := range edges {
+		g.next[e.From] = append(g.next[e.From], e.To)
+		g.prev[e.To] = append(g.prev[e.To], e.From)
+	}
+	for _, ids := range g.next {
+		sort.Ints(ids)
+	}
+	return g
+}
+
+// Path returns the shortest chain of tasks from one task to another, each
+// blocking the next, or nil when from does not lead to to. Adding the edge
+// to -> from would close this path into a cycle.
+func (g *Graph) Path(from, to int) []int {
+	parent := map[int]int{from: from}
+	queue := []int{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == to {
+			path := []int{to}
+			for id != from {
+				id = parent[id]
+				path = append(path, id)
+			}
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return path
+		}
+		for _, next := range g.next[id] {
+			if _, seen := parent[next]; !seen {
+				parent[next] = id
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// CriticalPath returns the chain of tasks, each blocking the next, with the
+// largest total weight: the work that decides how soon everything can be
+// done. Only tasks in weights take part, so finished tasks can be left out.
+// Ties go to the chain ending in the lowest task ID.
+func (g *Graph) CriticalPath(weights map[int]int) []int {
+	ids := make([]int, 0, len(weights))
+	indegree := make(map[int]int, len(weights))
+	for id := range weights {
+		ids = append(ids, id)
+		for _, from := range g.prev[id] {
+			if _, ok := weights[from]; ok {
+				indegree[id]++
+			}
+		}
+	}
+	sort.Ints(ids)
+
+	// Kahn's algorithm visits every task after the tasks blocking it
+	var queue []int
+	for _, id := range ids {
+		if indegree[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+
+	total := make(map[int]int, len(weights))
+	best := make(map[int]int, len(weights))
+	end, endTotal := 0, -1
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		total[id] += weights[id]
+		if total[id] > endTotal || (total[id] == endTotal && id < end) {
+			end, endTotal = id, total[id]
+		}
+
+		for _, next := range g.next[id] {
+			if _, ok := weights[next]; !ok {
+				continue
+			}
+			if _, ok := best[next]; !ok || total[id] > total[best[next]] {
+				best[next] = id
+				total[next] = total[id]
+			}
+			indegree[next]--
+			if indegree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	if endTotal < 0 {
+		return []int{}
+	}
+	path := []int{end}
+	for id, ok := best[end]; ok; id, ok = best[id] {
+		path = append(path, id)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
@@ -0,0 +1,30 @@
+package depgraph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPath(t *testing.T) {
+	g := New([]Edge{{1, 2}, {2, 3}, {3, 4}, {1, 4}, {5, 1}})
+
+	assert.Equal(t, []int{1, 4}, g.Path(1, 4))
+	assert.Equal(t, []int{5, 1, 2, 3}, g.Path(5, 3))
+	assert.Equal(t, []int{2}, g.Path(2, 2))
+	assert.Nil(t, g.Path(4, 1))
+	assert.Nil(t, g.Path(6, 1))
+}
+
+func TestCriticalPath(t *testing.T) {
+	// 1 -> 2 -> 4 and 1 -> 3 -> 4, where 3 is more work than 2
+	g := New([]Edge{{1, 2}, {1, 3}, {2, 4}, {3, 4}, {5, 6}})
+
+	assert.Equal(t, []int{1, 2, 4}, g.CriticalPath(map[int]int{1: 1, 2: 1, 3: 1, 4: 1, 5: 1, 6: 1}))
+	assert.Equal(t, []int{1, 3, 4}, g.CriticalPath(map[int]int{1: 1, 2: 1, 3: 5, 4: 1, 5: 1, 6: 1}))
+	assert.Equal(t, []int{5, 6}, g.CriticalPath(map[int]int{1: 1, 2: 1, 3: 1, 4: 1, 5: 2, 6: 2}))
+
+	// Tasks without a weight, such as finished ones, are left out
+	assert.Equal(t, []int{3, 4}, g.CriticalPath(map[int]int{3: 1, 4: 1, 6: 1}))
+	assert.Equal(t, []int{}, g.CriticalPath(map[int]int{}))
+}
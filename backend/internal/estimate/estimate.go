@@ -0,0 +1,124 @@
+// Package estimate rolls up task estimates and logged time into project
+// reports.
+package estimate
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/timesheet"
+)
+
+// Task is the estimates of a task and the time logged on it.
+type Task struct {
+	BoardID    int
+	AssigneeID *int
+	Username   *string
+	// Done reports whether the task is finished
+	Done              bool
+	OriginalEstimate  *float64
+	RemainingEstimate *float64
+	SpentSeconds      int64
+}
+
+// Remaining is the work left on a task: none once it is finished, otherwise
+// its remaining estimate, or its original one when it has no remaining
+// estimate.
+func (t Task) Remaining() float64 {
+	switch {
+	case t.Done:
+		return 0
+	case t.RemainingEstimate != nil:
+		return *t.RemainingEstimate
+	case t.OriginalEstimate != nil:
+		return *t.OriginalEstimate
+	}
+	return 0
+}
+
+// Build adds up the tasks of a project for the whole project, per board, in
+// the order of boards, and per assignee, sorted by username with unassigned
+// tasks last. Boards without tasks are included.
+func Build(projectID int, unit string, boards []models.Board, tasks []Task) models.EstimateReport {
+	report := models.EstimateReport{
+		ProjectID: projectID,
+		Unit:      unit,
+		Boards:    make([]models.BoardEstimate, len(boards)),
+		Assignees: []models.AssigneeEstimate{},
+	}
+
+	boardIndex := map[int]int{}
+	for i, board := range boards {
+		report.Boards[i] = models.BoardEstimate{BoardID: board.ID, BoardName: board.Name}
+		boardIndex[board.ID] = i
+	}
+
+	assigneeIndex := map[int]int{}
+	unassigned := -1
+	for _, task := range tasks {
+		add(&report.Total, task)
+		if i, ok := boardIndex[task.BoardID]; ok {
+			add(&report.Boards[i].EstimateRollup, task)
+		}
+
+		var i int
+		var ok bool
+		if task.AssigneeID == nil {
+			i, ok = unassigned, unassigned >= 0
+		} else {
+			i, ok = assigneeIndex[*task.AssigneeID]
+		}
+		if !ok {
+			i = len(report.Assignees)
+			report.Assignees = append(report.Assignees, models.AssigneeEstimate{
+				AssigneeID: task.AssigneeID,
+				Username:   task.Username,
+			})
+			if task.AssigneeID == nil {
+				unassigned = i
+			} else {
+				assigneeIndex[*task.AssigneeID] = i
+			}
+		}
+		add(&report.Assignees[i].EstimateRollup, task)
+	}
+
+	sort.SliceStable(report.Assignees, func(i, j int) bool {
+		a, b := report.Assignees[i], report.Assignees[j]
+		if a.AssigneeID == nil || b.AssigneeID == nil {
+			return b.AssigneeID == nil && a.AssigneeID != nil
+		}
+		if *a.Username != *b.Username {
+			return *a.Username < *b.Username
+		}
+		return *a.AssigneeID < *b.AssigneeID
+	})
+
+	finish(&report.Total)
+	for i := range report.Boards {
+		finish(&report.Boards[i].EstimateRollup)
+	}
+	for i := range report.Assignees {
+		finish(&report.Assignees[i].EstimateRollup)
+	}
+	return report
+}
+
+func add(r *models.EstimateRollup, task Task) {
+	r.TaskCount++
+	if task.OriginalEstimate != nil {
+		r.EstimatedTaskCount++
+		r.OriginalEstimate += *task.OriginalEstimate
+	}
+	r.RemainingEstimate += task.Remaining()
+	r.SpentSeconds += task.SpentSeconds
+}
+
+// finish rounds the sums, which add up values with two decimals, and
+// converts the time spent to hours.
+func finish(r *models.EstimateRollup) {
+	r.OriginalEstimate = math.Round(r.OriginalEstimate*100) / 100
+	r.RemainingEstimate = math.Round(r.RemainingEstimate*100) / 100
+	r.SpentHours = timesheet.Hours(r.SpentSeconds)
+}
@@ -0,0 +1,54 @@
+package estimate
+
+import (
+	"testing"
+
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestRemaining(t *testing.T) {
+	assert.Equal(t, 3.0, Task{OriginalEstimate: ptr(5.0), RemainingEstimate: ptr(3.0)}.Remaining())
+	assert.Equal(t, 5.0, Task{OriginalEstimate: ptr(5.0)}.Remaining())
+	assert.Equal(t, 0.0, Task{Done: true, OriginalEstimate: ptr(5.0), RemainingEstimate: ptr(3.0)}.Remaining())
+	assert.Equal(t, 0.0, Task{}.Remaining())
+}
+
+func TestBuild(t *testing.T) {
+	boards := []models.Board{{ID: 2, Name: "Doing"}, {ID: 1, Name: "Backlog"}, {ID: 3, Name: "Done"}}
+	report := Build(7, models.EstimateUnitHours, boards, []Task{
+		{BoardID: 1, AssigneeID: ptr(5), Username: ptr("zoe"), OriginalEstimate: ptr(0.1), RemainingEstimate: ptr(0.1)},
+		{BoardID: 1, OriginalEstimate: ptr(0.2)},
+		{BoardID: 2, AssigneeID: ptr(4), Username: ptr("ann"), OriginalEstimate: ptr(8.0), RemainingEstimate: ptr(2.0), SpentSeconds: 7 * 3600},
+		{BoardID: 2, AssigneeID: ptr(5), Username: ptr("zoe"), Done: true, OriginalEstimate: ptr(3.0), SpentSeconds: 5400},
+		{BoardID: 2, AssigneeID: ptr(5), Username: ptr("zoe"), SpentSeconds: 600},
+	})
+
+	assert.Equal(t, 7, report.ProjectID)
+	assert.Equal(t, models.EstimateUnitHours, report.Unit)
+	assert.Equal(t, models.EstimateRollup{
+		TaskCount: 5, EstimatedTaskCount: 4, OriginalEstimate: 11.3, RemainingEstimate: 2.3, SpentSeconds: 31200, SpentHours: 8.67,
+	}, report.Total)
+
+	require.Len(t, report.Boards, 3)
+	assert.Equal(t, models.BoardEstimate{BoardID: 2, BoardName: "Doing", EstimateRollup: models.EstimateRollup{
+		TaskCount: 3, EstimatedTaskCount: 2, OriginalEstimate: 11, RemainingEstimate: 2, SpentSeconds: 31200, SpentHours: 8.67,
+	}}, report.Boards[0])
+	assert.Equal(t, 0.3, report.Boards[1].OriginalEstimate)
+	assert.Equal(t, 0.3, report.Boards[1].RemainingEstimate)
+	assert.Equal(t, models.BoardEstimate{BoardID: 3, BoardName: "Done"}, report.Boards[2])
+
+	require.Len(t, report.Assignees, 3)
+	assert.Equal(t, "ann", *report.Assignees[0].Username)
+	assert.Equal(t, "zoe", *report.Assignees[1].Username)
+	assert.Equal(t, models.EstimateRollup{
+		TaskCount: 3, EstimatedTaskCount: 2, OriginalEstimate: 3.1, RemainingEstimate: 0.1, SpentSeconds: 6000, SpentHours: 1.67,
+	}, report.Assignees[1].EstimateRollup)
+	assert.Nil(t, report.Assignees[2].AssigneeID)
+	assert.Equal(t, 1, report.Assignees[2].TaskCount)
+}
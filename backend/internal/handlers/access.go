@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+// Each lookup query selects the project_id owning the resource with ID $1.
+const (
+	projectLookup     = "SELECT id AS project_id FROM projects WHERE id = $1"
+	boardLookup       = "SELECT project_id FROM boards WHERE id = $1"
+	taskLookup        = "SELECT b.project_id FROM tasks t JOIN boards b ON t.board_id = b.id WHERE t.id = $1"
+	labelLookup       = "SELECT project_id FROM labels WHERE id = $1"
+	commentLookup     = "SELECT b.project_id FROM comments c JOIN tasks t ON c.task_id = t.id JOIN boards b ON t.board_id = b.id WHERE c.id = $1"
+	attachmentLookup  = "SELECT b.project_id FROM attachments a JOIN tasks t ON a.task_id = t.id JOIN boards b ON t.board_id = b.id WHERE a.id = $1"
+	checklistLookup   = "SELECT b.project_id FROM checklist_items ci JOIN tasks t ON ci.task_id = t.id JOIN boards b ON t.board_id = b.id WHERE ci.id = $1"
+	dependencyLookup  = "SELECT b.project_id FROM task_dependencies d JOIN tasks t ON d.task_id = t.id JOIN boards b ON t.board_id = b.id WHERE d.id = $1"
+	customFieldLookup = "SELECT project_id FROM custom_fields WHERE id = $1"
+	statusLookup      = "SELECT project_id FROM project_statuses WHERE id = $1"
+	priorityLookup    = "SELECT project_id FROM project_priorities WHERE id = $1"
+	timeEntryLookup   = "SELECT b.project_id FROM time_entries e JOIN tasks t ON e.task_id = t.id JOIN boards b ON t.board_id = b.id WHERE e.id = $1"
+)
+
+// memberProjectsSQL selects the IDs of every project the user $N is a member
+// of; format it with the placeholder of the user ID argument.
+const memberProjectsSQL = "SELECT project_id FROM project_members WHERE user_id = %s"
+
+// authorize resolves the project owning a resource and checks that the
+// current user is a member with at least the given role. It writes a 404 when
+// the resource does not exist or the user is not a member, so projects of
+// other teams stay invisible, and a 403 when the role is insufficient.
+func authorize(c *gin.Context, db *database.Database, lookup string, id int, notFound string, min models.ProjectRole) (int, models.ProjectRole, bool) {
+	userID, _ := c.Get("userID")
+
+	var projectID int
+	var role *models.ProjectRole
+	err := db.Pool.QueryRow(context.Background(),
+		`SELECT r.project_id, m.role
+		 FROM (`+lookup+`) r
+		 LEFT JOIN project_members m ON m.project_id = r.project_id AND m.user_id = $2`,
+		id, userID).Scan(&projectID, &role)
+	if err != nil || role == nil {
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return 0, "", false
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return 0, "", false
+	}
+
+	// Access tokens restricted to another project cannot see this one
+	if restricted, ok := tokenProject(c); ok && restricted != projectID {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return 0, "", false
+	}
+
+	if !role.AtLeast(min) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This action requires the " + string(min) + " role or higher"})
+		return 0, "", false
+	}
+
+	return projectID, *role, true
+}
+
+func authorizeProject(c *gin.Context, db *database.Database, projectID int, min models.ProjectRole) (models.ProjectRole, bool) {
+	_, role, ok := authorize(c, db, projectLookup, projectID, "Project not found", min)
+	return role, ok
+}
+
+func authorizeBoard(c *gin.Context, db *database.Database, boardID int, min models.ProjectRole) (int, bool) {
+	projectID, _, ok := authorize(c, db, boardLookup, boardID, "Board not found", min)
+	return projectID, ok
+}
+
+func authorizeTask(c *gin.Context, db *database.Database, taskID int, min models.ProjectRole) (int, bool) {
+	projectID, _, ok := authorize(c, db, taskLookup, taskID, "Task not found", min)
+	return projectID, ok
+}
+
+func authorizeLabel(c *gin.Context, db *database.Database, labelID int, min models.ProjectRole) (int, bool) {
+	projectID, _, ok := authorize(c, db, labelLookup, labelID, "Label not found", min)
+	return projectID, ok
+}
+
+func authorizeComment(c *gin.Context, db *database.Database, commentID int, min models.ProjectRole) (int, models.ProjectRole, bool) {
+	return authorize(c, db, commentLookup, commentID, "Comment not found", min)
+}
+
+func authorizeAttachment(c *gin.Context, db *database.Database, attachmentID int, min models.ProjectRole) (int, bool) {
+	projectID, _, ok := authorize(c, db, attachmentLookup, attachmentID, "Attachment not found", min)
+	return projectID, ok
+}
+
+func authorizeChecklistItem(c *gin.Context, db *database.Database, itemID int, min models.ProjectRole) (int, bool) {
+	projectID, _, ok := authorize(c, db, checklistLookup, itemID, "Checklist item not found", min)
+	return projectID, ok
+}
+
+func authorizeCustomField(c *gin.Context, db *database.Database, fieldID int, min models.ProjectRole) (int, bool) {
+	projectID, _, ok := authorize(c, db, customFieldLookup, fieldID, "Custom field not found", min)
+	return projectID, ok
+}
+
+func authorizeStatus(c *gin.Context, db *database.Database, statusID int, min models.ProjectRole) (int, bool) {
+	projectID, _, ok := authorize(c, db, statusLookup, statusID, "Status not found", min)
+	return projectID, ok
+}
+
+func authorizePriority(c *gin.Context, db *database.Database, priorityID int, min models.ProjectRole) (int, bool) {
+	projectID, _, ok := authorize(c, db, priorityLookup, priorityID, "Priority not found", min)
+	return projectID, ok
+}
+
+func authorizeTimeEntry(c *gin.Context, db *database.Database, entryID int, min models.ProjectRole) (int, models.ProjectRole, bool) {
+	return authorize(c, db, timeEntryLookup, entryID, "Time entry not found", min)
+}
+
+func authorizeDependency(c *gin.Context, db *database.Database, dependencyID int, min models.ProjectRole) (int, bool) {
+	projectID, _, ok := authorize(c, db, dependencyLookup, dependencyID, "Dependency not found", min)
+	return projectID, ok
+}
+
+// tokenProject returns the project the request's personal access token is
+// restricted to, if any.
+func tokenProject(c *gin.Context) (int, bool) {
+	projectID, ok := c.Get("tokenProjectID")
+	if !ok {
+		return 0, false
+	}
+	return projectID.(int), true
+}
+
+// isProjectMember reports whether userID belongs to the project. It is used
+// to validate task assignees.
+func isProjectMember(ctx context.Context, q querier, projectID, userID int) (bool, error) {
+	var exists bool
+	err := q.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM project_members WHERE project_id = $1 AND user_id = $2)",
+		projectID, userID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mochammadshenna/4me-backend/internal/mailer"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/utils"
+)
+
+// Purposes of the single-use tokens stored in user_tokens
+const (
+	tokenPurposePasswordReset     = "password_reset"
+	tokenPurposeEmailVerification = "email_verification"
+	tokenPurposeEmailChange       = "email_change"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+
+	// reauthWindow is how recently users without a password must have
+	// signed in to change their credentials
+	reauthWindow = 5 * time.Minute
+)
+
+// ForgotPassword emails a password reset link. It responds the same way
+// whether or not the address belongs to an account.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Limit the reset emails sent to one address
+	if !h.limiter.Account(c, "forgot:"+req.Email) {
+		return
+	}
+
+	ctx := context.Background()
+	var userID int
+	var email string
+	err := h.db.Pool.QueryRow(ctx,
+		"SELECT id, email FROM users WHERE LOWER(email) = LOWER($1)",
+		req.Email).Scan(&userID, &email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err == nil {
+		token, err := issueUserToken(ctx, h.db.Pool, userID, tokenPurposePasswordReset, email, passwordResetTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+			return
+		}
+
+		link := h.config.FrontendURL + "/reset-password?token=" + url.QueryEscape(token)
+		err = h.mailer.Send(ctx, mailer.Message{
+			To:      []string{email},
+			Subject: "Reset your 4me password",
+			Body: fmt.Sprintf("Someone asked to reset the password of your 4me account.\n\n"+
+				"Choose a new password here:\n%s\n\n"+
+				"The link expires in one hour. If you didn't ask for this, you can ignore this email.\n",
+				link),
+		})
+		if err != nil {
+			log.Printf("Failed to send password reset to user %d: %v", userID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account uses that email address, a reset link has been sent to it"})
+}
+
+// ResetPassword sets a new password using the token from a reset email and
+// signs the user out everywhere.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	userID, email, err := redeemUserToken(ctx, tx, tokenPurposePasswordReset, req.Token)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Receiving the reset email proves the address, unless it has changed
+	// since
+	_, err = tx.Exec(ctx,
+		`UPDATE users SET password_hash = $2,
+		        email_verified_at = CASE WHEN LOWER(email) = LOWER($3)
+		                                 THEN COALESCE(email_verified_at, NOW())
+		                                 ELSE email_verified_at END
+		 WHERE id = $1`,
+		userID, passwordHash, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if _, err := h.sessions.RevokeAll(ctx, userID); err != nil {
+		log.Printf("Failed to revoke sessions of user %d: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset; please sign in"})
+}
+
+// VerifyEmail redeems a verification token. When the token was issued for a
+// new address, the address is changed as well.
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Links verifying the current address and confirming a new one share
+	// the page, but not the purpose
+	purpose := tokenPurposeEmailVerification
+	userID, email, err := redeemUserToken(ctx, tx, purpose, req.Token)
+	if errors.Is(err, pgx.ErrNoRows) {
+		purpose = tokenPurposeEmailChange
+		userID, email, err = redeemUserToken(ctx, tx, purpose, req.Token)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var user models.User
+	err = tx.QueryRow(ctx,
+		`UPDATE users SET email = $2, email_verified_at = NOW()
+		 WHERE id = $1
+		 RETURNING id, username, email, avatar_url, email_verified_at, totp_enabled_at IS NOT NULL, created_at, updated_at`,
+		userID, email).
+		Scan(userScanDest(&user)...)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	// Verification links for the previous address must not change it back
+	if purpose == tokenPurposeEmailChange {
+		_, err = tx.Exec(ctx,
+			`UPDATE user_tokens SET used_at = NOW()
+			 WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+			userID, tokenPurposeEmailVerification)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+	}
+
+	if err = joinInvitedProjects(ctx, tx, user.ID, user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitations"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ResendVerification emails a new verification link for the current
+// address.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	ctx := context.Background()
+
+	var email string
+	var verified bool
+	err := h.db.Pool.QueryRow(ctx,
+		"SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = $1",
+		userID).Scan(&email, &verified)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if verified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email address is already verified"})
+		return
+	}
+
+	if err := h.sendVerification(ctx, userID.(int), tokenPurposeEmailVerification, email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create verification token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// ChangePassword sets a new password and signs out every other session.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	sessionID, _ := c.Get("sessionID")
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	if !h.checkCurrentPassword(c, userID.(int), req.CurrentPassword) {
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE users SET password_hash = $2 WHERE id = $1", userID, passwordHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// Reset links sent before the change must not undo it
+	_, err = tx.Exec(ctx,
+		`UPDATE user_tokens SET used_at = NOW()
+		 WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		userID, tokenPurposePasswordReset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if _, err := h.sessions.RevokeOthers(ctx, userID.(int), sessionID.(int)); err != nil {
+		log.Printf("Failed to revoke sessions of user %d: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// ChangeEmail emails a verification link to a new address. The address
+// only changes once the link is opened.
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	if !h.checkCurrentPassword(c, userID.(int), req.CurrentPassword) {
+		return
+	}
+
+	var exists bool
+	err := h.db.Pool.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))",
+		req.Email).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+		return
+	}
+
+	if err := h.sendVerification(ctx, userID.(int), tokenPurposeEmailChange, req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create verification token"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Open the link sent to " + req.Email + " to confirm the change"})
+}
+
+// checkCurrentPassword verifies the user's password before a credential
+// change and writes the error response if it does not match. Users without
+// a password, who sign in only through OAuth, must have signed in within
+// reauthWindow instead.
+func (h *AuthHandler) checkCurrentPassword(c *gin.Context, userID int, password string) bool {
+	sessionID, _ := c.Get("sessionID")
+
+	var passwordHash string
+	var recentLogin bool
+	err := h.db.Pool.QueryRow(context.Background(),
+		`SELECT u.password_hash,
+		        EXISTS(SELECT 1 FROM sessions s
+		               WHERE s.id = $2 AND s.user_id = u.id AND s.revoked_at IS NULL
+		                 AND s.created_at > NOW() - make_interval(secs => $3))
+		 FROM users u WHERE u.id = $1`,
+		userID, sessionID, reauthWindow.Seconds()).Scan(&passwordHash, &recentLogin)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return false
+	}
+
+	if passwordHash == "" {
+		if !recentLogin {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Sign in again with your provider to confirm this change",
+				"code":  models.ErrorCodeReauthRequired,
+			})
+			return false
+		}
+		return true
+	}
+
+	if !utils.CheckPassword(password, passwordHash) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		return false
+	}
+
+	return true
+}
+
+// sendVerification emails a link that verifies email for the user, with a
+// token for purpose: verifying the current address or confirming a new one.
+// Mail delivery errors are logged rather than returned.
+func (h *AuthHandler) sendVerification(ctx context.Context, userID int, purpose, email string) error {
+	token, err := issueUserToken(ctx, h.db.Pool, userID, purpose, email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := h.config.FrontendURL + "/verify-email?token=" + url.QueryEscape(token)
+	err = h.mailer.Send(ctx, mailer.Message{
+		To:      []string{email},
+		Subject: "Verify your email address for 4me",
+		Body: fmt.Sprintf("Confirm that this is your email address by opening this link:\n%s\n\n"+
+			"The link expires in 48 hours. If you didn't sign up for 4me or change your email address, you can ignore this email.\n",
+			link),
+	})
+	if err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", userID, err)
+	}
+
+	return nil
+}
+
+// issueUserToken creates a single-use token for purpose and returns it. Only
+// its hash is stored, and earlier unused tokens of the user for the same
+// purpose stop working.
+func issueUserToken(ctx context.Context, q querier, userID int, purpose, email string, ttl time.Duration) (string, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = q.Exec(ctx,
+		`UPDATE user_tokens SET used_at = NOW()
+		 WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		userID, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = q.Exec(ctx,
+		`INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		userID, purpose, utils.HashToken(token), email, time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// redeemUserToken marks an unused, unexpired token as used and returns the
+// user and email address it was issued for. It returns pgx.ErrNoRows for
+// unknown, used or expired tokens.
+func redeemUserToken(ctx context.Context, q querier, purpose, token string) (int, string, error) {
+	var userID int
+	var email string
+	err := q.QueryRow(ctx,
+		`UPDATE user_tokens SET used_at = NOW()
+		 WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id, email`,
+		utils.HashToken(token), purpose).Scan(&userID, &email)
+	return userID, email, err
+}
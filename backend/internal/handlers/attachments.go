@@ -5,17 +5,26 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"github.com/mochammadshenna/4me-backend/internal/config"
 	"github.com/mochammadshenna/4me-backend/internal/database"
 	"github.com/mochammadshenna/4me-backend/internal/models"
 )
 
+// attachmentBucket is the Supabase Storage bucket holding attachments.
+const attachmentBucket = "4me-attachments"
+
+// storageClient talks to Supabase Storage. The timeout bounds how long an
+// upload can take.
+var storageClient = &http.Client{Timeout: 5 * time.Minute}
+
 type AttachmentHandler struct {
 	db     *database.Database
 	config *config.Config
@@ -36,18 +45,7 @@ func (h *AttachmentHandler) Upload(c *gin.Context) {
 		return
 	}
 
-	// Verify task ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT EXISTS(
-			SELECT 1 FROM tasks t 
-			JOIN boards b ON t.board_id = b.id 
-			JOIN projects p ON b.project_id = p.id 
-			WHERE t.id = $1 AND p.user_id = $2
-		)`,
-		taskID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleEditor); !ok {
 		return
 	}
 
@@ -58,31 +56,83 @@ func (h *AttachmentHandler) Upload(c *gin.Context) {
 	}
 	defer file.Close()
 
+	ctx := context.Background()
+
+	// Reject uploads over the quota before sending them to storage. The
+	// check is repeated once the file is stored, since no lock is held
+	// during the upload.
+	if !h.checkQuota(c, ctx, userID.(int), header.Size, nil) {
+		return
+	}
+
 	// Upload to Supabase Storage
-	fileURL, err := h.uploadToSupabase(file, header, taskID)
+	object, err := h.uploadToSupabase(c.Request.Context(), file, header, taskID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file: " + err.Error()})
 		return
 	}
 
-	// Save attachment record
-	var attachment models.Attachment
-	err = h.db.Pool.QueryRow(context.Background(),
-		`INSERT INTO attachments (task_id, filename, file_url, file_type, size) 
-		 VALUES ($1, $2, $3, $4, $5) 
-		 RETURNING id, task_id, filename, file_url, file_type, size, uploaded_at`,
-		taskID, header.Filename, fileURL, header.Header.Get("Content-Type"), header.Size).
-		Scan(&attachment.ID, &attachment.TaskID, &attachment.Filename, &attachment.FileURL, &attachment.FileType, &attachment.Size, &attachment.UploadedAt)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+	attachment, ok := h.save(c, ctx, userID.(int), taskID, header, object)
+	if !ok {
+		// Don't leave the file behind when the attachment was refused
+		if err := h.deleteFromSupabase(ctx, object); err != nil {
+			log.Printf("Failed to delete unsaved attachment %s: %v", object, err)
+		}
 		return
 	}
 
 	c.JSON(http.StatusCreated, attachment)
 }
 
-func (h *AttachmentHandler) uploadToSupabase(file multipart.File, header *multipart.FileHeader, taskID int) (string, error) {
+// checkQuota checks the attachment quota in a short transaction and, if
+// save is given, calls it before committing while the user is still
+// locked, so concurrent uploads are counted one after another.
+func (h *AttachmentHandler) checkQuota(c *gin.Context, ctx context.Context, userID int, size int64, save func(tx pgx.Tx) bool) bool {
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return false
+	}
+	defer tx.Rollback(ctx)
+
+	if !checkAttachmentQuota(c, ctx, tx, userID, size, h.config.MaxAttachmentBytesPerUser) {
+		return false
+	}
+	if save == nil {
+		return true
+	}
+	if !save(tx) {
+		return false
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return false
+	}
+	return true
+}
+
+// save records an uploaded file if it still fits in the user's quota.
+func (h *AttachmentHandler) save(c *gin.Context, ctx context.Context, userID, taskID int, header *multipart.FileHeader, object string) (models.Attachment, bool) {
+	var attachment models.Attachment
+	ok := h.checkQuota(c, ctx, userID, header.Size, func(tx pgx.Tx) bool {
+		err := tx.QueryRow(ctx,
+			`INSERT INTO attachments (task_id, filename, file_url, file_type, size, uploaded_by) 
+			 VALUES ($1, $2, $3, $4, $5, $6) 
+			 RETURNING id, task_id, filename, file_url, file_type, size, uploaded_by, uploaded_at`,
+			taskID, header.Filename, h.publicURL(object), header.Header.Get("Content-Type"), header.Size, userID).
+			Scan(&attachment.ID, &attachment.TaskID, &attachment.Filename, &attachment.FileURL, &attachment.FileType, &attachment.Size, &attachment.UploadedBy, &attachment.UploadedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+			return false
+		}
+		return true
+	})
+	return attachment, ok
+}
+
+// uploadToSupabase stores a file and returns its object path in the bucket.
+func (h *AttachmentHandler) uploadToSupabase(ctx context.Context, file multipart.File, header *multipart.FileHeader, taskID int) (string, error) {
 	// Read file content
 	fileBytes, err := io.ReadAll(file)
 	if err != nil {
@@ -90,12 +140,12 @@ func (h *AttachmentHandler) uploadToSupabase(file multipart.File, header *multip
 	}
 
 	// Generate unique filename
-	filename := fmt.Sprintf("tasks/%d/%d-%s", taskID, time.Now().Unix(), header.Filename)
+	object := fmt.Sprintf("tasks/%d/%d-%s", taskID, time.Now().Unix(), header.Filename)
 
 	// Upload to Supabase Storage
-	url := fmt.Sprintf("%s/storage/v1/object/4me-attachments/%s", h.config.SupabaseURL, filename)
+	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", h.config.SupabaseURL, attachmentBucket, object)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(fileBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(fileBytes))
 	if err != nil {
 		return "", err
 	}
@@ -103,8 +153,7 @@ func (h *AttachmentHandler) uploadToSupabase(file multipart.File, header *multip
 	req.Header.Set("Authorization", "Bearer "+h.config.SupabaseKey)
 	req.Header.Set("Content-Type", header.Header.Get("Content-Type"))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := storageClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -115,36 +164,50 @@ func (h *AttachmentHandler) uploadToSupabase(file multipart.File, header *multip
 		return "", fmt.Errorf("supabase upload failed: %s", string(body))
 	}
 
-	// Return public URL
-	publicURL := fmt.Sprintf("%s/storage/v1/object/public/4me-attachments/%s", h.config.SupabaseURL, filename)
-	return publicURL, nil
+	return object, nil
+}
+
+// deleteFromSupabase removes an object from the bucket.
+func (h *AttachmentHandler) deleteFromSupabase(ctx context.Context, object string) error {
+	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", h.config.SupabaseURL, attachmentBucket, object)
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+h.config.SupabaseKey)
+
+	resp, err := storageClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("supabase delete failed: %s", string(body))
+	}
+	return nil
+}
+
+// publicURL returns the public URL of an object in the bucket.
+func (h *AttachmentHandler) publicURL(object string) string {
+	return fmt.Sprintf("%s/storage/v1/object/public/%s/%s", h.config.SupabaseURL, attachmentBucket, object)
 }
 
 func (h *AttachmentHandler) List(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	taskID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
 		return
 	}
 
-	// Verify task ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT EXISTS(
-			SELECT 1 FROM tasks t 
-			JOIN boards b ON t.board_id = b.id 
-			JOIN projects p ON b.project_id = p.id 
-			WHERE t.id = $1 AND p.user_id = $2
-		)`,
-		taskID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleViewer); !ok {
 		return
 	}
 
 	rows, err := h.db.Pool.Query(context.Background(),
-		`SELECT id, task_id, filename, file_url, file_type, size, uploaded_at 
+		`SELECT id, task_id, filename, file_url, file_type, size, uploaded_by, uploaded_at 
 		 FROM attachments WHERE task_id = $1 ORDER BY uploaded_at DESC`,
 		taskID)
 	if err != nil {
@@ -156,7 +219,7 @@ func (h *AttachmentHandler) List(c *gin.Context) {
 	attachments := []models.Attachment{}
 	for rows.Next() {
 		var attachment models.Attachment
-		if err := rows.Scan(&attachment.ID, &attachment.TaskID, &attachment.Filename, &attachment.FileURL, &attachment.FileType, &attachment.Size, &attachment.UploadedAt); err != nil {
+		if err := rows.Scan(&attachment.ID, &attachment.TaskID, &attachment.Filename, &attachment.FileURL, &attachment.FileType, &attachment.Size, &attachment.UploadedBy, &attachment.UploadedAt); err != nil {
 			continue
 		}
 		attachments = append(attachments, attachment)
@@ -166,24 +229,22 @@ func (h *AttachmentHandler) List(c *gin.Context) {
 }
 
 func (h *AttachmentHandler) Delete(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	attachmentID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
 		return
 	}
 
-	// Get attachment details and verify ownership
+	if _, ok := authorizeAttachment(c, h.db, attachmentID, models.RoleEditor); !ok {
+		return
+	}
+
+	// Get attachment details
 	var fileURL string
 	var taskID int
 	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT a.file_url, a.task_id 
-		 FROM attachments a
-		 JOIN tasks t ON a.task_id = t.id 
-		 JOIN boards b ON t.board_id = b.id 
-		 JOIN projects p ON b.project_id = p.id 
-		 WHERE a.id = $1 AND p.user_id = $2`,
-		attachmentID, userID).Scan(&fileURL, &taskID)
+		"SELECT file_url, task_id FROM attachments WHERE id = $1",
+		attachmentID).Scan(&fileURL, &taskID)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
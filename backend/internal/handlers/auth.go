@@ -2,41 +2,47 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"io"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/auth"
 	"github.com/mochammadshenna/4me-backend/internal/config"
 	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/jwks"
+	"github.com/mochammadshenna/4me-backend/internal/mailer"
 	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/oauth"
+	"github.com/mochammadshenna/4me-backend/internal/ratelimit"
 	"github.com/mochammadshenna/4me-backend/internal/utils"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
+// userColumns is scanned by userScanDest. Queries using it must alias users
+// as "u".
+const userColumns = "u.id, u.username, u.email, u.avatar_url, u.email_verified_at, u.totp_enabled_at IS NOT NULL, u.created_at, u.updated_at"
+
 type AuthHandler struct {
-	db     *database.Database
-	config *config.Config
-	oauth  *oauth2.Config
+	db        *database.Database
+	config    *config.Config
+	providers *oauth.Registry
+	sessions  *auth.Sessions
+	mailer    mailer.Sender
+	limiter   *ratelimit.Limiter
+	keys      *jwks.KeySet
 }
 
-func NewAuthHandler(db *database.Database, cfg *config.Config) *AuthHandler {
-	oauthConfig := &oauth2.Config{
-		ClientID:     cfg.GoogleClientID,
-		ClientSecret: cfg.GoogleClientSecret,
-		RedirectURL:  cfg.GoogleRedirectURL,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
-	}
-
+func NewAuthHandler(db *database.Database, cfg *config.Config, providers *oauth.Registry, sessions *auth.Sessions, mail mailer.Sender, limiter *ratelimit.Limiter, keys *jwks.KeySet) *AuthHandler {
 	return &AuthHandler{
-		db:     db,
-		config: cfg,
-		oauth:  oauthConfig,
+		db:        db,
+		config:    cfg,
+		providers: providers,
+		sessions:  sessions,
+		mailer:    mail,
+		limiter:   limiter,
+		keys:      keys,
 	}
 }
 
@@ -73,33 +79,35 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	err = h.db.Pool.QueryRow(context.Background(),
 		`INSERT INTO users (username, email, password_hash) 
 		 VALUES ($1, $2, $3) 
-		 RETURNING id, username, email, created_at, updated_at`,
+		 RETURNING id, username, email, avatar_url, email_verified_at, totp_enabled_at IS NOT NULL, created_at, updated_at`,
 		req.Username, req.Email, passwordHash).
-		Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+		Scan(userScanDest(&user)...)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	// Generate tokens
-	token, err := utils.GenerateToken(user.ID, user.Username, user.Email, h.config.JWTSecret)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
+	// Join the projects this email address was invited to, or wait until
+	// the address is verified
+	if !h.config.RequireVerifiedEmail {
+		if err := joinInvitedProjects(context.Background(), h.db.Pool, user.ID, user.Email); err != nil {
+			log.Printf("Failed to accept invitations for user %d: %v", user.ID, err)
+		}
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Username, user.Email, h.config.JWTSecret)
+	if err := h.sendVerification(context.Background(), user.ID, tokenPurposeEmailVerification, user.Email); err != nil {
+		log.Printf("Failed to create verification token for user %d: %v", user.ID, err)
+	}
+
+	// Generate tokens
+	resp, err := h.issueTokens(c, h.db.Pool, user, 0)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.AuthResponse{
-		Token:        token,
-		RefreshToken: refreshToken,
-		User:         user,
-	})
+	h.respondWithTokens(c, http.StatusCreated, resp)
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -109,128 +117,225 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Failed logins count against the username whether or not it exists, so
+	// lockouts don't reveal which accounts do
+	limitKey := "login:" + req.Username
+	if !h.limiter.Account(c, limitKey) {
+		return
+	}
+
 	// Get user
 	var user models.User
 	err := h.db.Pool.QueryRow(context.Background(),
-		`SELECT id, username, email, password_hash, google_id, avatar_url, created_at, updated_at 
-		 FROM users WHERE username = $1`,
+		`SELECT `+userColumns+`, u.password_hash
+		 FROM users u WHERE u.username = $1`,
 		req.Username).
-		Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.GoogleID, &user.AvatarURL, &user.CreatedAt, &user.UpdatedAt)
+		Scan(append(userScanDest(&user), &user.PasswordHash)...)
 
 	if err != nil {
+		h.limiter.Fail(c, limitKey)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	// Check password
 	if !utils.CheckPassword(req.Password, user.PasswordHash) {
+		h.limiter.Fail(c, limitKey)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// Generate tokens
-	token, err := utils.GenerateToken(user.ID, user.Username, user.Email, h.config.JWTSecret)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+	h.limiter.Succeed(c, limitKey)
+	user.PasswordHash = ""
+	h.signIn(c, user)
+}
+
+// signIn responds with a new token pair for user, or with an MFA pending
+// token when the user has two-factor authentication enabled.
+func (h *AuthHandler) signIn(c *gin.Context, user models.User) {
+	if user.TwoFactorEnabled {
+		token, err := utils.GenerateMFAPendingToken(user.ID, user.Username, user.Email, h.config.JWTSecret)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, models.MFAChallengeResponse{MFARequired: true, MFAToken: token})
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Username, user.Email, h.config.JWTSecret)
+	resp, err := h.issueTokens(c, h.db.Pool, user, 0)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	user.PasswordHash = ""
-	c.JSON(http.StatusOK, models.AuthResponse{
-		Token:        token,
-		RefreshToken: refreshToken,
-		User:         user,
-	})
+	h.respondWithTokens(c, http.StatusOK, resp)
 }
 
-func (h *AuthHandler) GoogleLogin(c *gin.Context) {
-	url := h.oauth.AuthCodeURL("state", oauth2.AccessTypeOffline)
-	c.JSON(http.StatusOK, gin.H{"url": url})
-}
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// can be used once; presenting one that was already used revokes the session
+// it belongs to.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !(h.config.CookieMode() && errors.Is(err, io.EOF)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RefreshToken == "" && h.config.CookieMode() {
+		req.RefreshToken, _ = c.Cookie(auth.RefreshCookie)
+	}
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
 
-func (h *AuthHandler) GoogleCallback(c *gin.Context) {
-	code := c.Query("code")
-	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Code not provided"})
+	if _, err := utils.ValidateRefreshToken(req.RefreshToken, h.config.JWTSecret); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
 		return
 	}
 
-	token, err := h.oauth.Exchange(context.Background(), code)
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to exchange token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
 		return
 	}
+	defer tx.Rollback(ctx)
 
-	client := h.oauth.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+	var tokenID, sessionID int
+	var used, revoked *time.Time
+	var user models.User
+	err = tx.QueryRow(ctx,
+		`SELECT r.id, r.session_id, r.used_at, s.revoked_at,
+		        `+userColumns+`
+		 FROM refresh_tokens r
+		 JOIN sessions s ON r.session_id = s.id
+		 JOIN users u ON r.user_id = u.id
+		 WHERE r.token_hash = $1 AND r.expires_at > NOW()
+		 FOR UPDATE OF r`,
+		utils.HashToken(req.RefreshToken)).
+		Scan(append([]interface{}{&tokenID, &sessionID, &used, &revoked}, userScanDest(&user)...)...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	if revoked != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return
+	}
+
+	if used != nil {
+		// A used token was replayed, so it may have been stolen
+		tx.Rollback(ctx)
+		if _, err := h.sessions.Revoke(ctx, user.ID, sessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used; please sign in again"})
 		return
 	}
-	defer resp.Body.Close()
 
-	data, err := io.ReadAll(resp.Body)
+	_, err = tx.Exec(ctx, "UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1", tokenID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read response"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate refresh token"})
 		return
 	}
 
-	var googleUser struct {
-		ID      string `json:"id"`
-		Email   string `json:"email"`
-		Name    string `json:"name"`
-		Picture string `json:"picture"`
+	resp, err := h.issueTokens(c, tx, user, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
 	}
 
-	if err := json.Unmarshal(data, &googleUser); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user info"})
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
-	// Check if user exists
-	var user models.User
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT id, username, email, google_id, avatar_url, created_at, updated_at 
-		 FROM users WHERE google_id = $1`,
-		googleUser.ID).
-		Scan(&user.ID, &user.Username, &user.Email, &user.GoogleID, &user.AvatarURL, &user.CreatedAt, &user.UpdatedAt)
+	if err := h.sessions.Touch(ctx, sessionID, c.ClientIP()); err != nil {
+		log.Printf("Failed to update session %d: %v", sessionID, err)
+	}
 
-	if err != nil {
-		// Create new user
-		err = h.db.Pool.QueryRow(context.Background(),
-			`INSERT INTO users (username, email, google_id, avatar_url) 
-			 VALUES ($1, $2, $3, $4) 
-			 RETURNING id, username, email, google_id, avatar_url, created_at, updated_at`,
-			googleUser.Name, googleUser.Email, googleUser.ID, googleUser.Picture).
-			Scan(&user.ID, &user.Username, &user.Email, &user.GoogleID, &user.AvatarURL, &user.CreatedAt, &user.UpdatedAt)
+	h.respondWithTokens(c, http.StatusOK, resp)
+}
 
+// respondWithTokens sends a new token pair in the response body, or in the
+// cookie auth mode sets it as cookies and sends the CSRF token instead.
+func (h *AuthHandler) respondWithTokens(c *gin.Context, status int, resp *models.AuthResponse) {
+	if h.config.CookieMode() {
+		csrf, err := auth.NewCookies(h.config).SetTokens(c.Writer, resp.Token, resp.RefreshToken)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate CSRF token"})
 			return
 		}
+		resp = &models.AuthResponse{CSRFToken: csrf, User: resp.User}
 	}
 
-	// Generate JWT tokens
-	jwtToken, err := utils.GenerateToken(user.ID, user.Username, user.Email, h.config.JWTSecret)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+	c.JSON(status, resp)
+}
+
+// CSRF returns the CSRF token of the cookie auth mode, setting a new one if
+// there is none. A frontend on another site cannot read the cookie and gets
+// the token here instead.
+func (h *AuthHandler) CSRF(c *gin.Context) {
+	if !h.config.CookieMode() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cookie authentication is not enabled"})
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Username, user.Email, h.config.JWTSecret)
+	csrf, err := c.Cookie(auth.CSRFCookie)
+	if err != nil || csrf == "" {
+		csrf, err = auth.NewCookies(h.config).SetCSRF(c.Writer)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate CSRF token"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"csrf_token": csrf})
+}
+
+// issueTokens creates an access token and a refresh token for user and stores
+// the refresh token's hash. A sessionID of 0 starts a new session for the
+// client making the request.
+func (h *AuthHandler) issueTokens(c *gin.Context, q querier, user models.User, sessionID int) (*models.AuthResponse, error) {
+	ctx := context.Background()
+	if sessionID == 0 {
+		var err error
+		sessionID, err = h.sessions.Create(ctx, user.ID, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := utils.GenerateToken(user.ID, sessionID, user.Username, user.Email, h.keys)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
-		return
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken(user.ID, sessionID, user.Username, user.Email, h.config.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = q.Exec(ctx,
+		`INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at)
+		 VALUES ($1, $2, $3, $4)`,
+		user.ID, sessionID, utils.HashToken(refreshToken), time.Now().Add(utils.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
 	}
 
-	// Redirect to frontend with tokens
-	c.Redirect(http.StatusTemporaryRedirect, h.config.FrontendURL+"/auth/callback?token="+jwtToken+"&refresh_token="+refreshToken)
+	return &models.AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
+}
+
+func userScanDest(u *models.User) []interface{} {
+	return []interface{}{&u.ID, &u.Username, &u.Email, &u.AvatarURL, &u.EmailVerifiedAt, &u.TwoFactorEnabled, &u.CreatedAt, &u.UpdatedAt}
 }
 
 func (h *AuthHandler) Me(c *gin.Context) {
@@ -242,16 +347,20 @@ func (h *AuthHandler) Me(c *gin.Context) {
 
 	var user models.User
 	err := h.db.Pool.QueryRow(context.Background(),
-		`SELECT id, username, email, google_id, avatar_url, created_at, updated_at 
-		 FROM users WHERE id = $1`,
+		`SELECT `+userColumns+` FROM users u WHERE u.id = $1`,
 		userID).
-		Scan(&user.ID, &user.Username, &user.Email, &user.GoogleID, &user.AvatarURL, &user.CreatedAt, &user.UpdatedAt)
+		Scan(userScanDest(&user)...)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
-}
+	invitations, err := pendingInvitations(context.Background(), h.db.Pool, user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
 
+	c.JSON(http.StatusOK, models.MeResponse{User: user, PendingInvitations: invitations})
+}
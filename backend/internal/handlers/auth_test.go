@@ -6,12 +6,20 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/auth"
 	"github.com/mochammadshenna/4me-backend/internal/config"
 	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/jwks"
+	"github.com/mochammadshenna/4me-backend/internal/mailer"
 	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/oauth"
+	"github.com/mochammadshenna/4me-backend/internal/ratelimit"
+	"github.com/mochammadshenna/4me-backend/internal/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,10 +45,18 @@ func setupTestRouter(handler *AuthHandler) *gin.Engine {
 
 	router.POST("/register", handler.Register)
 	router.POST("/login", handler.Login)
+	router.POST("/refresh", handler.Refresh)
 
 	return router
 }
 
+func testLimiter() *ratelimit.Limiter {
+	return ratelimit.New(ratelimit.NewMemoryStore(),
+		ratelimit.Limit{Requests: 100, Per: time.Minute},
+		ratelimit.Limit{Requests: 100, Per: time.Minute},
+		ratelimit.Lockout{MaxFailures: 5, Window: time.Minute, Duration: time.Minute})
+}
+
 func TestRegister(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -49,7 +65,7 @@ func TestRegister(t *testing.T) {
 		JWTSecret: "test-secret",
 	}
 
-	handler := NewAuthHandler(db, cfg)
+	handler := NewAuthHandler(db, cfg, oauth.NewRegistry(), auth.NewSessions(db), mailer.NewLogSender("test@localhost"), testLimiter(), jwks.NewHMAC(cfg.JWTSecret))
 	router := setupTestRouter(handler)
 
 	t.Run("successful registration", func(t *testing.T) {
@@ -118,7 +134,7 @@ func TestLogin(t *testing.T) {
 		JWTSecret: "test-secret",
 	}
 
-	handler := NewAuthHandler(db, cfg)
+	handler := NewAuthHandler(db, cfg, oauth.NewRegistry(), auth.NewSessions(db), mailer.NewLogSender("test@localhost"), testLimiter(), jwks.NewHMAC(cfg.JWTSecret))
 	router := setupTestRouter(handler)
 
 	// Register a user first
@@ -186,3 +202,214 @@ func TestLogin(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
 	})
 }
+
+func TestRefresh(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := &config.Config{
+		JWTSecret: "test-secret",
+	}
+
+	handler := NewAuthHandler(db, cfg, oauth.NewRegistry(), auth.NewSessions(db), mailer.NewLogSender("test@localhost"), testLimiter(), jwks.NewHMAC(cfg.JWTSecret))
+	router := setupTestRouter(handler)
+
+	registerReq := models.RegisterRequest{
+		Username: "refreshuser",
+		Email:    "refresh@example.com",
+		Password: "password123",
+	}
+	body, _ := json.Marshal(registerReq)
+	req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var registered models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &registered)
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.RefreshRequest{RefreshToken: token})
+		req := httptest.NewRequest("POST", "/refresh", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("access token is rejected", func(t *testing.T) {
+		w := refresh(registered.Token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("rotation and reuse detection", func(t *testing.T) {
+		w := refresh(registered.RefreshToken)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var rotated models.AuthResponse
+		json.Unmarshal(w.Body.Bytes(), &rotated)
+		assert.NotEmpty(t, rotated.Token)
+		assert.NotEqual(t, registered.RefreshToken, rotated.RefreshToken)
+
+		// Replaying the first token revokes the rotated one as well
+		w = refresh(registered.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = refresh(rotated.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestGoogleLoginState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		JWTSecret:         "test-secret",
+		GoogleClientID:    "client-id",
+		GoogleRedirectURL: "http://localhost:8080/api/auth/google/callback",
+	}
+
+	providers := oauth.NewRegistry(oauth.NewGoogle(cfg.GoogleClientID, "", cfg.GoogleRedirectURL))
+	handler := NewAuthHandler(nil, cfg, providers, nil, nil, nil, nil)
+	router := gin.New()
+	router.GET("/api/auth/google", handler.GoogleLogin)
+	router.GET("/api/auth/google/callback", handler.GoogleCallback)
+
+	req := httptest.NewRequest("GET", "/api/auth/google", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, "state", location.Query().Get("state"))
+	assert.Equal(t, "S256", location.Query().Get("code_challenge_method"))
+
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+
+	t.Run("missing cookie", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/auth/google/callback?code=x&state="+location.Query().Get("state"), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("mismatched state", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/auth/google/callback?code=x&state=forged", nil)
+		req.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestLinkIdentityTicket(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		JWTSecret:         "test-secret",
+		GoogleClientID:    "client-id",
+		GoogleRedirectURL: "http://localhost:8080/api/auth/google/callback",
+	}
+
+	var userID int
+	err := db.Pool.QueryRow(context.Background(),
+		"INSERT INTO users (username, email, password_hash) VALUES ('linker', 'linker@example.com', '') RETURNING id").
+		Scan(&userID)
+	assert.NoError(t, err)
+
+	providers := oauth.NewRegistry(oauth.NewGoogle(cfg.GoogleClientID, "", cfg.GoogleRedirectURL))
+	handler := NewAuthHandler(db, cfg, providers, nil, nil, nil, nil)
+	router := gin.New()
+	router.POST("/api/auth/identities/:provider", func(c *gin.Context) {
+		c.Set("userID", userID)
+		handler.LinkIdentity(c)
+	})
+	router.GET("/api/auth/oauth/:provider/link", handler.OAuthLink)
+
+	// The link is built from the configured callback, not the request
+	req := httptest.NewRequest("POST", "/api/auth/identities/google", nil)
+	req.Host = "attacker.example.com"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+
+	var resp struct {
+		URL string `json:"url"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	link, err := url.Parse(resp.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "http", link.Scheme)
+	assert.Equal(t, "localhost:8080", link.Host)
+	assert.Equal(t, "/api/auth/oauth/google/link", link.Path)
+
+	// Opening the link sets the state cookie and redirects to the provider
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", link.RequestURI(), nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Len(t, w.Result().Cookies(), 1)
+
+	// Each ticket works once
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", link.RequestURI(), nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestConfirmLink(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	var linkerID, otherID int
+	err := db.Pool.QueryRow(ctx,
+		"INSERT INTO users (username, email, password_hash) VALUES ('linker', 'linker@example.com', '') RETURNING id").
+		Scan(&linkerID)
+	assert.NoError(t, err)
+	err = db.Pool.QueryRow(ctx,
+		"INSERT INTO users (username, email, password_hash) VALUES ('other', 'other@example.com', '') RETURNING id").
+		Scan(&otherID)
+	assert.NoError(t, err)
+
+	// A callback for a ticket that linker started
+	_, err = db.Pool.Exec(ctx,
+		`INSERT INTO oauth_link_confirmations (user_id, provider, subject, email, email_verified, code_hash, expires_at)
+		 VALUES ($1, 'google', 'google-subject', 'victim@example.com', TRUE, $2, $3)`,
+		linkerID, utils.HashToken("link-code"), time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+
+	handler := NewAuthHandler(db, &config.Config{JWTSecret: "test-secret"}, oauth.NewRegistry(), nil, nil, nil, nil)
+	confirm := func(userID int) int {
+		router := gin.New()
+		router.POST("/api/auth/link/confirm", func(c *gin.Context) {
+			c.Set("userID", userID)
+			handler.ConfirmLink(c)
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/api/auth/link/confirm",
+			bytes.NewBufferString(`{"code":"link-code"}`)))
+		return w.Code
+	}
+
+	// Only the user who started linking can confirm it
+	assert.Equal(t, http.StatusBadRequest, confirm(otherID))
+	assert.Equal(t, http.StatusOK, confirm(linkerID))
+
+	var owner int
+	err = db.Pool.QueryRow(ctx,
+		"SELECT user_id FROM user_identities WHERE provider = 'google' AND subject = 'google-subject'").Scan(&owner)
+	assert.NoError(t, err)
+	assert.Equal(t, linkerID, owner)
+
+	// Each code works once
+	assert.Equal(t, http.StatusBadRequest, confirm(linkerID))
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/mochammadshenna/4me-backend/internal/models"
 )
 
+const boardColumns = "id, project_id, name, position, status_id, created_at, updated_at"
+
 type BoardHandler struct {
 	db *database.Database
 }
@@ -19,20 +21,13 @@ func NewBoardHandler(db *database.Database) *BoardHandler {
 }
 
 func (h *BoardHandler) Create(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	projectID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
 		return
 	}
 
-	// Verify project ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		"SELECT EXISTS(SELECT 1 FROM projects WHERE id = $1 AND user_id = $2)",
-		projectID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleEditor); !ok {
 		return
 	}
 
@@ -42,13 +37,18 @@ func (h *BoardHandler) Create(c *gin.Context) {
 		return
 	}
 
+	ctx := context.Background()
+	if req.StatusID != nil && !checkBoardStatus(c, ctx, h.db, projectID, *req.StatusID) {
+		return
+	}
+
 	var board models.Board
-	err = h.db.Pool.QueryRow(context.Background(),
-		`INSERT INTO boards (project_id, name, position) 
-		 VALUES ($1, $2, $3) 
-		 RETURNING id, project_id, name, position, created_at, updated_at`,
-		projectID, req.Name, req.Position).
-		Scan(&board.ID, &board.ProjectID, &board.Name, &board.Position, &board.CreatedAt, &board.UpdatedAt)
+	err = h.db.Pool.QueryRow(ctx,
+		`INSERT INTO boards (project_id, name, position, status_id) 
+		 VALUES ($1, $2, $3, $4) 
+		 RETURNING `+boardColumns,
+		projectID, req.Name, req.Position, req.StatusID).
+		Scan(boardScanDest(&board)...)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create board"})
@@ -59,25 +59,18 @@ func (h *BoardHandler) Create(c *gin.Context) {
 }
 
 func (h *BoardHandler) List(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	projectID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
 		return
 	}
 
-	// Verify project ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		"SELECT EXISTS(SELECT 1 FROM projects WHERE id = $1 AND user_id = $2)",
-		projectID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleViewer); !ok {
 		return
 	}
 
 	rows, err := h.db.Pool.Query(context.Background(),
-		`SELECT id, project_id, name, position, created_at, updated_at 
+		`SELECT `+boardColumns+` 
 		 FROM boards WHERE project_id = $1 ORDER BY position ASC`,
 		projectID)
 	if err != nil {
@@ -89,7 +82,7 @@ func (h *BoardHandler) List(c *gin.Context) {
 	boards := []models.Board{}
 	for rows.Next() {
 		var board models.Board
-		if err := rows.Scan(&board.ID, &board.ProjectID, &board.Name, &board.Position, &board.CreatedAt, &board.UpdatedAt); err != nil {
+		if err := rows.Scan(boardScanDest(&board)...); err != nil {
 			continue
 		}
 		boards = append(boards, board)
@@ -99,24 +92,14 @@ func (h *BoardHandler) List(c *gin.Context) {
 }
 
 func (h *BoardHandler) Update(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	boardID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID"})
 		return
 	}
 
-	// Verify board ownership through project
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT EXISTS(
-			SELECT 1 FROM boards b 
-			JOIN projects p ON b.project_id = p.id 
-			WHERE b.id = $1 AND p.user_id = $2
-		)`,
-		boardID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found"})
+	projectID, ok := authorizeBoard(c, h.db, boardID, models.RoleEditor)
+	if !ok {
 		return
 	}
 
@@ -140,15 +123,28 @@ func (h *BoardHandler) Update(c *gin.Context) {
 		args = append(args, *req.Position)
 		argCount++
 	}
+	ctx := context.Background()
+	if req.StatusID != nil {
+		var statusID *int
+		if *req.StatusID != 0 {
+			if !checkBoardStatus(c, ctx, h.db, projectID, *req.StatusID) {
+				return
+			}
+			statusID = req.StatusID
+		}
+		query += ", status_id = $" + strconv.Itoa(argCount)
+		args = append(args, statusID)
+		argCount++
+	}
 
 	query += " WHERE id = $" + strconv.Itoa(argCount)
 	args = append(args, boardID)
 
-	query += " RETURNING id, project_id, name, position, created_at, updated_at"
+	query += " RETURNING " + boardColumns
 
 	var board models.Board
-	err = h.db.Pool.QueryRow(context.Background(), query, args...).
-		Scan(&board.ID, &board.ProjectID, &board.Name, &board.Position, &board.CreatedAt, &board.UpdatedAt)
+	err = h.db.Pool.QueryRow(ctx, query, args...).
+		Scan(boardScanDest(&board)...)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update board"})
@@ -159,19 +155,20 @@ func (h *BoardHandler) Update(c *gin.Context) {
 }
 
 func (h *BoardHandler) Delete(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	boardID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID"})
 		return
 	}
 
+	// Deleting a board deletes its tasks, so it is reserved for admins
+	if _, ok := authorizeBoard(c, h.db, boardID, models.RoleAdmin); !ok {
+		return
+	}
+
 	result, err := h.db.Pool.Exec(context.Background(),
-		`DELETE FROM boards 
-		 WHERE id = $1 AND project_id IN (
-			 SELECT id FROM projects WHERE user_id = $2
-		 )`,
-		boardID, userID)
+		"DELETE FROM boards WHERE id = $1",
+		boardID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete board"})
@@ -186,3 +183,25 @@ func (h *BoardHandler) Delete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Board deleted successfully"})
 }
 
+// checkBoardStatus checks that a status a board is mapped to belongs to the
+// board's project, writing a 400 response when it doesn't.
+func checkBoardStatus(c *gin.Context, ctx context.Context, db *database.Database, projectID, statusID int) bool {
+	var exists bool
+	err := db.Pool.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM project_statuses WHERE id = $1 AND project_id = $2)",
+		statusID, projectID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status not found in this project"})
+		return false
+	}
+	return true
+}
+
+// boardScanDest returns the scan destinations matching boardColumns.
+func boardScanDest(board *models.Board) []interface{} {
+	return []interface{}{&board.ID, &board.ProjectID, &board.Name, &board.Position, &board.StatusID, &board.CreatedAt, &board.UpdatedAt}
+}
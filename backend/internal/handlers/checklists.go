@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+const checklistColumns = "id, task_id, text, done, position, created_at, updated_at"
+
+// ChecklistHandler manages the checklist items of tasks. Every change is
+// recorded in the task's history.
+type ChecklistHandler struct {
+	db *database.Database
+}
+
+func NewChecklistHandler(db *database.Database) *ChecklistHandler {
+	return &ChecklistHandler{db: db}
+}
+
+// Create adds an item to the end of a task's checklist.
+func (h *ChecklistHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleEditor); !ok {
+		return
+	}
+
+	var req models.CreateChecklistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var item models.ChecklistItem
+	err = tx.QueryRow(ctx,
+		`INSERT INTO checklist_items (task_id, text, done, position) 
+		 VALUES ($1, $2, $3, (SELECT COALESCE(MAX(position) + 1, 0) FROM checklist_items WHERE task_id = $1)) 
+		 RETURNING `+checklistColumns,
+		taskID, req.Text, req.Done).
+		Scan(checklistScanDest(&item)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create checklist item"})
+		return
+	}
+
+	addTaskHistory(ctx, tx, taskID, userID, "checklist_item_added", map[string]interface{}{
+		"item_id": item.ID,
+		"text":    item.Text,
+	})
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, item)
+}
+
+func (h *ChecklistHandler) List(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleViewer); !ok {
+		return
+	}
+
+	items, err := loadChecklist(context.Background(), h.db.Pool, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checklist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// Update changes the text of an item or checks it off.
+func (h *ChecklistHandler) Update(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	itemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid checklist item ID"})
+		return
+	}
+
+	if _, ok := authorizeChecklistItem(c, h.db, itemID, models.RoleEditor); !ok {
+		return
+	}
+
+	var req models.UpdateChecklistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var item models.ChecklistItem
+	err = tx.QueryRow(ctx,
+		`UPDATE checklist_items SET text = COALESCE($1, text), done = COALESCE($2, done) 
+		 WHERE id = $3 
+		 RETURNING `+checklistColumns,
+		req.Text, req.Done, itemID).
+		Scan(checklistScanDest(&item)...)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Checklist item not found"})
+		return
+	}
+
+	changes := map[string]interface{}{"item_id": item.ID}
+	if req.Text != nil {
+		changes["text"] = *req.Text
+	}
+	if req.Done != nil {
+		changes["done"] = *req.Done
+	}
+	if len(changes) > 1 {
+		addTaskHistory(ctx, tx, item.TaskID, userID, "checklist_item_updated", changes)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+func (h *ChecklistHandler) Delete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	itemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid checklist item ID"})
+		return
+	}
+
+	if _, ok := authorizeChecklistItem(c, h.db, itemID, models.RoleEditor); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var taskID int
+	var text string
+	err = tx.QueryRow(ctx,
+		"DELETE FROM checklist_items WHERE id = $1 RETURNING task_id, text",
+		itemID).Scan(&taskID, &text)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Checklist item not found"})
+		return
+	}
+
+	addTaskHistory(ctx, tx, taskID, userID, "checklist_item_removed", map[string]interface{}{
+		"item_id": itemID,
+		"text":    text,
+	})
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Checklist item deleted successfully"})
+}
+
+// Reorder puts a task's checklist in the order of the given IDs, which must
+// list every item once.
+func (h *ChecklistHandler) Reorder(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleEditor); !ok {
+		return
+	}
+
+	var req models.ReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if !reorder(c, ctx, tx, "checklist_items", "position", "task_id", taskID, req.IDs) {
+		return
+	}
+
+	addTaskHistory(ctx, tx, taskID, userID, "checklist_reordered", map[string]interface{}{
+		"item_ids": req.IDs,
+	})
+
+	items, err := loadChecklist(ctx, tx, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checklist"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// loadChecklist returns the checklist items of a task in their order.
+func loadChecklist(ctx context.Context, q querier, taskID int) ([]models.ChecklistItem, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+checklistColumns+` FROM checklist_items 
+		 WHERE task_id = $1 ORDER BY position ASC, id ASC`,
+		taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.ChecklistItem{}
+	for rows.Next() {
+		var item models.ChecklistItem
+		if err := rows.Scan(checklistScanDest(&item)...); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// checklistScanDest returns the scan destinations matching checklistColumns.
+func checklistScanDest(item *models.ChecklistItem) []interface{} {
+	return []interface{}{&item.ID, &item.TaskID, &item.Text, &item.Done, &item.Position, &item.CreatedAt, &item.UpdatedAt}
+}
@@ -26,18 +26,7 @@ func (h *CommentHandler) Create(c *gin.Context) {
 		return
 	}
 
-	// Verify task ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT EXISTS(
-			SELECT 1 FROM tasks t 
-			JOIN boards b ON t.board_id = b.id 
-			JOIN projects p ON b.project_id = p.id 
-			WHERE t.id = $1 AND p.user_id = $2
-		)`,
-		taskID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleCommenter); !ok {
 		return
 	}
 
@@ -64,25 +53,13 @@ func (h *CommentHandler) Create(c *gin.Context) {
 }
 
 func (h *CommentHandler) List(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	taskID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
 		return
 	}
 
-	// Verify task ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT EXISTS(
-			SELECT 1 FROM tasks t 
-			JOIN boards b ON t.board_id = b.id 
-			JOIN projects p ON b.project_id = p.id 
-			WHERE t.id = $1 AND p.user_id = $2
-		)`,
-		taskID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleViewer); !ok {
 		return
 	}
 
@@ -132,6 +109,11 @@ func (h *CommentHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// Authors can edit their comments while they can still comment
+	if _, _, ok := authorizeComment(c, h.db, commentID, models.RoleCommenter); !ok {
+		return
+	}
+
 	var comment models.Comment
 	err = h.db.Pool.QueryRow(context.Background(),
 		`UPDATE comments SET content = $1, updated_at = NOW() 
@@ -156,9 +138,15 @@ func (h *CommentHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	// Authors can delete their own comments, admins can delete any comment
+	_, role, ok := authorizeComment(c, h.db, commentID, models.RoleCommenter)
+	if !ok {
+		return
+	}
+
 	result, err := h.db.Pool.Exec(context.Background(),
-		"DELETE FROM comments WHERE id = $1 AND user_id = $2",
-		commentID, userID)
+		"DELETE FROM comments WHERE id = $1 AND (user_id = $2 OR $3)",
+		commentID, userID, role.AtLeast(models.RoleAdmin))
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
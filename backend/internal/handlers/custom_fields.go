@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mochammadshenna/4me-backend/internal/customfield"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/taskquery"
+)
+
+const customFieldColumns = "id, project_id, name, type, options, position, created_at, updated_at"
+
+// CustomFieldHandler manages the custom fields projects define for their
+// tasks. Values are set through the task endpoints.
+type CustomFieldHandler struct {
+	db *database.Database
+}
+
+func NewCustomFieldHandler(db *database.Database) *CustomFieldHandler {
+	return &CustomFieldHandler{db: db}
+}
+
+// Create adds a field after the project's other fields.
+func (h *CustomFieldHandler) Create(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleAdmin); !ok {
+		return
+	}
+
+	var req models.CreateCustomFieldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	options, err := customfield.Options(req.Type, req.Options)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var field models.CustomField
+	err = h.db.Pool.QueryRow(context.Background(),
+		`INSERT INTO custom_fields (project_id, name, type, options, position) 
+		 VALUES ($1, $2, $3, $4, (SELECT COALESCE(MAX(position) + 1, 0) FROM custom_fields WHERE project_id = $1)) 
+		 RETURNING `+customFieldColumns,
+		projectID, req.Name, req.Type, options).
+		Scan(customFieldScanDest(&field)...)
+	if err != nil {
+		customFieldWriteError(c, err, "Failed to create custom field")
+		return
+	}
+
+	c.JSON(http.StatusCreated, field)
+}
+
+func (h *CustomFieldHandler) List(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleViewer); !ok {
+		return
+	}
+
+	rows, err := h.db.Pool.Query(context.Background(),
+		`SELECT `+customFieldColumns+` FROM custom_fields 
+		 WHERE project_id = $1 ORDER BY position, id`,
+		projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch custom fields"})
+		return
+	}
+	defer rows.Close()
+
+	fields := []models.CustomField{}
+	for rows.Next() {
+		var field models.CustomField
+		if err := rows.Scan(customFieldScanDest(&field)...); err != nil {
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	c.JSON(http.StatusOK, fields)
+}
+
+// Update renames, reorders or changes the options of a field. Options that
+// are removed are cleared from every task using them.
+func (h *CustomFieldHandler) Update(c *gin.Context) {
+	fieldID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid custom field ID"})
+		return
+	}
+
+	if _, ok := authorizeCustomField(c, h.db, fieldID, models.RoleAdmin); !ok {
+		return
+	}
+
+	var req models.UpdateCustomFieldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var field models.CustomField
+	err = tx.QueryRow(ctx,
+		`SELECT `+customFieldColumns+` FROM custom_fields WHERE id = $1 FOR UPDATE`,
+		fieldID).Scan(customFieldScanDest(&field)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if req.Name != nil {
+		field.Name = *req.Name
+	}
+	if req.Position != nil {
+		field.Position = *req.Position
+	}
+	if req.Options != nil {
+		options, err := customfield.Options(field.Type, req.Options)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		field.Options = options
+
+		if customfield.IsSelect(field.Type) && !pruneCustomFieldOptions(c, ctx, tx, field) {
+			return
+		}
+	}
+
+	err = tx.QueryRow(ctx,
+		`UPDATE custom_fields SET name = $1, options = $2, position = $3 
+		 WHERE id = $4 
+		 RETURNING `+customFieldColumns,
+		field.Name, field.Options, field.Position, fieldID).
+		Scan(customFieldScanDest(&field)...)
+	if err != nil {
+		customFieldWriteError(c, err, "Failed to update custom field")
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, field)
+}
+
+// Delete removes a field with its values.
+func (h *CustomFieldHandler) Delete(c *gin.Context) {
+	fieldID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid custom field ID"})
+		return
+	}
+
+	if _, ok := authorizeCustomField(c, h.db, fieldID, models.RoleAdmin); !ok {
+		return
+	}
+
+	result, err := h.db.Pool.Exec(context.Background(),
+		"DELETE FROM custom_fields WHERE id = $1",
+		fieldID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom field"})
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Custom field not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Custom field deleted successfully"})
+}
+
+// pruneCustomFieldOptions removes options no longer offered by a select
+// field from the values of its tasks.
+func pruneCustomFieldOptions(c *gin.Context, ctx context.Context, tx pgx.Tx, field models.CustomField) bool {
+	_, err := tx.Exec(ctx,
+		`UPDATE task_custom_field_values SET value = (
+		     SELECT COALESCE(jsonb_agg(o), '[]') FROM jsonb_array_elements_text(value) o WHERE o = ANY($2)
+		 ), updated_at = NOW() 
+		 WHERE field_id = $1 AND jsonb_typeof(value) = 'array'`,
+		field.ID, field.Options)
+	if err == nil {
+		_, err = tx.Exec(ctx,
+			`DELETE FROM task_custom_field_values 
+			 WHERE field_id = $1 
+			   AND (value = '[]' OR (jsonb_typeof(value) = 'string' AND NOT (value #>> '{}') = ANY($2)))`,
+			field.ID, field.Options)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update custom field values"})
+		return false
+	}
+	return true
+}
+
+// setCustomFieldValues validates and stores custom field values of a task,
+// writing a 400 response for unknown fields or invalid values. It returns
+// the values that changed by field name, for the task history.
+func setCustomFieldValues(c *gin.Context, ctx context.Context, tx pgx.Tx, projectID, taskID int, values map[int]json.RawMessage) (map[string]interface{}, bool) {
+	changes := map[string]interface{}{}
+	if len(values) == 0 {
+		return changes, true
+	}
+
+	ids := make([]int, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	rows, err := tx.Query(ctx,
+		`SELECT `+customFieldColumns+` FROM custom_fields WHERE id = ANY($1) AND project_id = $2`,
+		ids, projectID)
+	fields := map[int]models.CustomField{}
+	if err == nil {
+		for rows.Next() {
+			var field models.CustomField
+			if err = rows.Scan(customFieldScanDest(&field)...); err != nil {
+				break
+			}
+			fields[field.ID] = field
+		}
+		rows.Close()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	for _, id := range ids {
+		field, ok := fields[id]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown custom field %d", id)})
+			return nil, false
+		}
+
+		value, err := customfield.Value(field, values[id])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid value for %s: %v", field.Name, err)})
+			return nil, false
+		}
+		if userID, ok := value.(int); ok && field.Type == models.CustomFieldUser {
+			member, err := isProjectMember(ctx, tx, projectID, userID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return nil, false
+			}
+			if !member {
+				c.JSON(http.StatusBadRequest, gin.H{"error": field.Name + " must be a member of the project"})
+				return nil, false
+			}
+		}
+
+		var current interface{}
+		err = tx.QueryRow(ctx,
+			"SELECT value FROM task_custom_field_values WHERE task_id = $1 AND field_id = $2",
+			taskID, id).Scan(&current)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return nil, false
+		}
+
+		currentJSON, _ := json.Marshal(current)
+		valueJSON, _ := json.Marshal(value)
+		if bytes.Equal(currentJSON, valueJSON) {
+			continue
+		}
+
+		if value == nil {
+			_, err = tx.Exec(ctx,
+				"DELETE FROM task_custom_field_values WHERE task_id = $1 AND field_id = $2",
+				taskID, id)
+		} else {
+			_, err = tx.Exec(ctx,
+				`INSERT INTO task_custom_field_values (task_id, field_id, value) 
+				 VALUES ($1, $2, $3) 
+				 ON CONFLICT (task_id, field_id) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()`,
+				taskID, id, valueJSON)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set custom fields"})
+			return nil, false
+		}
+		changes[field.Name] = value
+	}
+
+	return changes, true
+}
+
+// resolveCustomFieldFilters passes the types of the custom fields a task
+// query filters on to it, looking them up in the projects the user is a
+// member of. It writes a 400 response for unknown fields.
+func resolveCustomFieldFilters(c *gin.Context, ctx context.Context, db *database.Database, q *taskquery.Query) bool {
+	ids := q.CustomFields()
+	if len(ids) == 0 {
+		return true
+	}
+
+	userID, _ := c.Get("userID")
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, type FROM custom_fields 
+		 WHERE id = ANY($1) AND project_id IN (`+fmt.Sprintf(memberProjectsSQL, "$2")+`)`,
+		ids, userID)
+	types := map[int]string{}
+	if err == nil {
+		for rows.Next() {
+			var id int
+			var fieldType string
+			if err = rows.Scan(&id, &fieldType); err != nil {
+				break
+			}
+			types[id] = fieldType
+		}
+		rows.Close()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+
+	if err := q.SetCustomFieldTypes(types); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// customFieldScanDest returns the scan destinations matching
+// customFieldColumns.
+func customFieldScanDest(field *models.CustomField) []interface{} {
+	return []interface{}{&field.ID, &field.ProjectID, &field.Name, &field.Type, &field.Options, &field.Position, &field.CreatedAt, &field.UpdatedAt}
+}
+
+// customFieldWriteError writes the response for a failed insert or update
+// of a field, which conflicts when the name is taken.
+func customFieldWriteError(c *gin.Context, err error, message string) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"error": "The project already has a custom field with this name"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/depgraph"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+// DependencyHandler manages "blocks" and "relates to" links between tasks of
+// the same project. Blocking links must not form cycles.
+type DependencyHandler struct {
+	db *database.Database
+}
+
+func NewDependencyHandler(db *database.Database) *DependencyHandler {
+	return &DependencyHandler{db: db}
+}
+
+func (h *DependencyHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	projectID, ok := authorizeTask(c, h.db, taskID, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var req models.CreateDependencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TaskID == taskID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A task cannot depend on itself"})
+		return
+	}
+
+	// Store blocked_by as blocks from the other task, and relates_to with
+	// the lower task ID first
+	from, to, depType := taskID, req.TaskID, req.Type
+	switch {
+	case req.Type == models.DependencyBlockedBy:
+		from, to, depType = req.TaskID, taskID, models.DependencyBlocks
+	case req.Type == models.DependencyRelatesTo && to < from:
+		from, to = to, from
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the project so concurrent requests cannot each add half of a
+	// cycle
+	var other models.TaskRef
+	err = tx.QueryRow(ctx,
+		`SELECT t.id, t.board_id, t.title, t.status 
+		 FROM tasks t 
+		 JOIN boards b ON t.board_id = b.id 
+		 WHERE t.id = $1 AND b.project_id = (SELECT id FROM projects WHERE id = $2 FOR NO KEY UPDATE)`,
+		req.TaskID, projectID).Scan(&other.ID, &other.BoardID, &other.Title, &other.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Task to link not found in this project"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if depType == models.DependencyBlocks {
+		graph, err := loadBlockingGraph(ctx, tx, projectID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load dependencies"})
+			return
+		}
+		if path := graph.Path(to, from); path != nil {
+			cycle := append(path, to)
+			c.JSON(http.StatusConflict, gin.H{
+				"error": fmt.Sprintf("Task %d cannot block task %d: this would create the cycle %s", from, to, formatCycle(cycle)),
+				"code":  models.ErrorCodeDependencyCycle,
+				"cycle": cycle,
+			})
+			return
+		}
+	}
+
+	dep := models.TaskDependency{Type: req.Type, Task: other}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO task_dependencies (task_id, target_task_id, type, created_by) 
+		 VALUES ($1, $2, $3, $4) 
+		 RETURNING id, created_at`,
+		from, to, depType, userID).Scan(&dep.ID, &dep.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"error": "These tasks are already linked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dependency"})
+		return
+	}
+
+	changes := map[string]interface{}{"dependency_id": dep.ID, "from": from, "to": to, "type": depType}
+	addTaskHistory(ctx, tx, from, userID, "dependency_added", changes)
+	addTaskHistory(ctx, tx, to, userID, "dependency_added", changes)
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dep)
+}
+
+// List returns the links of a task, typed from its point of view.
+func (h *DependencyHandler) List(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleViewer); !ok {
+		return
+	}
+
+	deps, err := loadDependencies(context.Background(), h.db.Pool, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dependencies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deps)
+}
+
+func (h *DependencyHandler) Delete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	depID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dependency ID"})
+		return
+	}
+
+	if _, ok := authorizeDependency(c, h.db, depID, models.RoleEditor); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var from, to int
+	var depType string
+	err = tx.QueryRow(ctx,
+		"DELETE FROM task_dependencies WHERE id = $1 RETURNING task_id, target_task_id, type",
+		depID).Scan(&from, &to, &depType)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dependency not found"})
+		return
+	}
+
+	changes := map[string]interface{}{"dependency_id": depID, "from": from, "to": to, "type": depType}
+	addTaskHistory(ctx, tx, from, userID, "dependency_removed", changes)
+	addTaskHistory(ctx, tx, to, userID, "dependency_removed", changes)
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dependency deleted successfully"})
+}
+
+// Graph returns the tasks of a project that have dependencies, the links
+// between them and the critical path through the unfinished tasks.
+func (h *DependencyHandler) Graph(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	rows, err := h.db.Pool.Query(ctx,
+		`SELECT d.id, d.task_id, d.target_task_id, d.type 
+		 FROM task_dependencies d 
+		 JOIN tasks t ON d.task_id = t.id 
+		 JOIN boards b ON t.board_id = b.id 
+		 WHERE b.project_id = $1 
+		 ORDER BY d.id`,
+		projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dependencies"})
+		return
+	}
+	graph := models.DependencyGraph{Nodes: []models.DependencyNode{}, Edges: []models.DependencyEdge{}}
+	taskIDs := []int{}
+	seen := map[int]bool{}
+	for rows.Next() {
+		var edge models.DependencyEdge
+		if err := rows.Scan(&edge.ID, &edge.From, &edge.To, &edge.Type); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dependencies"})
+			return
+		}
+		graph.Edges = append(graph.Edges, edge)
+		for _, id := range []int{edge.From, edge.To} {
+			if !seen[id] {
+				seen[id] = true
+				taskIDs = append(taskIDs, id)
+			}
+		}
+	}
+	rows.Close()
+
+	rows, err = h.db.Pool.Query(ctx,
+		`SELECT id, board_id, title, status, due_date, completed_at IS NOT NULL FROM tasks WHERE id = ANY($1) ORDER BY id`,
+		taskIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+		return
+	}
+	defer rows.Close()
+	finished := map[int]bool{}
+	for rows.Next() {
+		var node models.DependencyNode
+		var done bool
+		if err := rows.Scan(&node.ID, &node.BoardID, &node.Title, &node.Status, &node.DueDate, &done); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+			return
+		}
+		finished[node.ID] = done
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	var blocking []depgraph.Edge
+	blocked := map[int]bool{}
+	for _, edge := range graph.Edges {
+		if edge.Type != models.DependencyBlocks {
+			continue
+		}
+		blocking = append(blocking, depgraph.Edge{From: edge.From, To: edge.To})
+		if !finished[edge.From] {
+			blocked[edge.To] = true
+		}
+	}
+	weights := map[int]int{}
+	for i := range graph.Nodes {
+		graph.Nodes[i].IsBlocked = blocked[graph.Nodes[i].ID]
+		if !finished[graph.Nodes[i].ID] {
+			weights[graph.Nodes[i].ID] = 1
+		}
+	}
+	graph.CriticalPath = depgraph.New(blocking).CriticalPath(weights)
+
+	c.JSON(http.StatusOK, graph)
+}
+
+// loadBlockingGraph loads the blocking dependencies between the tasks of a
+// project.
+func loadBlockingGraph(ctx context.Context, q querier, projectID int) (*depgraph.Graph, error) {
+	rows, err := q.Query(ctx,
+		`SELECT d.task_id, d.target_task_id 
+		 FROM task_dependencies d 
+		 JOIN tasks t ON d.task_id = t.id 
+		 JOIN boards b ON t.board_id = b.id 
+		 WHERE b.project_id = $1 AND d.type = $2`,
+		projectID, models.DependencyBlocks)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (depgraph.Edge, error) {
+		var e depgraph.Edge
+		err := row.Scan(&e.From, &e.To)
+		return e, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return depgraph.New(edges), nil
+}
+
+// loadDependencies returns the links of a task, typed from its point of
+// view.
+func loadDependencies(ctx context.Context, q querier, taskID int) ([]models.TaskDependency, error) {
+	rows, err := q.Query(ctx,
+		`SELECT d.id, d.type, d.task_id = $1, o.id, o.board_id, o.title, o.status, d.created_at 
+		 FROM task_dependencies d 
+		 JOIN tasks o ON o.id = CASE WHEN d.task_id = $1 THEN d.target_task_id ELSE d.task_id END 
+		 WHERE d.task_id = $1 OR d.target_task_id = $1 
+		 ORDER BY d.created_at ASC, d.id ASC`,
+		taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deps := []models.TaskDependency{}
+	for rows.Next() {
+		var dep models.TaskDependency
+		var outgoing bool
+		err := rows.Scan(&dep.ID, &dep.Type, &outgoing, &dep.Task.ID, &dep.Task.BoardID, &dep.Task.Title, &dep.Task.Status, &dep.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if dep.Type == models.DependencyBlocks && !outgoing {
+			dep.Type = models.DependencyBlockedBy
+		}
+		deps = append(deps, dep)
+	}
+	return deps, rows.Err()
+}
+
+// formatCycle writes a cycle of task IDs as "#1 -> #2 -> #1".
+func formatCycle(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = "#" + strconv.Itoa(id)
+	}
+	return strings.Join(parts, " -> ")
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/estimate"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+// EstimateHandler reports how the estimates of a project's tasks compare
+// with the time logged on them.
+type EstimateHandler struct {
+	db *database.Database
+}
+
+func NewEstimateHandler(db *database.Database) *EstimateHandler {
+	return &EstimateHandler{db: db}
+}
+
+// Rollup adds up the estimates and logged time of every task and subtask of
+// a project, per board and per assignee.
+func (h *EstimateHandler) Rollup(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	var unit string
+	err = h.db.Pool.QueryRow(ctx, "SELECT estimate_unit FROM projects WHERE id = $1", projectID).Scan(&unit)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	rows, err := h.db.Pool.Query(ctx,
+		"SELECT id, name FROM boards WHERE project_id = $1 ORDER BY position, id",
+		projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch boards"})
+		return
+	}
+	boards := []models.Board{}
+	for rows.Next() {
+		var board models.Board
+		if err := rows.Scan(&board.ID, &board.Name); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch boards"})
+			return
+		}
+		boards = append(boards, board)
+	}
+	rows.Close()
+
+	rows, err = h.db.Pool.Query(ctx,
+		`SELECT t.board_id, t.assignee_id, u.username, t.completed_at IS NOT NULL, 
+		        t.original_estimate, t.remaining_estimate, 
+		        (SELECT COALESCE(SUM(EXTRACT(EPOCH FROM COALESCE(te.ended_at, `+utcNowSQL+`) - te.started_at)), 0)::bigint 
+		         FROM time_entries te WHERE te.task_id = t.id) 
+		 FROM tasks t 
+		 JOIN boards b ON t.board_id = b.id 
+		 LEFT JOIN users u ON t.assignee_id = u.id 
+		 WHERE b.project_id = $1`,
+		projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+		return
+	}
+	defer rows.Close()
+
+	tasks := []estimate.Task{}
+	for rows.Next() {
+		var task estimate.Task
+		err := rows.Scan(&task.BoardID, &task.AssigneeID, &task.Username, &task.Done,
+			&task.OriginalEstimate, &task.RemainingEstimate, &task.SpentSeconds)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+			return
+		}
+		tasks = append(tasks, task)
+	}
+
+	c.JSON(http.StatusOK, estimate.Build(projectID, unit, boards, tasks))
+}
+
+// lockEstimateUnit locks a project's estimate unit until tx ends, so it
+// cannot change while a task estimate is written in it. It writes the error
+// response on failure.
+func lockEstimateUnit(c *gin.Context, ctx context.Context, tx pgx.Tx, projectID int) bool {
+	_, err := tx.Exec(ctx, "SELECT 1 FROM projects WHERE id = $1 FOR SHARE", projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	return true
+}
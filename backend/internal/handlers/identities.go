@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/oauth"
+	"github.com/mochammadshenna/4me-backend/internal/utils"
+)
+
+// linkTicketTTL is how long the browser has to open a link URL.
+const linkTicketTTL = time.Minute
+
+// ListIdentities lists the sign-in providers linked to the current user.
+func (h *AuthHandler) ListIdentities(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	rows, err := h.db.Pool.Query(context.Background(),
+		`SELECT provider, email, created_at FROM user_identities
+		 WHERE user_id = $1
+		 ORDER BY created_at ASC`,
+		userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch identities"})
+		return
+	}
+	defer rows.Close()
+
+	identities := []models.UserIdentity{}
+	for rows.Next() {
+		var identity models.UserIdentity
+		if err := rows.Scan(&identity.Provider, &identity.Email, &identity.CreatedAt); err != nil {
+			continue
+		}
+		identities = append(identities, identity)
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// LinkIdentity starts linking a provider account to the current user. It
+// returns a URL with a one-time ticket for the browser to open; the provider
+// redirect cannot carry the bearer token, and a state cookie set on this
+// request would not be kept when the frontend is on another site. The
+// callback does not link the account until ConfirmLink.
+func (h *AuthHandler) LinkIdentity(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	ticket, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start linking"})
+		return
+	}
+
+	_, err = h.db.Pool.Exec(context.Background(),
+		`INSERT INTO oauth_link_tickets (user_id, provider, ticket_hash, expires_at)
+		 VALUES ($1, $2, $3, $4)`,
+		userID, provider.Name(), utils.HashToken(ticket), time.Now().Add(linkTicketTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start linking"})
+		return
+	}
+
+	// The URL is built from the configured callback rather than the request,
+	// whose Host and X-Forwarded-Proto headers the client controls
+	link, err := url.Parse(provider.RedirectURL())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start linking"})
+		return
+	}
+	link.Path = "/api/auth/oauth/" + provider.Name() + "/link"
+	link.RawQuery = url.Values{"ticket": {ticket}}.Encode()
+
+	c.JSON(http.StatusOK, gin.H{"url": link.String()})
+}
+
+// OAuthLink redeems a ticket from LinkIdentity and redirects the browser to
+// the provider, with the state cookie marked with the ticket's user. As a
+// top-level navigation to the API, the response can set the cookie.
+func (h *AuthHandler) OAuthLink(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	var userID int
+	err := h.db.Pool.QueryRow(context.Background(),
+		`UPDATE oauth_link_tickets SET used_at = NOW()
+		 WHERE ticket_hash = $1 AND provider = $2 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id`,
+		utils.HashToken(c.Query("ticket")), provider.Name()).Scan(&userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link request"})
+		return
+	}
+
+	authURL, ok := h.startOAuth(c, provider, userID)
+	if !ok {
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// ConfirmLink links the provider account from a link callback to the current
+// user. The code only works for the user who started linking, so a ticket
+// opened by someone else cannot add their account to this user.
+func (h *AuthHandler) ConfirmLink(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.ConfirmLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	var linkUserID int
+	var identity oauth.Identity
+	err := h.db.Pool.QueryRow(ctx,
+		`UPDATE oauth_link_confirmations SET used_at = NOW()
+		 WHERE code_hash = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id, provider, subject, email, email_verified`,
+		utils.HashToken(req.Code), userID).
+		Scan(&linkUserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.EmailVerified)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link code"})
+		return
+	}
+
+	err = h.linkOAuthIdentity(ctx, linkUserID, &identity)
+	if errors.Is(err, errIdentityLinked) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This " + identity.Provider + " account is already linked to a user"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity linked successfully", "provider": identity.Provider})
+}
+
+// UnlinkIdentity removes a provider from the current user, unless it is the
+// only way left to sign in.
+func (h *AuthHandler) UnlinkIdentity(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	provider := c.Param("provider")
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var hasPassword bool
+	var otherIdentities int
+	err = tx.QueryRow(ctx,
+		`SELECT u.password_hash <> '',
+		        (SELECT COUNT(*) FROM user_identities WHERE user_id = u.id AND provider <> $2)
+		 FROM users u WHERE u.id = $1
+		 FOR UPDATE`,
+		userID, provider).Scan(&hasPassword, &otherIdentities)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !hasPassword && otherIdentities == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Set a password or link another provider before unlinking your only sign-in method"})
+		return
+	}
+
+	result, err := tx.Exec(ctx,
+		"DELETE FROM user_identities WHERE user_id = $1 AND provider = $2",
+		userID, provider)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink identity"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked successfully"})
+}
@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/mochammadshenna/4me-backend/internal/config"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/mailer"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/utils"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+// invitationColumns is scanned by invitationScanDest. Queries using it must
+// alias project_invitations as "i" and join projects as "p".
+const invitationColumns = "i.id, i.project_id, p.name, i.email, i.role, i.status, i.invited_by, i.expires_at, i.created_at"
+
+type InvitationHandler struct {
+	db     *database.Database
+	config *config.Config
+	mailer mailer.Sender
+}
+
+func NewInvitationHandler(db *database.Database, cfg *config.Config, mail mailer.Sender) *InvitationHandler {
+	return &InvitationHandler{
+		db:     db,
+		config: cfg,
+		mailer: mail,
+	}
+}
+
+func (h *InvitationHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	actorRole, ok := authorizeProject(c, h.db, projectID, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req models.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	if !canGrant(actorRole, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant the " + string(req.Role) + " role"})
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+
+	ctx := context.Background()
+	var isMember bool
+	err = h.db.Pool.QueryRow(ctx,
+		`SELECT EXISTS(
+			SELECT 1 FROM project_members m
+			JOIN users u ON m.user_id = u.id
+			WHERE m.project_id = $1 AND LOWER(u.email) = LOWER($2)
+		)`,
+		projectID, email).Scan(&isMember)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if isMember {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of this project"})
+		return
+	}
+
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Inviting the same address again replaces the previous invitation
+	_, err = tx.Exec(ctx,
+		`UPDATE project_invitations SET status = 'revoked', responded_at = NOW()
+		 WHERE project_id = $1 AND LOWER(email) = LOWER($2) AND status = 'pending'`,
+		projectID, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	var invitation models.ProjectInvitation
+	err = tx.QueryRow(ctx,
+		`WITH i AS (
+			INSERT INTO project_invitations (project_id, email, role, invited_by, expires_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING *
+		 )
+		 SELECT `+invitationColumns+` FROM i JOIN projects p ON i.project_id = p.id`,
+		projectID, email, req.Role, userID, time.Now().Add(invitationTTL)).
+		Scan(invitationScanDest(&invitation)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	token, err := utils.GenerateInvitationToken(invitation.ID, invitation.Email, h.config.JWTSecret, invitation.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation token"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	var inviterName string
+	_ = h.db.Pool.QueryRow(ctx, "SELECT username FROM users WHERE id = $1", userID).Scan(&inviterName)
+
+	link := h.config.FrontendURL + "/invitations/accept?token=" + url.QueryEscape(token)
+	err = h.mailer.Send(ctx, mailer.Message{
+		To:      []string{invitation.Email},
+		Subject: fmt.Sprintf("%s invited you to %s on 4me", inviterName, invitation.ProjectName),
+		Body: fmt.Sprintf("%s invited you to join the project \"%s\" as %s.\n\n"+
+			"Accept the invitation here:\n%s\n\n"+
+			"If you don't have an account yet, sign up with this email address and you will be added automatically.\n"+
+			"The invitation expires on %s.\n",
+			inviterName, invitation.ProjectName, invitation.Role, link, invitation.ExpiresAt.Format("January 2, 2006")),
+	})
+	if err != nil {
+		log.Printf("Failed to send invitation %d: %v", invitation.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+func (h *InvitationHandler) List(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleAdmin); !ok {
+		return
+	}
+
+	rows, err := h.db.Pool.Query(context.Background(),
+		`SELECT `+invitationColumns+`
+		 FROM project_invitations i
+		 JOIN projects p ON i.project_id = p.id
+		 WHERE i.project_id = $1 AND i.status = 'pending'
+		 ORDER BY i.created_at DESC`,
+		projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	invitations, err := scanInvitations(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+func (h *InvitationHandler) Revoke(c *gin.Context) {
+	invitationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	var projectID int
+	err = h.db.Pool.QueryRow(context.Background(),
+		"SELECT project_id FROM project_invitations WHERE id = $1",
+		invitationID).Scan(&projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleAdmin); !ok {
+		return
+	}
+
+	result, err := h.db.Pool.Exec(context.Background(),
+		`UPDATE project_invitations SET status = 'revoked', responded_at = NOW()
+		 WHERE id = $1 AND status = 'pending'`,
+		invitationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation is no longer pending"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+// AcceptToken accepts an invitation using the signed token from the
+// invitation email.
+func (h *InvitationHandler) AcceptToken(c *gin.Context) {
+	var req models.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := utils.ValidateInvitationToken(req.Token, h.config.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+
+	h.respond(c, claims.InvitationID, "accepted")
+}
+
+func (h *InvitationHandler) Accept(c *gin.Context) {
+	invitationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	h.respond(c, invitationID, "accepted")
+}
+
+func (h *InvitationHandler) Decline(c *gin.Context) {
+	invitationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	h.respond(c, invitationID, "declined")
+}
+
+// respond accepts or declines a pending invitation addressed to the current
+// user's email address.
+func (h *InvitationHandler) respond(c *gin.Context, invitationID int, status string) {
+	userID, _ := c.Get("userID")
+	ctx := context.Background()
+
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if status == "accepted" && h.config.RequireVerifiedEmail {
+		var verified bool
+		err = tx.QueryRow(ctx,
+			"SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1",
+			userID).Scan(&verified)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email address before accepting invitations"})
+			return
+		}
+	}
+
+	var projectID int
+	var role models.ProjectRole
+	err = tx.QueryRow(ctx,
+		`UPDATE project_invitations i SET status = $1, responded_at = NOW(),
+		        accepted_by = CASE WHEN $1 = 'accepted' THEN u.id END
+		 FROM users u
+		 WHERE i.id = $2 AND u.id = $3 AND LOWER(i.email) = LOWER(u.email)
+		   AND i.status = 'pending' AND i.expires_at > NOW()
+		 RETURNING i.project_id, i.role`,
+		status, invitationID, userID).Scan(&projectID, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found, expired or sent to a different email address"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update invitation"})
+		return
+	}
+
+	if status == "accepted" {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO project_members (project_id, user_id, role)
+			 VALUES ($1, $2, $3)
+			 ON CONFLICT DO NOTHING`,
+			projectID, userID, role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join project"})
+			return
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation " + status, "project_id": projectID})
+}
+
+// joinInvitedProjects accepts every pending invitation sent to email on
+// behalf of a newly created user.
+func joinInvitedProjects(ctx context.Context, q querier, userID int, email string) error {
+	_, err := q.Exec(ctx,
+		`WITH accepted AS (
+			UPDATE project_invitations SET status = 'accepted', accepted_by = $1, responded_at = NOW()
+			WHERE LOWER(email) = LOWER($2) AND status = 'pending' AND expires_at > NOW()
+			RETURNING project_id, role
+		 )
+		 INSERT INTO project_members (project_id, user_id, role)
+		 SELECT project_id, $1, role FROM accepted
+		 ON CONFLICT DO NOTHING`,
+		userID, email)
+	return err
+}
+
+// pendingInvitations lists the open invitations addressed to email.
+func pendingInvitations(ctx context.Context, q querier, email string) ([]models.ProjectInvitation, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+invitationColumns+`, u.id, u.username, u.avatar_url
+		 FROM project_invitations i
+		 JOIN projects p ON i.project_id = p.id
+		 LEFT JOIN users u ON i.invited_by = u.id
+		 WHERE LOWER(i.email) = LOWER($1) AND i.status = 'pending' AND i.expires_at > NOW()
+		 ORDER BY i.created_at DESC`,
+		email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.ProjectInvitation{}
+	for rows.Next() {
+		var invitation models.ProjectInvitation
+		var inviterID *int
+		var inviterName *string
+		var inviterAvatar *string
+		if err := rows.Scan(append(invitationScanDest(&invitation), &inviterID, &inviterName, &inviterAvatar)...); err != nil {
+			return nil, err
+		}
+		if inviterID != nil {
+			invitation.Inviter = &models.User{ID: *inviterID, Username: *inviterName, AvatarURL: inviterAvatar}
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+func invitationScanDest(i *models.ProjectInvitation) []interface{} {
+	return []interface{}{&i.ID, &i.ProjectID, &i.ProjectName, &i.Email, &i.Role, &i.Status, &i.InvitedBy, &i.ExpiresAt, &i.CreatedAt}
+}
+
+func scanInvitations(rows pgx.Rows) ([]models.ProjectInvitation, error) {
+	defer rows.Close()
+
+	invitations := []models.ProjectInvitation{}
+	for rows.Next() {
+		var invitation models.ProjectInvitation
+		if err := rows.Scan(invitationScanDest(&invitation)...); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, rows.Err()
+}
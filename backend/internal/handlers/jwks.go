@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/jwks"
+)
+
+// jwksCacheControl is how long clients may cache the key set. Keys are published
+// before they sign and kept after they retire for longer than this.
+const jwksCacheControl = "public, max-age=300"
+
+type JWKSHandler struct {
+	keys *jwks.KeySet
+}
+
+func NewJWKSHandler(keys *jwks.KeySet) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// Get serves the public keys that verify access tokens.
+func (h *JWKSHandler) Get(c *gin.Context) {
+	c.Header("Cache-Control", jwksCacheControl)
+	c.JSON(http.StatusOK, h.keys.Public())
+}
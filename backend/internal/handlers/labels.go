@@ -19,20 +19,13 @@ func NewLabelHandler(db *database.Database) *LabelHandler {
 }
 
 func (h *LabelHandler) Create(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	projectID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
 		return
 	}
 
-	// Verify project ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		"SELECT EXISTS(SELECT 1 FROM projects WHERE id = $1 AND user_id = $2)",
-		projectID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleEditor); !ok {
 		return
 	}
 
@@ -63,20 +56,13 @@ func (h *LabelHandler) Create(c *gin.Context) {
 }
 
 func (h *LabelHandler) List(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	projectID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
 		return
 	}
 
-	// Verify project ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		"SELECT EXISTS(SELECT 1 FROM projects WHERE id = $1 AND user_id = $2)",
-		projectID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleViewer); !ok {
 		return
 	}
 
@@ -103,24 +89,13 @@ func (h *LabelHandler) List(c *gin.Context) {
 }
 
 func (h *LabelHandler) Update(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	labelID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid label ID"})
 		return
 	}
 
-	// Verify label ownership through project
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT EXISTS(
-			SELECT 1 FROM labels l 
-			JOIN projects p ON l.project_id = p.id 
-			WHERE l.id = $1 AND p.user_id = $2
-		)`,
-		labelID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Label not found"})
+	if _, ok := authorizeLabel(c, h.db, labelID, models.RoleEditor); !ok {
 		return
 	}
 
@@ -147,19 +122,19 @@ func (h *LabelHandler) Update(c *gin.Context) {
 }
 
 func (h *LabelHandler) Delete(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	labelID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid label ID"})
 		return
 	}
 
+	if _, ok := authorizeLabel(c, h.db, labelID, models.RoleEditor); !ok {
+		return
+	}
+
 	result, err := h.db.Pool.Exec(context.Background(),
-		`DELETE FROM labels 
-		 WHERE id = $1 AND project_id IN (
-			 SELECT id FROM projects WHERE user_id = $2
-		 )`,
-		labelID, userID)
+		"DELETE FROM labels WHERE id = $1",
+		labelID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete label"})
@@ -173,4 +148,3 @@ func (h *LabelHandler) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Label deleted successfully"})
 }
-
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+type MemberHandler struct {
+	db *database.Database
+}
+
+func NewMemberHandler(db *database.Database) *MemberHandler {
+	return &MemberHandler{db: db}
+}
+
+func (h *MemberHandler) List(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleViewer); !ok {
+		return
+	}
+
+	rows, err := h.db.Pool.Query(context.Background(),
+		`SELECT m.project_id, m.user_id, m.role, m.created_at,
+		        u.id, u.username, u.email, u.avatar_url
+		 FROM project_members m
+		 JOIN users u ON m.user_id = u.id
+		 WHERE m.project_id = $1
+		 ORDER BY m.created_at ASC`,
+		projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+	defer rows.Close()
+
+	members := []models.ProjectMember{}
+	for rows.Next() {
+		var member models.ProjectMember
+		var user models.User
+		if err := rows.Scan(&member.ProjectID, &member.UserID, &member.Role, &member.CreatedAt,
+			&user.ID, &user.Username, &user.Email, &user.AvatarURL); err != nil {
+			continue
+		}
+		member.User = &user
+		members = append(members, member)
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+func (h *MemberHandler) Add(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	actorRole, ok := authorizeProject(c, h.db, projectID, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req models.AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	if !canGrant(actorRole, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant the " + string(req.Role) + " role"})
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	switch {
+	case req.UserID != nil:
+		err = h.db.Pool.QueryRow(ctx,
+			"SELECT id, username, email, avatar_url FROM users WHERE id = $1",
+			*req.UserID).Scan(&user.ID, &user.Username, &user.Email, &user.AvatarURL)
+	case req.Email != nil:
+		err = h.db.Pool.QueryRow(ctx,
+			"SELECT id, username, email, avatar_url FROM users WHERE LOWER(email) = LOWER($1)",
+			*req.Email).Scan(&user.ID, &user.Username, &user.Email, &user.AvatarURL)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id or email is required"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	member := models.ProjectMember{User: &user}
+	err = h.db.Pool.QueryRow(ctx,
+		`INSERT INTO project_members (project_id, user_id, role)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT DO NOTHING
+		 RETURNING project_id, user_id, role, created_at`,
+		projectID, user.ID, req.Role).
+		Scan(&member.ProjectID, &member.UserID, &member.Role, &member.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of this project"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+func (h *MemberHandler) Update(c *gin.Context) {
+	projectID, memberID, ok := h.parseIDs(c)
+	if !ok {
+		return
+	}
+
+	actorRole, ok := authorizeProject(c, h.db, projectID, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	currentRole, ok := h.lockMember(c, ctx, tx, projectID, memberID)
+	if !ok {
+		return
+	}
+	if !canManage(actorRole, currentRole) || !canGrant(actorRole, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot change this member's role"})
+		return
+	}
+	if currentRole == models.RoleOwner && req.Role != models.RoleOwner && !h.hasOtherOwner(c, ctx, tx, projectID, memberID) {
+		return
+	}
+
+	var member models.ProjectMember
+	err = tx.QueryRow(ctx,
+		`UPDATE project_members SET role = $1
+		 WHERE project_id = $2 AND user_id = $3
+		 RETURNING project_id, user_id, role, created_at`,
+		req.Role, projectID, memberID).
+		Scan(&member.ProjectID, &member.UserID, &member.Role, &member.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// Remove removes a member from a project. Admins can remove members below
+// them and every member can remove themselves, except the last owner.
+func (h *MemberHandler) Remove(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	projectID, memberID, ok := h.parseIDs(c)
+	if !ok {
+		return
+	}
+
+	leaving := memberID == userID.(int)
+	minRole := models.RoleAdmin
+	if leaving {
+		minRole = models.RoleViewer
+	}
+	actorRole, ok := authorizeProject(c, h.db, projectID, minRole)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	currentRole, ok := h.lockMember(c, ctx, tx, projectID, memberID)
+	if !ok {
+		return
+	}
+	if !leaving && !canManage(actorRole, currentRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot remove this member"})
+		return
+	}
+	if currentRole == models.RoleOwner && !h.hasOtherOwner(c, ctx, tx, projectID, memberID) {
+		return
+	}
+
+	_, err = tx.Exec(ctx,
+		"DELETE FROM project_members WHERE project_id = $1 AND user_id = $2",
+		projectID, memberID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	// Former members can no longer be assignees
+	_, err = tx.Exec(ctx,
+		`UPDATE tasks SET assignee_id = NULL
+		 WHERE assignee_id = $1 AND board_id IN (SELECT id FROM boards WHERE project_id = $2)`,
+		memberID, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unassign tasks"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+func (h *MemberHandler) parseIDs(c *gin.Context) (int, int, bool) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return 0, 0, false
+	}
+	memberID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, 0, false
+	}
+	return projectID, memberID, true
+}
+
+// lockMember loads a member's role and locks the row for the transaction.
+func (h *MemberHandler) lockMember(c *gin.Context, ctx context.Context, tx pgx.Tx, projectID, memberID int) (models.ProjectRole, bool) {
+	var role models.ProjectRole
+	err := tx.QueryRow(ctx,
+		"SELECT role FROM project_members WHERE project_id = $1 AND user_id = $2 FOR UPDATE",
+		projectID, memberID).Scan(&role)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return "", false
+	}
+	return role, true
+}
+
+// hasOtherOwner makes sure a project keeps at least one owner and writes a
+// 409 response when memberID is the last one.
+func (h *MemberHandler) hasOtherOwner(c *gin.Context, ctx context.Context, tx pgx.Tx, projectID, memberID int) bool {
+	var owners int
+	err := tx.QueryRow(ctx,
+		"SELECT COUNT(*) FROM project_members WHERE project_id = $1 AND role = 'owner' AND user_id <> $2",
+		projectID, memberID).Scan(&owners)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if owners == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A project must keep at least one owner"})
+		return false
+	}
+	return true
+}
+
+// canGrant reports whether a member with the actor role may hand out role.
+// Nobody can grant a role above their own, and only owners create owners.
+func canGrant(actor, role models.ProjectRole) bool {
+	if role == models.RoleOwner {
+		return actor == models.RoleOwner
+	}
+	return actor.AtLeast(role)
+}
+
+// canManage reports whether the actor may change or remove a member with the
+// target role. Owners manage everyone; admins manage members below admin.
+func canManage(actor, target models.ProjectRole) bool {
+	if actor == models.RoleOwner {
+		return true
+	}
+	return actor.AtLeast(models.RoleAdmin) && !target.AtLeast(models.RoleAdmin)
+}
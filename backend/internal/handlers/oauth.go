@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/oauth"
+	"github.com/mochammadshenna/4me-backend/internal/utils"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * time.Minute
+	loginCodeTTL     = time.Minute
+	linkCodeTTL      = 10 * time.Minute
+
+	// maxUsernameAttempts is how many more usernames a sign-up tries when
+	// the one it picked is taken meanwhile
+	maxUsernameAttempts = 5
+)
+
+var (
+	errAccountExists  = errors.New("account exists")
+	errIdentityLinked = errors.New("identity already linked")
+)
+
+// Providers lists the names of the enabled sign-in providers.
+func (h *AuthHandler) Providers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.providers.Names()})
+}
+
+// OAuthLogin redirects the browser to the provider.
+func (h *AuthHandler) OAuthLogin(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	authURL, ok := h.startOAuth(c, provider, 0)
+	if !ok {
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// startOAuth returns the provider URL that starts a login, or linking to
+// linkUserID when it is set. The random state and the PKCE verifier are kept
+// in a signed cookie that the callback checks.
+func (h *AuthHandler) startOAuth(c *gin.Context, provider oauth.Provider, linkUserID int) (string, bool) {
+	state, err := utils.RandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return "", false
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	cookie, err := utils.GenerateOAuthStateToken(provider.Name(), state, verifier, linkUserID, h.config.JWTSecret, time.Now().Add(oauthStateTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return "", false
+	}
+	setStateCookie(c, cookie, int(oauthStateTTL.Seconds()))
+
+	return provider.AuthCodeURL(state, verifier), true
+}
+
+// OAuthCallback completes a provider login and redirects to the frontend
+// with a one-time code, since tokens in a URL end up in browser history and
+// server logs.
+func (h *AuthHandler) OAuthCallback(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	cookie, _ := c.Cookie(oauthStateCookie)
+	setStateCookie(c, "", -1)
+
+	stateClaims, err := utils.ValidateOAuthStateToken(cookie, h.config.JWTSecret)
+	if err != nil || stateClaims.Provider != provider.Name() ||
+		subtle.ConstantTimeCompare([]byte(stateClaims.State), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code not provided"})
+		return
+	}
+
+	// Stop waiting for the provider when the browser gives up
+	ctx := context.Background()
+	identity, err := provider.Exchange(c.Request.Context(), code, stateClaims.Verifier)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to sign in with " + provider.Name()})
+		return
+	}
+
+	if stateClaims.LinkUserID != 0 {
+		// Anyone can open a link ticket, so the account is only linked
+		// once the user who asked for it confirms it from the frontend
+		linkCode, err := utils.RandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+			return
+		}
+
+		_, err = h.db.Pool.Exec(ctx,
+			`INSERT INTO oauth_link_confirmations (user_id, provider, subject, email, email_verified, code_hash, expires_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			stateClaims.LinkUserID, identity.Provider, identity.Subject, identity.Email, identity.EmailVerified,
+			utils.HashToken(linkCode), time.Now().Add(linkCodeTTL))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+			return
+		}
+
+		c.Redirect(http.StatusFound, h.config.FrontendURL+"/auth/link?code="+linkCode)
+		return
+	}
+
+	if identity.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": provider.Name() + " did not share an email address"})
+		return
+	}
+
+	user, err := h.findOrCreateOAuthUser(ctx, identity)
+	if errors.Is(err, errAccountExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists. Sign in to it and link " +
+			provider.Name() + " from your account settings."})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	loginCode, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate login code"})
+		return
+	}
+
+	_, err = h.db.Pool.Exec(ctx,
+		`INSERT INTO oauth_login_codes (user_id, code_hash, expires_at)
+		 VALUES ($1, $2, $3)`,
+		user.ID, utils.HashToken(loginCode), time.Now().Add(loginCodeTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate login code"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, h.config.FrontendURL+"/auth/callback?code="+loginCode)
+}
+
+// GoogleLogin and GoogleCallback serve the original /auth/google routes.
+func (h *AuthHandler) GoogleLogin(c *gin.Context) {
+	c.AddParam("provider", "google")
+	h.OAuthLogin(c)
+}
+
+func (h *AuthHandler) GoogleCallback(c *gin.Context) {
+	c.AddParam("provider", "google")
+	h.OAuthCallback(c)
+}
+
+// Exchange trades a one-time login code from an OAuth callback for tokens.
+func (h *AuthHandler) Exchange(c *gin.Context) {
+	var req models.ExchangeCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	err := h.db.Pool.QueryRow(context.Background(),
+		`WITH code AS (
+			UPDATE oauth_login_codes SET used_at = NOW()
+			WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+			RETURNING user_id
+		 )
+		 SELECT `+userColumns+`
+		 FROM code JOIN users u ON code.user_id = u.id`,
+		utils.HashToken(req.Code)).
+		Scan(userScanDest(&user)...)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login code"})
+		return
+	}
+
+	h.signIn(c, user)
+}
+
+func (h *AuthHandler) provider(c *gin.Context) (oauth.Provider, bool) {
+	provider, ok := h.providers.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown sign-in provider"})
+		return nil, false
+	}
+	return provider, true
+}
+
+// findOrCreateOAuthUser returns the user linked to identity. An unknown
+// identity is linked to the account with the same email address only when
+// both the provider and that account have verified the address; otherwise
+// the user must sign in and link the identity explicitly. If no account uses
+// the address, a new user is created.
+func (h *AuthHandler) findOrCreateOAuthUser(ctx context.Context, identity *oauth.Identity) (models.User, error) {
+	var user models.User
+
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		return user, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`SELECT `+userColumns+`
+		 FROM user_identities i
+		 JOIN users u ON i.user_id = u.id
+		 WHERE i.provider = $1 AND i.subject = $2`,
+		identity.Provider, identity.Subject).
+		Scan(userScanDest(&user)...)
+	if err == nil {
+		_, err = tx.Exec(ctx,
+			"UPDATE user_identities SET email = $1, email_verified = $2 WHERE provider = $3 AND subject = $4",
+			identity.Email, identity.EmailVerified, identity.Provider, identity.Subject)
+		if err != nil {
+			return user, err
+		}
+		// A verified provider address matching the account's email also
+		// verifies the account.
+		if identity.EmailVerified && user.EmailVerifiedAt == nil && strings.EqualFold(identity.Email, user.Email) {
+			err = tx.QueryRow(ctx,
+				`UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW())
+				 WHERE id = $1 RETURNING email_verified_at`,
+				user.ID).Scan(&user.EmailVerifiedAt)
+			if err != nil {
+				return user, err
+			}
+		}
+		return user, tx.Commit(ctx)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return user, err
+	}
+
+	var emailVerified bool
+	err = tx.QueryRow(ctx,
+		`SELECT `+userColumns+`,
+		        u.email_verified_at IS NOT NULL OR EXISTS(
+		            SELECT 1 FROM user_identities i
+		            WHERE i.user_id = u.id AND i.email_verified AND LOWER(i.email) = LOWER(u.email))
+		 FROM users u WHERE LOWER(u.email) = LOWER($1)
+		 FOR UPDATE OF u`,
+		identity.Email).
+		Scan(append(userScanDest(&user), &emailVerified)...)
+	switch {
+	case err == nil && identity.EmailVerified && emailVerified:
+		if err = linkIdentity(ctx, tx, user.ID, identity); err != nil {
+			return user, err
+		}
+		return user, tx.Commit(ctx)
+	case err == nil:
+		return user, errAccountExists
+	case !errors.Is(err, pgx.ErrNoRows):
+		return user, err
+	}
+
+	if user, err = createOAuthUser(ctx, tx, identity); err != nil {
+		return user, err
+	}
+
+	if err = linkIdentity(ctx, tx, user.ID, identity); err != nil {
+		return user, err
+	}
+
+	if identity.EmailVerified || !h.config.RequireVerifiedEmail {
+		if err = joinInvitedProjects(ctx, tx, user.ID, user.Email); err != nil {
+			return user, err
+		}
+	}
+
+	return user, tx.Commit(ctx)
+}
+
+// createOAuthUser creates a user for identity with a username that is not
+// taken yet. A concurrent sign-up can take the same username first, in which
+// case the next free one is tried.
+func createOAuthUser(ctx context.Context, tx pgx.Tx, identity *oauth.Identity) (models.User, error) {
+	var user models.User
+	for attempt := 0; ; attempt++ {
+		username, err := uniqueUsername(ctx, tx, identity.UsernameBase())
+		if err != nil {
+			return user, err
+		}
+
+		// Insert in a savepoint, so a conflict leaves the transaction usable.
+		// OAuth users have no password; an empty hash never matches.
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return user, err
+		}
+		err = sp.QueryRow(ctx,
+			`INSERT INTO users (username, email, password_hash, avatar_url, email_verified_at)
+			 VALUES ($1, $2, '', NULLIF($3, ''), CASE WHEN $4 THEN NOW() END)
+			 RETURNING id, username, email, avatar_url, email_verified_at, totp_enabled_at IS NOT NULL, created_at, updated_at`,
+			username, identity.Email, identity.AvatarURL, identity.EmailVerified).
+			Scan(userScanDest(&user)...)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_username_key" && attempt < maxUsernameAttempts {
+			if err := sp.Rollback(ctx); err != nil {
+				return user, err
+			}
+			continue
+		}
+		if err != nil {
+			return user, err
+		}
+		return user, sp.Commit(ctx)
+	}
+}
+
+// linkOAuthIdentity links identity to an existing user. It fails with
+// errIdentityLinked when the identity belongs to someone else or the user
+// already has an identity at the provider.
+func (h *AuthHandler) linkOAuthIdentity(ctx context.Context, userID int, identity *oauth.Identity) error {
+	err := linkIdentity(ctx, h.db.Pool, userID, identity)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		// Linking the same identity twice is a no-op
+		var owner int
+		lookupErr := h.db.Pool.QueryRow(ctx,
+			"SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2",
+			identity.Provider, identity.Subject).Scan(&owner)
+		if lookupErr == nil && owner == userID {
+			return nil
+		}
+		return errIdentityLinked
+	}
+	return err
+}
+
+func linkIdentity(ctx context.Context, q querier, userID int, identity *oauth.Identity) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO user_identities (user_id, provider, subject, email, email_verified)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		userID, identity.Provider, identity.Subject, identity.Email, identity.EmailVerified)
+	return err
+}
+
+// uniqueUsername returns base, or base with the lowest numeric suffix that
+// no user has taken yet.
+func uniqueUsername(ctx context.Context, q querier, base string) (string, error) {
+	rows, err := q.Query(ctx,
+		"SELECT username FROM users WHERE username = $1 OR username LIKE $2",
+		base, utils.EscapeLike(base)+"%")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return "", err
+		}
+		taken[username] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	username := base
+	for n := 2; taken[username]; n++ {
+		username = fmt.Sprintf("%s%d", base, n)
+	}
+	return username, nil
+}
+
+// setStateCookie stores the signed OAuth state; a negative maxAge deletes it.
+func setStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, value, maxAge, "/api/auth", "", secure, true)
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/workflow"
+)
+
+const priorityColumns = "id, project_id, key, name, color, rank, is_default, created_at, updated_at"
+
+// defaultPriorityColor is the color of priorities created without one.
+const defaultPriorityColor = "#607D8B"
+
+// PriorityHandler manages the priority scheme of a project. Task
+// priorities are set through the task endpoints.
+type PriorityHandler struct {
+	db *database.Database
+}
+
+func NewPriorityHandler(db *database.Database) *PriorityHandler {
+	return &PriorityHandler{db: db}
+}
+
+// List returns the priorities of a project from least to most urgent.
+func (h *PriorityHandler) List(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleViewer); !ok {
+		return
+	}
+
+	priorities, err := loadPriorities(context.Background(), h.db.Pool, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch priorities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, priorities)
+}
+
+// Create adds a priority to a project, by default as its most urgent.
+func (h *PriorityHandler) Create(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleAdmin); !ok {
+		return
+	}
+
+	var req models.CreatePriorityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !workflow.ValidKey(req.Key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Priority keys may only contain lowercase letters, digits and underscores"})
+		return
+	}
+	if req.Color == "" {
+		req.Color = defaultPriorityColor
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if req.IsDefault && !unsetDefaultPriority(c, ctx, tx, projectID) {
+		return
+	}
+
+	var priority models.ProjectPriority
+	err = tx.QueryRow(ctx,
+		`INSERT INTO project_priorities (project_id, key, name, color, rank, is_default) 
+		 VALUES ($1, $2, $3, $4, COALESCE($5, (SELECT COALESCE(MAX(rank) + 1, 0) FROM project_priorities WHERE project_id = $1)), $6) 
+		 RETURNING `+priorityColumns,
+		projectID, req.Key, req.Name, req.Color, req.Rank, req.IsDefault).
+		Scan(priorityScanDest(&priority)...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "project_priorities_project_id_key_key" {
+			c.JSON(http.StatusConflict, gin.H{"error": "The project already has a priority with this key"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create priority"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, priority)
+}
+
+// Update renames, recolors or reranks a priority, or makes it the default.
+// The key cannot change, as tasks refer to it.
+func (h *PriorityHandler) Update(c *gin.Context) {
+	priorityID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority ID"})
+		return
+	}
+
+	projectID, ok := authorizePriority(c, h.db, priorityID, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req models.UpdatePriorityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var priority models.ProjectPriority
+	err = tx.QueryRow(ctx,
+		`SELECT `+priorityColumns+` FROM project_priorities WHERE id = $1 FOR UPDATE`,
+		priorityID).Scan(priorityScanDest(&priority)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if req.Name != nil {
+		priority.Name = *req.Name
+	}
+	if req.Color != nil {
+		priority.Color = *req.Color
+	}
+	if req.Rank != nil {
+		priority.Rank = *req.Rank
+	}
+	if req.IsDefault != nil && *req.IsDefault != priority.IsDefault {
+		if !*req.IsDefault {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Make another priority the default instead"})
+			return
+		}
+		if !unsetDefaultPriority(c, ctx, tx, projectID) {
+			return
+		}
+		priority.IsDefault = true
+	}
+
+	err = tx.QueryRow(ctx,
+		`UPDATE project_priorities SET name = $1, color = $2, rank = $3, is_default = $4 
+		 WHERE id = $5 
+		 RETURNING `+priorityColumns,
+		priority.Name, priority.Color, priority.Rank, priority.IsDefault, priorityID).
+		Scan(priorityScanDest(&priority)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update priority"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, priority)
+}
+
+// Delete removes a priority that no task uses. The default priority cannot
+// be deleted.
+func (h *PriorityHandler) Delete(c *gin.Context) {
+	priorityID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority ID"})
+		return
+	}
+
+	if _, ok := authorizePriority(c, h.db, priorityID, models.RoleAdmin); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var key string
+	var isDefault bool
+	var tasks int
+	err = tx.QueryRow(ctx,
+		`SELECT p.key, p.is_default, 
+		        (SELECT COUNT(*) FROM tasks t JOIN boards b ON t.board_id = b.id WHERE b.project_id = p.project_id AND t.priority = p.key) 
+		 FROM project_priorities p WHERE p.id = $1 
+		 FOR UPDATE OF p`,
+		priorityID).Scan(&key, &isDefault, &tasks)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Priority not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if isDefault {
+		c.JSON(http.StatusConflict, gin.H{"error": "Make another priority the default before deleting this one"})
+		return
+	}
+	if tasks > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Move the " + strconv.Itoa(tasks) + " tasks with priority " + key + " to another priority first"})
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM project_priorities WHERE id = $1", priorityID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete priority"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Priority deleted successfully"})
+}
+
+// unsetDefaultPriority clears the default priority of a project before
+// another one becomes the default. It locks the project until tx ends, so
+// concurrent changes of the default take turns.
+func unsetDefaultPriority(c *gin.Context, ctx context.Context, tx pgx.Tx, projectID int) bool {
+	_, err := tx.Exec(ctx, "SELECT id FROM projects WHERE id = $1 FOR UPDATE", projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update priorities"})
+		return false
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE project_priorities SET is_default = FALSE WHERE project_id = $1 AND is_default",
+		projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update priorities"})
+		return false
+	}
+	return true
+}
+
+// loadPriorities returns the priorities of a project from least to most
+// urgent.
+func loadPriorities(ctx context.Context, q querier, projectID int) ([]models.ProjectPriority, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+priorityColumns+` FROM project_priorities 
+		 WHERE project_id = $1 ORDER BY rank, id`,
+		projectID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ProjectPriority, error) {
+		var p models.ProjectPriority
+		err := row.Scan(priorityScanDest(&p)...)
+		return p, err
+	})
+}
+
+// resolvePriority returns the priority to store for a task: key when it is
+// in the project's scheme, or the default priority when key is empty. It
+// writes a 400 response for other keys.
+func resolvePriority(c *gin.Context, ctx context.Context, q querier, projectID int, key string) (string, bool) {
+	priorities, err := loadPriorities(ctx, q, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch priorities"})
+		return "", false
+	}
+
+	known := make([]string, len(priorities))
+	for i, p := range priorities {
+		if (key == "" && p.IsDefault) || key == p.Key {
+			return p.Key, true
+		}
+		known[i] = p.Key
+	}
+	if key == "" && len(priorities) > 0 {
+		return priorities[0].Key, true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": fmt.Sprintf("Unknown priority %q; the project's priorities are %s", key, strings.Join(known, ", ")),
+	})
+	return "", false
+}
+
+// priorityScanDest returns the scan destinations matching priorityColumns.
+func priorityScanDest(p *models.ProjectPriority) []interface{} {
+	return []interface{}{&p.ID, &p.ProjectID, &p.Key, &p.Name, &p.Color, &p.Rank, &p.IsDefault, &p.CreatedAt, &p.UpdatedAt}
+}
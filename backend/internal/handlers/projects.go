@@ -6,21 +6,31 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/config"
 	"github.com/mochammadshenna/4me-backend/internal/database"
 	"github.com/mochammadshenna/4me-backend/internal/models"
 )
 
 type ProjectHandler struct {
-	db *database.Database
+	db     *database.Database
+	config *config.Config
 }
 
-func NewProjectHandler(db *database.Database) *ProjectHandler {
-	return &ProjectHandler{db: db}
+func NewProjectHandler(db *database.Database, cfg *config.Config) *ProjectHandler {
+	return &ProjectHandler{
+		db:     db,
+		config: cfg,
+	}
 }
 
 func (h *ProjectHandler) Create(c *gin.Context) {
 	userID, _ := c.Get("userID")
 
+	if _, restricted := tokenProject(c); restricted {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This access token is restricted to a single project"})
+		return
+	}
+
 	var req models.CreateProjectRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -30,30 +40,58 @@ func (h *ProjectHandler) Create(c *gin.Context) {
 	if req.Color == "" {
 		req.Color = "#3B82F6"
 	}
+	if req.EstimateUnit == "" {
+		req.EstimateUnit = models.EstimateUnitHours
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if !checkProjectQuota(c, ctx, tx, userID.(int), h.config.MaxProjectsPerUser) {
+		return
+	}
 
 	var project models.Project
-	err := h.db.Pool.QueryRow(context.Background(),
-		`INSERT INTO projects (user_id, name, description, color) 
-		 VALUES ($1, $2, $3, $4) 
-		 RETURNING id, user_id, name, description, color, created_at, updated_at`,
-		userID, req.Name, req.Description, req.Color).
-		Scan(&project.ID, &project.UserID, &project.Name, &project.Description, &project.Color, &project.CreatedAt, &project.UpdatedAt)
+	err = tx.QueryRow(ctx,
+		`INSERT INTO projects (user_id, name, description, color, estimate_unit) 
+		 VALUES ($1, $2, $3, $4, $5) 
+		 RETURNING id, user_id, name, description, color, estimate_unit, created_at, updated_at`,
+		userID, req.Name, req.Description, req.Color, req.EstimateUnit).
+		Scan(&project.ID, &project.UserID, &project.Name, &project.Description, &project.Color, &project.EstimateUnit, &project.CreatedAt, &project.UpdatedAt)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
 		return
 	}
 
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	// The creator is added as owner by a database trigger
+	project.Role = models.RoleOwner
+
 	c.JSON(http.StatusCreated, project)
 }
 
 func (h *ProjectHandler) List(c *gin.Context) {
 	userID, _ := c.Get("userID")
 
+	restricted, _ := tokenProject(c)
+
 	rows, err := h.db.Pool.Query(context.Background(),
-		`SELECT id, user_id, name, description, color, created_at, updated_at 
-		 FROM projects WHERE user_id = $1 ORDER BY created_at DESC`,
-		userID)
+		`SELECT p.id, p.user_id, p.name, p.description, p.color, p.estimate_unit, m.role, p.created_at, p.updated_at 
+		 FROM projects p 
+		 JOIN project_members m ON m.project_id = p.id 
+		 WHERE m.user_id = $1 AND ($2 = 0 OR p.id = $2)
+		 ORDER BY p.created_at DESC`,
+		userID, restricted)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
 		return
@@ -63,7 +101,7 @@ func (h *ProjectHandler) List(c *gin.Context) {
 	projects := []models.Project{}
 	for rows.Next() {
 		var project models.Project
-		if err := rows.Scan(&project.ID, &project.UserID, &project.Name, &project.Description, &project.Color, &project.CreatedAt, &project.UpdatedAt); err != nil {
+		if err := rows.Scan(&project.ID, &project.UserID, &project.Name, &project.Description, &project.Color, &project.EstimateUnit, &project.Role, &project.CreatedAt, &project.UpdatedAt); err != nil {
 			continue
 		}
 		projects = append(projects, project)
@@ -73,30 +111,34 @@ func (h *ProjectHandler) List(c *gin.Context) {
 }
 
 func (h *ProjectHandler) Get(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	projectID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
 		return
 	}
 
+	role, ok := authorizeProject(c, h.db, projectID, models.RoleViewer)
+	if !ok {
+		return
+	}
+
 	var project models.Project
 	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT id, user_id, name, description, color, created_at, updated_at 
-		 FROM projects WHERE id = $1 AND user_id = $2`,
-		projectID, userID).
-		Scan(&project.ID, &project.UserID, &project.Name, &project.Description, &project.Color, &project.CreatedAt, &project.UpdatedAt)
+		`SELECT id, user_id, name, description, color, estimate_unit, created_at, updated_at 
+		 FROM projects WHERE id = $1`,
+		projectID).
+		Scan(&project.ID, &project.UserID, &project.Name, &project.Description, &project.Color, &project.EstimateUnit, &project.CreatedAt, &project.UpdatedAt)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
+	project.Role = role
 
 	c.JSON(http.StatusOK, project)
 }
 
 func (h *ProjectHandler) Update(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	projectID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
@@ -109,16 +151,43 @@ func (h *ProjectHandler) Update(c *gin.Context) {
 		return
 	}
 
-	// Check ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		"SELECT EXISTS(SELECT 1 FROM projects WHERE id = $1 AND user_id = $2)",
-		projectID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	role, ok := authorizeProject(c, h.db, projectID, models.RoleAdmin)
+	if !ok {
 		return
 	}
 
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Estimates are not converted, so the unit can only change while no
+	// task has one. The project stays locked until the update commits;
+	// estimate writes share the lock, see lockEstimateUnit.
+	if req.EstimateUnit != nil {
+		var estimated bool
+		err = tx.QueryRow(ctx,
+			`SELECT p.estimate_unit <> $2 AND EXISTS(
+			     SELECT 1 FROM tasks t 
+			     JOIN boards b ON t.board_id = b.id 
+			     WHERE b.project_id = p.id 
+			       AND (t.original_estimate IS NOT NULL OR t.remaining_estimate IS NOT NULL)) 
+			 FROM projects p WHERE p.id = $1 
+			 FOR UPDATE`,
+			projectID, *req.EstimateUnit).Scan(&estimated)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+			return
+		}
+		if estimated {
+			c.JSON(http.StatusConflict, gin.H{"error": "The estimate unit cannot change while tasks have estimates"})
+			return
+		}
+	}
+
 	// Build dynamic update query
 	query := "UPDATE projects SET updated_at = NOW()"
 	args := []interface{}{}
@@ -139,39 +208,49 @@ func (h *ProjectHandler) Update(c *gin.Context) {
 		args = append(args, *req.Color)
 		argCount++
 	}
+	if req.EstimateUnit != nil {
+		query += ", estimate_unit = $" + strconv.Itoa(argCount)
+		args = append(args, *req.EstimateUnit)
+		argCount++
+	}
 
 	query += " WHERE id = $" + strconv.Itoa(argCount)
 	args = append(args, projectID)
-	argCount++
-
-	query += " AND user_id = $" + strconv.Itoa(argCount)
-	args = append(args, userID)
 
-	query += " RETURNING id, user_id, name, description, color, created_at, updated_at"
+	query += " RETURNING id, user_id, name, description, color, estimate_unit, created_at, updated_at"
 
 	var project models.Project
-	err = h.db.Pool.QueryRow(context.Background(), query, args...).
-		Scan(&project.ID, &project.UserID, &project.Name, &project.Description, &project.Color, &project.CreatedAt, &project.UpdatedAt)
+	err = tx.QueryRow(ctx, query, args...).
+		Scan(&project.ID, &project.UserID, &project.Name, &project.Description, &project.Color, &project.EstimateUnit, &project.CreatedAt, &project.UpdatedAt)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
 		return
 	}
+	project.Role = role
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
 
 	c.JSON(http.StatusOK, project)
 }
 
 func (h *ProjectHandler) Delete(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	projectID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
 		return
 	}
 
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleOwner); !ok {
+		return
+	}
+
 	result, err := h.db.Pool.Exec(context.Background(),
-		"DELETE FROM projects WHERE id = $1 AND user_id = $2",
-		projectID, userID)
+		"DELETE FROM projects WHERE id = $1",
+		projectID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
@@ -185,4 +264,3 @@ func (h *ProjectHandler) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Project deleted successfully"})
 }
-
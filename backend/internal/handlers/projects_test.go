@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/config"
 	"github.com/mochammadshenna/4me-backend/internal/database"
 	"github.com/mochammadshenna/4me-backend/internal/models"
 	"github.com/stretchr/testify/assert"
@@ -48,7 +49,7 @@ func TestProjectCreate(t *testing.T) {
 	defer db.Close()
 
 	userID := createTestUser(t, db)
-	handler := NewProjectHandler(db)
+	handler := NewProjectHandler(db, &config.Config{})
 	router := setupProjectRouter(handler, userID)
 
 	t.Run("create project successfully", func(t *testing.T) {
@@ -88,6 +89,24 @@ func TestProjectCreate(t *testing.T) {
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
+
+	t.Run("create project over quota", func(t *testing.T) {
+		limited := setupProjectRouter(NewProjectHandler(db, &config.Config{MaxProjectsPerUser: 1}), userID)
+
+		body, _ := json.Marshal(models.CreateProjectRequest{Name: "One Too Many"})
+		req := httptest.NewRequest("POST", "/projects", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		limited.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Equal(t, models.ErrorCodeQuotaExceeded, resp["code"])
+		assert.Equal(t, models.QuotaProjectsPerUser, resp["quota"])
+	})
 }
 
 func TestProjectList(t *testing.T) {
@@ -95,7 +114,7 @@ func TestProjectList(t *testing.T) {
 	defer db.Close()
 
 	userID := createTestUser(t, db)
-	handler := NewProjectHandler(db)
+	handler := NewProjectHandler(db, &config.Config{})
 	router := setupProjectRouter(handler, userID)
 
 	// Create test projects
@@ -126,7 +145,7 @@ func TestProjectUpdate(t *testing.T) {
 	defer db.Close()
 
 	userID := createTestUser(t, db)
-	handler := NewProjectHandler(db)
+	handler := NewProjectHandler(db, &config.Config{})
 	router := setupProjectRouter(handler, userID)
 
 	var projectID int
@@ -163,7 +182,7 @@ func TestProjectDelete(t *testing.T) {
 	defer db.Close()
 
 	userID := createTestUser(t, db)
-	handler := NewProjectHandler(db)
+	handler := NewProjectHandler(db, &config.Config{})
 	router := setupProjectRouter(handler, userID)
 
 	var projectID int
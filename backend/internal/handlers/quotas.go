@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+// quotaExceeded writes the error response for a request that would exceed a
+// storage quota.
+func quotaExceeded(c *gin.Context, quota string, limit int64, message string) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": message,
+		"code":  models.ErrorCodeQuotaExceeded,
+		"quota": quota,
+		"limit": limit,
+	})
+}
+
+// checkProjectQuota checks that a user can create another project, and
+// writes the error response otherwise. It locks the user until tx ends, so
+// concurrent requests cannot both take the last project. A max of zero is
+// unlimited.
+func checkProjectQuota(c *gin.Context, ctx context.Context, tx pgx.Tx, userID, max int) bool {
+	if max <= 0 {
+		return true
+	}
+
+	var count int
+	err := tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM projects
+		 WHERE user_id = (SELECT id FROM users WHERE id = $1 FOR UPDATE)`,
+		userID).Scan(&count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if count >= max {
+		quotaExceeded(c, models.QuotaProjectsPerUser, int64(max),
+			fmt.Sprintf("You can create at most %d projects", max))
+		return false
+	}
+	return true
+}
+
+// checkTaskQuota checks that a board can hold adding more tasks, and writes
+// the error response otherwise. It locks the board until tx ends. A max of
+// zero is unlimited.
+func checkTaskQuota(c *gin.Context, ctx context.Context, tx pgx.Tx, boardID, adding, max int) bool {
+	if max <= 0 || adding == 0 {
+		return true
+	}
+
+	var count int
+	err := tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM tasks
+		 WHERE board_id = (SELECT id FROM boards WHERE id = $1 FOR UPDATE)`,
+		boardID).Scan(&count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if count+adding > max {
+		quotaExceeded(c, models.QuotaTasksPerBoard, int64(max),
+			fmt.Sprintf("A board can hold at most %d tasks", max))
+		return false
+	}
+	return true
+}
+
+// checkAttachmentQuota checks that a user can upload size more bytes of
+// attachments, and writes the error response otherwise. It locks the user
+// until tx ends, so the attachment must be saved in tx. A max of zero is
+// unlimited.
+func checkAttachmentQuota(c *gin.Context, ctx context.Context, tx pgx.Tx, userID int, size, max int64) bool {
+	if max <= 0 {
+		return true
+	}
+
+	var used int64
+	err := tx.QueryRow(ctx,
+		`SELECT COALESCE(SUM(size), 0) FROM attachments
+		 WHERE uploaded_by = (SELECT id FROM users WHERE id = $1 FOR UPDATE)`,
+		userID).Scan(&used)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if used+size > max {
+		quotaExceeded(c, models.QuotaAttachmentBytesPerUser, max,
+			fmt.Sprintf("This upload would exceed your attachment storage of %d bytes (%d used)", max, used))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/auth"
+	"github.com/mochammadshenna/4me-backend/internal/config"
+)
+
+type SessionHandler struct {
+	sessions *auth.Sessions
+	config   *config.Config
+}
+
+func NewSessionHandler(sessions *auth.Sessions, cfg *config.Config) *SessionHandler {
+	return &SessionHandler{
+		sessions: sessions,
+		config:   cfg,
+	}
+}
+
+func (h *SessionHandler) List(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	sessionID, _ := c.Get("sessionID")
+
+	sessions, err := h.sessions.List(context.Background(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == sessionID
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (h *SessionHandler) Revoke(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	revoked, err := h.sessions.Revoke(context.Background(), userID.(int), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// Logout revokes the session of the token used for the request.
+func (h *SessionHandler) Logout(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	sessionID, _ := c.Get("sessionID")
+
+	if _, err := h.sessions.Revoke(context.Background(), userID.(int), sessionID.(int)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	h.clearCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll revokes every session of the current user, including this one.
+func (h *SessionHandler) LogoutAll(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	count, err := h.sessions.RevokeAll(context.Background(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	h.clearCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions", "revoked": count})
+}
+
+// clearCookies removes the auth cookies in the cookie auth mode.
+func (h *SessionHandler) clearCookies(c *gin.Context) {
+	if h.config.CookieMode() {
+		auth.NewCookies(h.config).Clear(c.Writer)
+	}
+}
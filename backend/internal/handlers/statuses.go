@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/workflow"
+)
+
+const statusColumns = "id, project_id, key, name, category, position, created_at, updated_at"
+
+// StatusHandler manages the statuses of a project and the transitions
+// allowed between them. Task statuses are set through the task endpoints.
+type StatusHandler struct {
+	db *database.Database
+}
+
+func NewStatusHandler(db *database.Database) *StatusHandler {
+	return &StatusHandler{db: db}
+}
+
+// Workflow returns the statuses of a project in order with the allowed
+// transitions.
+func (h *StatusHandler) Workflow(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleViewer); !ok {
+		return
+	}
+
+	flow, ok := loadWorkflow(c, context.Background(), h.db.Pool, projectID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, workflowResponse(flow))
+}
+
+// Create adds a status after the project's other statuses.
+func (h *StatusHandler) Create(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleAdmin); !ok {
+		return
+	}
+
+	var req models.CreateStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !workflow.ValidKey(req.Key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status keys may only contain lowercase letters, digits and underscores"})
+		return
+	}
+
+	var status models.ProjectStatus
+	err = h.db.Pool.QueryRow(context.Background(),
+		`INSERT INTO project_statuses (project_id, key, name, category, position) 
+		 VALUES ($1, $2, $3, $4, (SELECT COALESCE(MAX(position) + 1, 0) FROM project_statuses WHERE project_id = $1)) 
+		 RETURNING `+statusColumns,
+		projectID, req.Key, req.Name, req.Category).
+		Scan(statusScanDest(&status)...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "The project already has a status with this key"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create status"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, status)
+}
+
+// Update renames, reorders or recategorizes a status. Tasks in the status,
+// except recurring ones, are marked completed or not to match its new
+// category, with a history entry. The key cannot change, as tasks refer to
+// it.
+func (h *StatusHandler) Update(c *gin.Context) {
+	statusID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status ID"})
+		return
+	}
+
+	if _, ok := authorizeStatus(c, h.db, statusID, models.RoleAdmin); !ok {
+		return
+	}
+
+	var req models.UpdateStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var status models.ProjectStatus
+	err = tx.QueryRow(ctx,
+		`SELECT `+statusColumns+` FROM project_statuses WHERE id = $1 FOR UPDATE`,
+		statusID).Scan(statusScanDest(&status)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	previousCategory := status.Category
+	if req.Name != nil {
+		status.Name = *req.Name
+	}
+	if req.Category != nil {
+		status.Category = *req.Category
+	}
+	if req.Position != nil {
+		status.Position = *req.Position
+	}
+
+	err = tx.QueryRow(ctx,
+		`UPDATE project_statuses SET name = $1, category = $2, position = $3 
+		 WHERE id = $4 
+		 RETURNING `+statusColumns,
+		status.Name, status.Category, status.Position, statusID).
+		Scan(statusScanDest(&status)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
+		return
+	}
+
+	// Recurring tasks keep their completed_at, as completing one makes the
+	// scheduler create its next instance
+	if (previousCategory == models.StatusCategoryDone) != (status.Category == models.StatusCategoryDone) {
+		completed := status.Category == models.StatusCategoryDone
+		rows, err := tx.Query(ctx,
+			`UPDATE tasks t SET completed_at = CASE WHEN $3::bool THEN NOW() END, updated_at = NOW() 
+			 FROM boards b 
+			 WHERE t.board_id = b.id AND b.project_id = $1 AND t.status = $2 AND t.recurrence_rule IS NULL 
+			 RETURNING t.id`,
+			status.ProjectID, status.Key, completed)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tasks"})
+			return
+		}
+		taskIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tasks"})
+			return
+		}
+
+		userID, _ := c.Get("userID")
+		for _, taskID := range taskIDs {
+			addTaskHistory(ctx, tx, taskID, userID, "status_recategorized", map[string]interface{}{
+				"status":            status.Key,
+				"previous_category": previousCategory,
+				"category":          status.Category,
+				"completed":         completed,
+			})
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Delete removes a status that no task uses, with its transitions. Boards
+// mapped to it are unmapped. A project keeps at least one status.
+func (h *StatusHandler) Delete(c *gin.Context) {
+	statusID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status ID"})
+		return
+	}
+
+	projectID, ok := authorizeStatus(c, h.db, statusID, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the project's statuses so concurrent deletes can't remove the
+	// last one
+	var key string
+	var statuses, tasks int
+	err = tx.QueryRow(ctx,
+		`SELECT s.key, 
+		        (SELECT COUNT(*) FROM (SELECT 1 FROM project_statuses WHERE project_id = $2 FOR UPDATE) locked), 
+		        (SELECT COUNT(*) FROM tasks t JOIN boards b ON t.board_id = b.id WHERE b.project_id = $2 AND t.status = s.key) 
+		 FROM project_statuses s WHERE s.id = $1`,
+		statusID, projectID).Scan(&key, &statuses, &tasks)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Status not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if statuses == 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A project needs at least one status"})
+		return
+	}
+	if tasks > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Move the " + strconv.Itoa(tasks) + " tasks in status " + key + " to another status first"})
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM project_statuses WHERE id = $1", statusID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete status"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Status deleted successfully"})
+}
+
+// UpdateTransitions replaces the transitions of a project and returns its
+// workflow. Without transitions, tasks can change between any statuses.
+func (h *StatusHandler) UpdateTransitions(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleAdmin); !ok {
+		return
+	}
+
+	var req models.UpdateTransitionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	flow, ok := loadWorkflow(c, ctx, tx, projectID)
+	if !ok {
+		return
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM status_transitions 
+		 WHERE from_status_id IN (SELECT id FROM project_statuses WHERE project_id = $1)`,
+		projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transitions"})
+		return
+	}
+
+	for _, t := range req.Transitions {
+		from, ok := flow.Status(t.From)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status " + t.From})
+			return
+		}
+		to, ok := flow.Status(t.To)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status " + t.To})
+			return
+		}
+		if from.ID == to.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A status cannot transition to itself"})
+			return
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO status_transitions (from_status_id, to_status_id) VALUES ($1, $2) 
+			 ON CONFLICT DO NOTHING`,
+			from.ID, to.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transitions"})
+			return
+		}
+	}
+
+	if flow, ok = loadWorkflow(c, ctx, tx, projectID); !ok {
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, workflowResponse(flow))
+}
+
+// loadWorkflow loads the workflow of a project, writing a 500 response when
+// it fails.
+func loadWorkflow(c *gin.Context, ctx context.Context, q querier, projectID int) (*workflow.Workflow, bool) {
+	flow, err := workflow.Load(ctx, q, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statuses"})
+		return nil, false
+	}
+	return flow, true
+}
+
+// checkTransition returns the status a task changes to, writing a 400
+// response for unknown statuses and a 409 for changes the workflow doesn't
+// allow.
+func checkTransition(c *gin.Context, flow *workflow.Workflow, from, to string) (models.ProjectStatus, bool) {
+	status, err := flow.Check(from, to)
+
+	var transitionErr *workflow.TransitionError
+	switch {
+	case errors.As(err, &transitionErr):
+		allowed := make([]string, len(transitionErr.Allowed))
+		for i, s := range transitionErr.Allowed {
+			allowed[i] = s.Key
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   err.Error(),
+			"code":    models.ErrorCodeInvalidTransition,
+			"from":    from,
+			"to":      to,
+			"allowed": allowed,
+		})
+		return status, false
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return status, false
+	}
+	return status, true
+}
+
+func workflowResponse(flow *workflow.Workflow) models.Workflow {
+	statuses := flow.Statuses
+	if statuses == nil {
+		statuses = []models.ProjectStatus{}
+	}
+	return models.Workflow{Statuses: statuses, Transitions: flow.Transitions()}
+}
+
+// statusScanDest returns the scan destinations matching statusColumns.
+func statusScanDest(status *models.ProjectStatus) []interface{} {
+	return []interface{}{&status.ID, &status.ProjectID, &status.Key, &status.Name, &status.Category, &status.Position, &status.CreatedAt, &status.UpdatedAt}
+}
@@ -3,41 +3,46 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/mochammadshenna/4me-backend/internal/config"
 	"github.com/mochammadshenna/4me-backend/internal/database"
 	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/recurrence"
+	"github.com/mochammadshenna/4me-backend/internal/taskquery"
 )
 
+// taskColumns is the column list scanned by taskScanDest. Queries using it
+// must alias the tasks table as "t".
+const taskColumns = "t.id, t.board_id, t.parent_task_id, t.title, t.description, t.status, t.priority, t.assignee_id, t.due_date, t.completed_at, t.original_estimate, t.remaining_estimate, t.position, t.created_at, t.updated_at, t.recurrence_rule, t.recur_after_completion, t.recurs_from_task_id"
+
 type TaskHandler struct {
-	db *database.Database
+	db     *database.Database
+	config *config.Config
 }
 
-func NewTaskHandler(db *database.Database) *TaskHandler {
-	return &TaskHandler{db: db}
+func NewTaskHandler(db *database.Database, cfg *config.Config) *TaskHandler {
+	return &TaskHandler{
+		db:     db,
+		config: cfg,
+	}
 }
 
 func (h *TaskHandler) Create(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	boardID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID"})
 		return
 	}
 
-	// Verify board ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT EXISTS(
-			SELECT 1 FROM boards b 
-			JOIN projects p ON b.project_id = p.id 
-			WHERE b.id = $1 AND p.user_id = $2
-		)`,
-		boardID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found"})
+	projectID, ok := authorizeBoard(c, h.db, boardID, models.RoleEditor)
+	if !ok {
 		return
 	}
 
@@ -47,11 +52,65 @@ func (h *TaskHandler) Create(c *gin.Context) {
 		return
 	}
 
-	if req.Priority == "" {
-		req.Priority = "medium"
+	h.createTask(c, projectID, boardID, nil, req)
+}
+
+// CreateSubtask creates a task under another task, on the parent's board.
+// Subtasks cannot have subtasks of their own.
+func (h *TaskHandler) CreateSubtask(c *gin.Context) {
+	parentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	projectID, ok := authorizeTask(c, h.db, parentID, models.RoleEditor)
+	if !ok {
+		return
 	}
 
+	var req models.CreateTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var boardID int
+	var grandparentID *int
+	err = h.db.Pool.QueryRow(context.Background(),
+		"SELECT board_id, parent_task_id FROM tasks WHERE id = $1",
+		parentID).Scan(&boardID, &grandparentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if grandparentID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Subtasks cannot have subtasks"})
+		return
+	}
+
+	h.createTask(c, projectID, boardID, &parentID, req)
+}
+
+// createTask inserts a task, or a subtask when parentID is set, and writes
+// the response.
+func (h *TaskHandler) createTask(c *gin.Context, projectID, boardID int, parentID *int, req models.CreateTaskRequest) {
+	userID, _ := c.Get("userID")
+
 	ctx := context.Background()
+	if req.AssigneeID != nil && !h.checkAssignee(c, ctx, projectID, *req.AssigneeID) {
+		return
+	}
+
+	var rule, ruleSetBy interface{}
+	if req.RecurrenceRule != nil && *req.RecurrenceRule != "" {
+		r, ok := parseRecurrenceRule(c, *req.RecurrenceRule, req.RecurAfterCompletion, &req.DueDate)
+		if !ok {
+			return
+		}
+		rule, ruleSetBy = r.String(), userID
+	}
+
 	tx, err := h.db.Pool.Begin(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
@@ -59,13 +118,55 @@ func (h *TaskHandler) Create(c *gin.Context) {
 	}
 	defer tx.Rollback(ctx)
 
+	if !checkTaskQuota(c, ctx, tx, boardID, 1, h.config.MaxTasksPerBoard) {
+		return
+	}
+
+	priority, ok := resolvePriority(c, ctx, tx, projectID, req.Priority)
+	if !ok {
+		return
+	}
+
+	// Tasks start in the status of their board, or in the project's initial
+	// status; subtasks always start in the initial status
+	flow, ok := loadWorkflow(c, ctx, tx, projectID)
+	if !ok {
+		return
+	}
+	status := flow.Initial()
+	if parentID == nil {
+		var boardStatusID *int
+		err = tx.QueryRow(ctx, "SELECT status_id FROM boards WHERE id = $1", boardID).Scan(&boardStatusID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if boardStatusID != nil {
+			if mapped, ok := flow.StatusByID(*boardStatusID); ok {
+				status = mapped
+			}
+		}
+	}
+
+	if req.RemainingEstimate == nil {
+		req.RemainingEstimate = req.OriginalEstimate
+	}
+	if req.RemainingEstimate != nil && !lockEstimateUnit(c, ctx, tx, projectID) {
+		return
+	}
+
 	var task models.Task
 	err = tx.QueryRow(ctx,
-		`INSERT INTO tasks (board_id, title, description, priority, assignee_id, due_date, status) 
-		 VALUES ($1, $2, $3, $4, $5, $6, 'todo') 
-		 RETURNING id, board_id, title, description, status, priority, assignee_id, due_date, position, created_at, updated_at`,
-		boardID, req.Title, req.Description, req.Priority, req.AssigneeID, req.DueDate).
-		Scan(&task.ID, &task.BoardID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.AssigneeID, &task.DueDate, &task.Position, &task.CreatedAt, &task.UpdatedAt)
+		`INSERT INTO tasks AS t (board_id, parent_task_id, subtask_position, title, description, priority, assignee_id, due_date, status, 
+		                         completed_at, original_estimate, remaining_estimate, recurrence_rule, recur_after_completion, recurrence_set_by) 
+		 VALUES ($1, $2::int, 
+		         (SELECT COALESCE(MAX(subtask_position) + 1, 0) FROM tasks WHERE parent_task_id = $2), 
+		         $3, $4, $5, $6, $7, $8, CASE WHEN $9::bool THEN NOW() END, $10, $11, $12, $13, $14) 
+		 RETURNING `+taskColumns,
+		boardID, parentID, req.Title, req.Description, priority, req.AssigneeID, req.DueDate,
+		status.Key, status.Category == models.StatusCategoryDone, req.OriginalEstimate, req.RemainingEstimate,
+		rule, req.RecurAfterCompletion, ruleSetBy).
+		Scan(taskScanDest(&task)...)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
@@ -74,23 +175,44 @@ func (h *TaskHandler) Create(c *gin.Context) {
 
 	// Add labels
 	if len(req.LabelIDs) > 0 {
-		for _, labelID := range req.LabelIDs {
-			_, err = tx.Exec(ctx, "INSERT INTO task_labels (task_id, label_id) VALUES ($1, $2)", task.ID, labelID)
-			if err != nil {
-				continue
-			}
+		if err := setTaskLabels(ctx, tx, task.ID, projectID, req.LabelIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add labels"})
+			return
 		}
 	}
 
+	customFields, ok := setCustomFieldValues(c, ctx, tx, projectID, task.ID, req.CustomFields)
+	if !ok {
+		return
+	}
+
 	// Add to history
 	changes := map[string]interface{}{
 		"action": "created",
 		"title":  req.Title,
+		"status": task.Status,
 	}
-	changesJSON, _ := json.Marshal(changes)
-	_, _ = tx.Exec(ctx,
-		"INSERT INTO task_history (task_id, user_id, action, changes_json) VALUES ($1, $2, $3, $4)",
-		task.ID, userID, "created", changesJSON)
+	if task.OriginalEstimate != nil {
+		changes["original_estimate"] = *task.OriginalEstimate
+	}
+	if task.RemainingEstimate != nil {
+		changes["remaining_estimate"] = *task.RemainingEstimate
+	}
+	if task.RecurrenceRule != nil {
+		changes["recurrence_rule"] = *task.RecurrenceRule
+		changes["recur_after_completion"] = task.RecurAfterCompletion
+	}
+	if len(customFields) > 0 {
+		changes["custom_fields"] = customFields
+	}
+	if parentID != nil {
+		changes["parent_task_id"] = *parentID
+		addTaskHistory(ctx, tx, *parentID, userID, "subtask_added", map[string]interface{}{
+			"subtask_id": task.ID,
+			"title":      task.Title,
+		})
+	}
+	addTaskHistory(ctx, tx, task.ID, userID, "created", changes)
 
 	if err = tx.Commit(ctx); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
@@ -101,62 +223,84 @@ func (h *TaskHandler) Create(c *gin.Context) {
 }
 
 func (h *TaskHandler) Get(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	taskID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
 		return
 	}
 
-	// Verify task ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT EXISTS(
-			SELECT 1 FROM tasks t 
-			JOIN boards b ON t.board_id = b.id 
-			JOIN projects p ON b.project_id = p.id 
-			WHERE t.id = $1 AND p.user_id = $2
-		)`,
-		taskID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleViewer); !ok {
 		return
 	}
 
 	var task models.Task
 	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT id, board_id, title, description, status, priority, assignee_id, due_date, position, created_at, updated_at 
-		 FROM tasks WHERE id = $1`,
+		`SELECT `+taskColumns+` FROM tasks t WHERE t.id = $1`,
 		taskID).
-		Scan(&task.ID, &task.BoardID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.AssigneeID, &task.DueDate, &task.Position, &task.CreatedAt, &task.UpdatedAt)
+		Scan(taskScanDest(&task)...)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
 
-	// Get labels
-	rows, err := h.db.Pool.Query(context.Background(),
-		`SELECT l.id, l.project_id, l.name, l.color, l.created_at 
-		 FROM labels l 
-		 JOIN task_labels tl ON l.id = tl.label_id 
-		 WHERE tl.task_id = $1`,
-		taskID)
-	if err == nil {
-		defer rows.Close()
-		task.Labels = []models.Label{}
-		for rows.Next() {
-			var label models.Label
-			if err := rows.Scan(&label.ID, &label.ProjectID, &label.Name, &label.Color, &label.CreatedAt); err == nil {
-				task.Labels = append(task.Labels, label)
-			}
+	// Get labels and counts
+	ctx := context.Background()
+	tasks := []models.Task{task}
+	if err := loadTaskRelations(ctx, h.db, tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task details"})
+		return
+	}
+
+	task = tasks[0]
+	if task.Checklist, err = loadChecklist(ctx, h.db.Pool, taskID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checklist"})
+		return
+	}
+	if task.Subtasks, err = h.loadSubtasks(ctx, taskID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subtasks"})
+		return
+	}
+
+	deps, err := loadDependencies(ctx, h.db.Pool, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dependencies"})
+		return
+	}
+	task.Blockers = []models.TaskRef{}
+	for _, dep := range deps {
+		if dep.Type == models.DependencyBlockedBy {
+			task.Blockers = append(task.Blockers, dep.Task)
 		}
 	}
 
 	c.JSON(http.StatusOK, task)
 }
 
-func (h *TaskHandler) Update(c *gin.Context) {
+// ListSubtasks returns the subtasks of a task in their order.
+func (h *TaskHandler) ListSubtasks(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleViewer); !ok {
+		return
+	}
+
+	subtasks, err := h.loadSubtasks(context.Background(), taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subtasks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, subtasks)
+}
+
+// ReorderSubtasks puts the subtasks of a task in the order of the given IDs,
+// which must list every subtask once.
+func (h *TaskHandler) ReorderSubtasks(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	taskID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -164,18 +308,284 @@ func (h *TaskHandler) Update(c *gin.Context) {
 		return
 	}
 
-	// Verify task ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT EXISTS(
-			SELECT 1 FROM tasks t 
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleEditor); !ok {
+		return
+	}
+
+	var req models.ReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if !reorder(c, ctx, tx, "tasks", "subtask_position", "parent_task_id", taskID, req.IDs) {
+		return
+	}
+
+	addTaskHistory(ctx, tx, taskID, userID, "subtasks_reordered", map[string]interface{}{
+		"subtask_ids": req.IDs,
+	})
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	subtasks, err := h.loadSubtasks(ctx, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subtasks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, subtasks)
+}
+
+// loadSubtasks returns the subtasks of a task with their relations.
+func (h *TaskHandler) loadSubtasks(ctx context.Context, taskID int) ([]models.Task, error) {
+	rows, err := h.db.Pool.Query(ctx,
+		`SELECT `+taskColumns+` FROM tasks t 
+		 WHERE t.parent_task_id = $1 
+		 ORDER BY t.subtask_position ASC, t.id ASC`,
+		taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subtasks := []models.Task{}
+	for rows.Next() {
+		var task models.Task
+		if err := rows.Scan(taskScanDest(&task)...); err != nil {
+			return nil, err
+		}
+		subtasks = append(subtasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadTaskRelations(ctx, h.db, subtasks); err != nil {
+		return nil, err
+	}
+	return subtasks, nil
+}
+
+func (h *TaskHandler) List(c *gin.Context) {
+	boardID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID"})
+		return
+	}
+
+	if _, ok := authorizeBoard(c, h.db, boardID, models.RoleViewer); !ok {
+		return
+	}
+
+	q, err := taskquery.Parse(c.Request.URL.Query(), "position")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !resolveCustomFieldFilters(c, context.Background(), h.db, q) {
+		return
+	}
+
+	b := taskquery.NewBuilder()
+	b.Where("t.board_id = " + b.Arg(boardID))
+
+	page, err := h.queryTaskPage(context.Background(), q, b)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// ListAll returns tasks across every project the user can access.
+func (h *TaskHandler) ListAll(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	q, err := taskquery.Parse(c.Request.URL.Query(), "-updated_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !resolveCustomFieldFilters(c, context.Background(), h.db, q) {
+		return
+	}
+
+	b := taskquery.NewBuilder()
+	b.Where("b.project_id IN (" + fmt.Sprintf(memberProjectsSQL, b.Arg(userID)) + ")")
+	if restricted, ok := tokenProject(c); ok {
+		b.Where("b.project_id = " + b.Arg(restricted))
+	}
+
+	page, err := h.queryTaskPage(context.Background(), q, b)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// ListByProject returns every board of a project with its tasks embedded,
+// so a project view can be rendered from a single request. Filters and sort
+// apply within each board and the limit is per board; each board carries
+// its own next_cursor for the board task list endpoint.
+func (h *TaskHandler) ListByProject(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, ok := authorizeProject(c, h.db, projectID, models.RoleViewer); !ok {
+		return
+	}
+
+	q, err := taskquery.Parse(c.Request.URL.Query(), "position")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !resolveCustomFieldFilters(c, context.Background(), h.db, q) {
+		return
+	}
+	if q.Cursor != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor is only supported when listing a single board's tasks"})
+		return
+	}
+
+	ctx := context.Background()
+	boardRows, err := h.db.Pool.Query(ctx,
+		`SELECT `+boardColumns+` 
+		 FROM boards WHERE project_id = $1 ORDER BY position ASC, id ASC`,
+		projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch boards"})
+		return
+	}
+	defer boardRows.Close()
+
+	boards := []models.BoardWithTasks{}
+	boardIndex := map[int]int{}
+	for boardRows.Next() {
+		var board models.BoardWithTasks
+		if err := boardRows.Scan(boardScanDest(&board.Board)...); err != nil {
+			continue
+		}
+		board.Tasks = []models.Task{}
+		boardIndex[board.ID] = len(boards)
+		boards = append(boards, board)
+	}
+	boardRows.Close()
+
+	b := taskquery.NewBuilder()
+	b.Where("b.project_id = " + b.Arg(projectID))
+	q.Apply(b)
+
+	// Fetch one extra task per board to know whether it has another page.
+	rows, err := h.db.Pool.Query(ctx,
+		`SELECT `+taskColumns+`, t.sort_key FROM (
+			SELECT t.*, (`+q.SortExpr()+`)::text AS sort_key,
+			       ROW_NUMBER() OVER (PARTITION BY t.board_id ORDER BY `+q.OrderBy()+`) AS rn
+			FROM tasks t 
 			JOIN boards b ON t.board_id = b.id 
-			JOIN projects p ON b.project_id = p.id 
-			WHERE t.id = $1 AND p.user_id = $2
-		)`,
-		taskID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			WHERE `+b.SQL()+`
+		 ) t 
+		 WHERE t.rn <= `+b.Arg(q.Limit+1)+` 
+		 ORDER BY t.board_id, t.rn`,
+		b.Args()...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+		return
+	}
+	tasks, sortKeys, err := scanTaskPage(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+		return
+	}
+
+	if err := loadTaskRelations(ctx, h.db, tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task details"})
+		return
+	}
+
+	for i, task := range tasks {
+		bi, ok := boardIndex[task.BoardID]
+		if !ok {
+			continue
+		}
+		board := &boards[bi]
+		if len(board.Tasks) == q.Limit {
+			last := board.Tasks[q.Limit-1]
+			cursor := q.NextCursor(sortKeys[i-1], last.ID)
+			board.NextCursor = &cursor
+			continue
+		}
+		board.Tasks = append(board.Tasks, task)
+	}
+
+	c.JSON(http.StatusOK, boards)
+}
+
+// queryTaskPage runs a filtered task query scoped by the conditions already
+// in b and returns one page of tasks with their relations loaded.
+func (h *TaskHandler) queryTaskPage(ctx context.Context, q *taskquery.Query, b *taskquery.Builder) (models.TaskPage, error) {
+	q.Apply(b)
+	q.ApplyCursor(b)
+
+	// Fetch one extra task to know whether there is another page.
+	rows, err := h.db.Pool.Query(ctx,
+		`SELECT `+taskColumns+`, (`+q.SortExpr()+`)::text 
+		 FROM tasks t 
+		 JOIN boards b ON t.board_id = b.id 
+		 WHERE `+b.SQL()+` 
+		 ORDER BY `+q.OrderBy()+` 
+		 LIMIT `+b.Arg(q.Limit+1),
+		b.Args()...)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+	tasks, sortKeys, err := scanTaskPage(rows)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+
+	page := models.TaskPage{Tasks: tasks}
+	if len(tasks) > q.Limit {
+		page.Tasks = tasks[:q.Limit]
+		cursor := q.NextCursor(sortKeys[q.Limit-1], tasks[q.Limit-1].ID)
+		page.NextCursor = &cursor
+	}
+
+	if err := loadTaskRelations(ctx, h.db, page.Tasks); err != nil {
+		return models.TaskPage{}, err
+	}
+
+	return page, nil
+}
+
+func (h *TaskHandler) Update(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	projectID, ok := authorizeTask(c, h.db, taskID, models.RoleEditor)
+	if !ok {
 		return
 	}
 
@@ -186,6 +596,10 @@ func (h *TaskHandler) Update(c *gin.Context) {
 	}
 
 	ctx := context.Background()
+	if req.AssigneeID != nil && !h.checkAssignee(c, ctx, projectID, *req.AssigneeID) {
+		return
+	}
+
 	tx, err := h.db.Pool.Begin(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
@@ -193,11 +607,98 @@ func (h *TaskHandler) Update(c *gin.Context) {
 	}
 	defer tx.Rollback(ctx)
 
-	query := "UPDATE tasks SET updated_at = NOW()"
+	query := "UPDATE tasks t SET updated_at = NOW()"
 	args := []interface{}{}
 	argCount := 1
 	changes := map[string]interface{}{}
 
+	// Recurrence changes are recorded in their own history entry
+	var recurrenceChanges map[string]interface{}
+	if req.RecurrenceRule != nil || req.RecurAfterCompletion != nil {
+		var dueDate *time.Time
+		var rule *string
+		var afterCompletion bool
+		err := tx.QueryRow(ctx,
+			"SELECT due_date, recurrence_rule, recur_after_completion FROM tasks WHERE id = $1 FOR UPDATE",
+			taskID).Scan(&dueDate, &rule, &afterCompletion)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		recurrenceChanges = map[string]interface{}{"previous_rule": rule}
+		if req.RecurrenceRule != nil {
+			rule = nil
+			if *req.RecurrenceRule != "" {
+				canonical := *req.RecurrenceRule
+				rule = &canonical
+			}
+		}
+		if req.RecurAfterCompletion != nil {
+			afterCompletion = *req.RecurAfterCompletion
+		}
+		if req.DueDate != nil {
+			dueDate = req.DueDate
+		}
+
+		if rule != nil {
+			due := dueDate
+			r, ok := parseRecurrenceRule(c, *rule, afterCompletion, &due)
+			if !ok {
+				return
+			}
+			*rule = r.String()
+			if dueDate == nil && due != nil {
+				req.DueDate = due
+			}
+		}
+
+		query += ", recurrence_rule = $" + strconv.Itoa(argCount) +
+			", recur_after_completion = $" + strconv.Itoa(argCount+1) +
+			", recurrence_set_by = $" + strconv.Itoa(argCount+2)
+		args = append(args, rule, afterCompletion, userID)
+		argCount += 3
+		recurrenceChanges["recurrence_rule"] = rule
+		recurrenceChanges["recur_after_completion"] = afterCompletion
+	}
+
+	// Estimate changes are recorded in their own history entry, so that
+	// their drift can be followed. Setting the first original estimate also
+	// sets the remaining one.
+	var estimateChanges map[string]interface{}
+	if req.OriginalEstimate != nil || req.RemainingEstimate != nil {
+		if !lockEstimateUnit(c, ctx, tx, projectID) {
+			return
+		}
+
+		var original, remaining *float64
+		err := tx.QueryRow(ctx,
+			"SELECT original_estimate, remaining_estimate FROM tasks WHERE id = $1 FOR UPDATE",
+			taskID).Scan(&original, &remaining)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		estimateChanges = map[string]interface{}{
+			"previous_original_estimate":  original,
+			"previous_remaining_estimate": remaining,
+		}
+
+		if req.OriginalEstimate != nil {
+			query += ", original_estimate = $" + strconv.Itoa(argCount)
+			args = append(args, *req.OriginalEstimate)
+			argCount++
+			if req.RemainingEstimate == nil && remaining == nil {
+				req.RemainingEstimate = req.OriginalEstimate
+			}
+		}
+		if req.RemainingEstimate != nil {
+			query += ", remaining_estimate = $" + strconv.Itoa(argCount)
+			args = append(args, *req.RemainingEstimate)
+			argCount++
+		}
+	}
+
 	if req.Title != nil {
 		query += ", title = $" + strconv.Itoa(argCount)
 		args = append(args, *req.Title)
@@ -211,15 +712,35 @@ func (h *TaskHandler) Update(c *gin.Context) {
 		argCount++
 	}
 	if req.Status != nil {
-		query += ", status = $" + strconv.Itoa(argCount)
-		args = append(args, *req.Status)
-		changes["status"] = *req.Status
-		argCount++
+		var current string
+		err := tx.QueryRow(ctx, "SELECT status FROM tasks WHERE id = $1 FOR UPDATE", taskID).Scan(&current)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		flow, ok := loadWorkflow(c, ctx, tx, projectID)
+		if !ok {
+			return
+		}
+		status, ok := checkTransition(c, flow, current, *req.Status)
+		if !ok {
+			return
+		}
+
+		query += ", status = $" + strconv.Itoa(argCount) +
+			", completed_at = CASE WHEN $" + strconv.Itoa(argCount+1) + "::bool THEN COALESCE(t.completed_at, NOW()) END"
+		args = append(args, status.Key, status.Category == models.StatusCategoryDone)
+		changes["status"] = status.Key
+		argCount += 2
 	}
 	if req.Priority != nil {
+		priority, ok := resolvePriority(c, ctx, tx, projectID, *req.Priority)
+		if !ok {
+			return
+		}
 		query += ", priority = $" + strconv.Itoa(argCount)
-		args = append(args, *req.Priority)
-		changes["priority"] = *req.Priority
+		args = append(args, priority)
+		changes["priority"] = priority
 		argCount++
 	}
 	if req.AssigneeID != nil {
@@ -242,11 +763,11 @@ func (h *TaskHandler) Update(c *gin.Context) {
 
 	query += " WHERE id = $" + strconv.Itoa(argCount)
 	args = append(args, taskID)
-	query += " RETURNING id, board_id, title, description, status, priority, assignee_id, due_date, position, created_at, updated_at"
+	query += " RETURNING " + taskColumns
 
 	var task models.Task
 	err = tx.QueryRow(ctx, query, args...).
-		Scan(&task.ID, &task.BoardID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.AssigneeID, &task.DueDate, &task.Position, &task.CreatedAt, &task.UpdatedAt)
+		Scan(taskScanDest(&task)...)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
@@ -256,18 +777,32 @@ func (h *TaskHandler) Update(c *gin.Context) {
 	// Update labels if provided
 	if req.LabelIDs != nil {
 		_, _ = tx.Exec(ctx, "DELETE FROM task_labels WHERE task_id = $1", taskID)
-		for _, labelID := range req.LabelIDs {
-			_, _ = tx.Exec(ctx, "INSERT INTO task_labels (task_id, label_id) VALUES ($1, $2)", taskID, labelID)
+		if err := setTaskLabels(ctx, tx, taskID, projectID, req.LabelIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update labels"})
+			return
 		}
 		changes["labels"] = req.LabelIDs
 	}
 
+	customFields, ok := setCustomFieldValues(c, ctx, tx, projectID, taskID, req.CustomFields)
+	if !ok {
+		return
+	}
+	if len(customFields) > 0 {
+		changes["custom_fields"] = customFields
+	}
+
 	// Add to history
 	if len(changes) > 0 {
-		changesJSON, _ := json.Marshal(changes)
-		_, _ = tx.Exec(ctx,
-			"INSERT INTO task_history (task_id, user_id, action, changes_json) VALUES ($1, $2, $3, $4)",
-			taskID, userID, "updated", changesJSON)
+		addTaskHistory(ctx, tx, taskID, userID, "updated", changes)
+	}
+	if recurrenceChanges != nil {
+		addTaskHistory(ctx, tx, taskID, userID, "recurrence_updated", recurrenceChanges)
+	}
+	if estimateChanges != nil {
+		estimateChanges["original_estimate"] = task.OriginalEstimate
+		estimateChanges["remaining_estimate"] = task.RemainingEstimate
+		addTaskHistory(ctx, tx, taskID, userID, "estimate_updated", estimateChanges)
 	}
 
 	if err = tx.Commit(ctx); err != nil {
@@ -286,12 +821,27 @@ func (h *TaskHandler) Move(c *gin.Context) {
 		return
 	}
 
+	projectID, ok := authorizeTask(c, h.db, taskID, models.RoleEditor)
+	if !ok {
+		return
+	}
+
 	var req models.MoveTaskRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Tasks can only move between boards of the same project
+	var boardStatusID *int
+	err = h.db.Pool.QueryRow(context.Background(),
+		"SELECT status_id FROM boards WHERE id = $1 AND project_id = $2",
+		req.BoardID, projectID).Scan(&boardStatusID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target board not found in this project"})
+		return
+	}
+
 	ctx := context.Background()
 	tx, err := h.db.Pool.Begin(ctx)
 	if err != nil {
@@ -300,33 +850,96 @@ func (h *TaskHandler) Move(c *gin.Context) {
 	}
 	defer tx.Rollback(ctx)
 
-	// Verify ownership and update
+	// Subtasks on the task's board move along with it; subtasks that were
+	// moved to other boards stay there
+	var fromBoardID int
+	var currentStatus string
+	err = tx.QueryRow(ctx,
+		"SELECT board_id, status FROM tasks WHERE id = $1 FOR UPDATE",
+		taskID).Scan(&fromBoardID, &currentStatus)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+
+	// Moving to a board mapped to a status changes the task to that status,
+	// if the workflow allows it. Subtasks keep their own status.
+	status := models.ProjectStatus{Key: currentStatus}
+	statusChanged := false
+	if boardStatusID != nil {
+		flow, ok := loadWorkflow(c, ctx, tx, projectID)
+		if !ok {
+			return
+		}
+		if mapped, ok := flow.StatusByID(*boardStatusID); ok && mapped.Key != currentStatus {
+			if status, ok = checkTransition(c, flow, currentStatus, mapped.Key); !ok {
+				return
+			}
+			statusChanged = true
+		}
+	}
+
+	var subtaskIDs []int
+	if fromBoardID != req.BoardID {
+		rows, err := tx.Query(ctx,
+			"SELECT id FROM tasks WHERE parent_task_id = $1 AND board_id = $2 FOR UPDATE",
+			taskID, fromBoardID)
+		if err == nil {
+			subtaskIDs, err = pgx.CollectRows(rows, pgx.RowTo[int])
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subtasks"})
+			return
+		}
+
+		if !checkTaskQuota(c, ctx, tx, req.BoardID, 1+len(subtaskIDs), h.config.MaxTasksPerBoard) {
+			return
+		}
+	}
+
 	var task models.Task
 	err = tx.QueryRow(ctx,
-		`UPDATE tasks SET board_id = $1, position = $2, updated_at = NOW() 
-		 WHERE id = $3 AND board_id IN (
-			 SELECT b.id FROM boards b 
-			 JOIN projects p ON b.project_id = p.id 
-			 WHERE p.user_id = $4
-		 )
-		 RETURNING id, board_id, title, description, status, priority, assignee_id, due_date, position, created_at, updated_at`,
-		req.BoardID, req.Position, taskID, userID).
-		Scan(&task.ID, &task.BoardID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.AssigneeID, &task.DueDate, &task.Position, &task.CreatedAt, &task.UpdatedAt)
+		`UPDATE tasks t SET board_id = $1, position = $2, updated_at = NOW(), status = $4, 
+		        completed_at = CASE WHEN NOT $5::bool THEN t.completed_at 
+		                            WHEN $6::bool THEN COALESCE(t.completed_at, NOW()) END 
+		 WHERE t.id = $3 
+		 RETURNING `+taskColumns,
+		req.BoardID, req.Position, taskID, status.Key, statusChanged, status.Category == models.StatusCategoryDone).
+		Scan(taskScanDest(&task)...)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found or unauthorized"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
 
+	if len(subtaskIDs) > 0 {
+		_, err = tx.Exec(ctx,
+			"UPDATE tasks SET board_id = $1, updated_at = NOW() WHERE id = ANY($2)",
+			req.BoardID, subtaskIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move subtasks"})
+			return
+		}
+		for _, subtaskID := range subtaskIDs {
+			addTaskHistory(ctx, tx, subtaskID, userID, "moved", map[string]interface{}{
+				"board_id":       req.BoardID,
+				"parent_task_id": taskID,
+			})
+		}
+	}
+
 	// Add to history
 	changes := map[string]interface{}{
 		"board_id": req.BoardID,
 		"position": req.Position,
 	}
-	changesJSON, _ := json.Marshal(changes)
-	_, _ = tx.Exec(ctx,
-		"INSERT INTO task_history (task_id, user_id, action, changes_json) VALUES ($1, $2, $3, $4)",
-		taskID, userID, "moved", changesJSON)
+	if len(subtaskIDs) > 0 {
+		changes["subtask_ids"] = subtaskIDs
+	}
+	if statusChanged {
+		changes["status"] = status.Key
+	}
+	addTaskHistory(ctx, tx, taskID, userID, "moved", changes)
 
 	if err = tx.Commit(ctx); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
@@ -336,6 +949,8 @@ func (h *TaskHandler) Move(c *gin.Context) {
 	c.JSON(http.StatusOK, task)
 }
 
+// Delete deletes a task together with its subtasks, and records the removal
+// in the history of its parent when it is a subtask.
 func (h *TaskHandler) Delete(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	taskID, err := strconv.Atoi(c.Param("id"))
@@ -344,48 +959,55 @@ func (h *TaskHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	result, err := h.db.Pool.Exec(context.Background(),
-		`DELETE FROM tasks 
-		 WHERE id = $1 AND board_id IN (
-			 SELECT b.id FROM boards b 
-			 JOIN projects p ON b.project_id = p.id 
-			 WHERE p.user_id = $2
-		 )`,
-		taskID, userID)
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleEditor); !ok {
+		return
+	}
 
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
 		return
 	}
+	defer tx.Rollback(ctx)
 
-	if result.RowsAffected() == 0 {
+	var parentID *int
+	var title string
+	err = tx.QueryRow(ctx,
+		"DELETE FROM tasks WHERE id = $1 RETURNING parent_task_id, title",
+		taskID).Scan(&parentID, &title)
+	if errors.Is(err, pgx.ErrNoRows) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task"})
+		return
+	}
+
+	if parentID != nil {
+		addTaskHistory(ctx, tx, *parentID, userID, "subtask_removed", map[string]interface{}{
+			"subtask_id": taskID,
+			"title":      title,
+		})
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Task deleted successfully"})
 }
 
 func (h *TaskHandler) GetHistory(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	taskID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
 		return
 	}
 
-	// Verify task ownership
-	var exists bool
-	err = h.db.Pool.QueryRow(context.Background(),
-		`SELECT EXISTS(
-			SELECT 1 FROM tasks t 
-			JOIN boards b ON t.board_id = b.id 
-			JOIN projects p ON b.project_id = p.id 
-			WHERE t.id = $1 AND p.user_id = $2
-		)`,
-		taskID, userID).Scan(&exists)
-	if err != nil || !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleViewer); !ok {
 		return
 	}
 
@@ -426,3 +1048,228 @@ func (h *TaskHandler) GetHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, history)
 }
 
+// checkAssignee verifies that a task assignee is a member of the project and
+// writes a 400 response when it is not.
+func (h *TaskHandler) checkAssignee(c *gin.Context, ctx context.Context, projectID, assigneeID int) bool {
+	member, err := isProjectMember(ctx, h.db.Pool, projectID, assigneeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !member {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee must be a member of the project"})
+		return false
+	}
+	return true
+}
+
+// parseRecurrenceRule parses a recurrence rule, writing a 400 response when
+// it is invalid. Tasks repeating on a schedule need a due date; when
+// *dueDate is nil, it is set to the first occurrence from today.
+func parseRecurrenceRule(c *gin.Context, rule string, afterCompletion bool, dueDate **time.Time) (*recurrence.Rule, bool) {
+	r, err := recurrence.Parse(rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recurrence rule: " + err.Error()})
+		return nil, false
+	}
+
+	if !afterCompletion && *dueDate == nil {
+		first, ok := r.First(time.Now().UTC())
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Recurrence rule has no occurrences left"})
+			return nil, false
+		}
+		*dueDate = &first
+	}
+	return r, true
+}
+
+// setTaskLabels attaches labels to a task, ignoring labels that belong to a
+// different project.
+func setTaskLabels(ctx context.Context, q querier, taskID, projectID int, labelIDs []int) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO task_labels (task_id, label_id) 
+		 SELECT $1, id FROM labels WHERE id = ANY($2) AND project_id = $3 
+		 ON CONFLICT DO NOTHING`,
+		taskID, labelIDs, projectID)
+	return err
+}
+
+// taskScanDest returns the scan destinations matching taskColumns.
+func taskScanDest(task *models.Task) []interface{} {
+	return []interface{}{&task.ID, &task.BoardID, &task.ParentTaskID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.AssigneeID, &task.DueDate, &task.CompletedAt, &task.OriginalEstimate, &task.RemainingEstimate, &task.Position, &task.CreatedAt, &task.UpdatedAt, &task.RecurrenceRule, &task.RecurAfterCompletion, &task.RecursFromTaskID}
+}
+
+// scanTaskPage scans rows selecting taskColumns followed by the sort key
+// used to build pagination cursors.
+func scanTaskPage(rows pgx.Rows) ([]models.Task, []string, error) {
+	defer rows.Close()
+
+	tasks := []models.Task{}
+	sortKeys := []string{}
+	for rows.Next() {
+		var task models.Task
+		var sortKey string
+		if err := rows.Scan(append(taskScanDest(&task), &sortKey)...); err != nil {
+			return nil, nil, err
+		}
+		tasks = append(tasks, task)
+		sortKeys = append(sortKeys, sortKey)
+	}
+
+	return tasks, sortKeys, rows.Err()
+}
+
+// loadTaskRelations fills in labels, custom field values, comment and
+// attachment counts, progress, blocked status and time spent for the given
+// tasks using one query per relation instead of one per task.
+func loadTaskRelations(ctx context.Context, db *database.Database, tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	taskIDs := make([]int, len(tasks))
+	index := make(map[int]int, len(tasks))
+	for i := range tasks {
+		taskIDs[i] = tasks[i].ID
+		index[tasks[i].ID] = i
+		tasks[i].Labels = []models.Label{}
+	}
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT tl.task_id, l.id, l.project_id, l.name, l.color, l.created_at 
+		 FROM labels l 
+		 JOIN task_labels tl ON l.id = tl.label_id 
+		 WHERE tl.task_id = ANY($1) 
+		 ORDER BY l.name ASC`,
+		taskIDs)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var taskID int
+		var label models.Label
+		if err := rows.Scan(&taskID, &label.ID, &label.ProjectID, &label.Name, &label.Color, &label.CreatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		tasks[index[taskID]].Labels = append(tasks[index[taskID]].Labels, label)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Pool.Query(ctx,
+		"SELECT task_id, field_id, value FROM task_custom_field_values WHERE task_id = ANY($1)",
+		taskIDs)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var taskID, fieldID int
+		var value interface{}
+		if err := rows.Scan(&taskID, &fieldID, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		task := &tasks[index[taskID]]
+		if task.CustomFields == nil {
+			task.CustomFields = map[int]interface{}{}
+		}
+		task.CustomFields[fieldID] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Pool.Query(ctx,
+		`SELECT task_id, 
+		        (SELECT COUNT(*) FROM comments c WHERE c.task_id = ids.task_id), 
+		        (SELECT COUNT(*) FROM attachments a WHERE a.task_id = ids.task_id), 
+		        (SELECT COUNT(*) FILTER (WHERE ci.done) FROM checklist_items ci WHERE ci.task_id = ids.task_id), 
+		        (SELECT COUNT(*) FROM checklist_items ci WHERE ci.task_id = ids.task_id), 
+		        (SELECT COUNT(*) FILTER (WHERE s.completed_at IS NOT NULL) FROM tasks s WHERE s.parent_task_id = ids.task_id), 
+		        (SELECT COUNT(*) FROM tasks s WHERE s.parent_task_id = ids.task_id), 
+		        EXISTS(SELECT 1 FROM task_dependencies d JOIN tasks bt ON d.task_id = bt.id 
+		               WHERE d.target_task_id = ids.task_id AND d.type = $2 AND bt.completed_at IS NULL), 
+		        (SELECT COALESCE(SUM(EXTRACT(EPOCH FROM COALESCE(te.ended_at, `+utcNowSQL+`) - te.started_at)), 0)::bigint 
+		         FROM time_entries te WHERE te.task_id = ids.task_id) 
+		 FROM UNNEST($1::int[]) AS ids(task_id)`,
+		taskIDs, models.DependencyBlocks)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var taskID, comments, attachments, timeSpent int
+		var progress models.TaskProgress
+		var blocked bool
+		err := rows.Scan(&taskID, &comments, &attachments,
+			&progress.ChecklistDone, &progress.ChecklistTotal, &progress.SubtasksDone, &progress.SubtasksTotal, &blocked, &timeSpent)
+		if err != nil {
+			return err
+		}
+		if total := progress.ChecklistTotal + progress.SubtasksTotal; total > 0 {
+			progress.Percent = (progress.ChecklistDone + progress.SubtasksDone) * 100 / total
+		}
+		tasks[index[taskID]].CommentCount = comments
+		tasks[index[taskID]].AttachmentCount = attachments
+		tasks[index[taskID]].Progress = progress
+		tasks[index[taskID]].IsBlocked = blocked
+		tasks[index[taskID]].TimeSpentSeconds = timeSpent
+	}
+
+	return rows.Err()
+}
+
+// addTaskHistory records a change to a task. Failures are ignored, as the
+// change itself matters more than its history entry.
+func addTaskHistory(ctx context.Context, q querier, taskID int, userID interface{}, action string, changes map[string]interface{}) {
+	changesJSON, _ := json.Marshal(changes)
+	_, _ = q.Exec(ctx,
+		"INSERT INTO task_history (task_id, user_id, action, changes_json) VALUES ($1, $2, $3, $4)",
+		taskID, userID, action, changesJSON)
+}
+
+// reorder sets the position column of the rows of table whose parent column
+// is parentID to the order of ids, which must list each of them once. It
+// writes a 400 response when ids doesn't match the rows.
+func reorder(c *gin.Context, ctx context.Context, tx pgx.Tx, table, position, parent string, parentID int, ids []int) bool {
+	rows, err := tx.Query(ctx,
+		`SELECT id FROM `+table+` WHERE `+parent+` = $1 FOR UPDATE`,
+		parentID)
+	var current []int
+	if err == nil {
+		current, err = pgx.CollectRows(rows, pgx.RowTo[int])
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	valid := len(seen) == len(ids) && len(ids) == len(current)
+	for _, id := range current {
+		valid = valid && seen[id]
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids must list every item exactly once"})
+		return false
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE `+table+` r SET `+position+` = o.ord - 1 
+		 FROM UNNEST($1::int[]) WITH ORDINALITY AS o(id, ord) 
+		 WHERE r.id = o.id`,
+		ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,504 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/timesheet"
+)
+
+// timeEntryColumns is the column list scanned by timeEntryScanDest. Queries
+// using it must alias the time_entries table as "e". Running entries count
+// up to now.
+const timeEntryColumns = "e.id, e.task_id, e.user_id, e.started_at, e.ended_at, " +
+	"EXTRACT(EPOCH FROM COALESCE(e.ended_at, " + utcNowSQL + ") - e.started_at)::bigint, e.note, e.created_at, e.updated_at"
+
+// utcNowSQL is the current time as a UTC timestamp. Entry times are stored
+// in UTC whatever the database time zone is, so the timesheet buckets them
+// by the same day for every entry.
+const utcNowSQL = "(NOW() AT TIME ZONE 'UTC')"
+
+// maxTimeEntryDuration is the longest entry that can be logged by hand.
+// Timers are not limited, as a forgotten timer may run for longer.
+const maxTimeEntryDuration = 24 * time.Hour
+
+// TimeEntryHandler logs the time users spend on tasks, by hand or with
+// timers, and reports it in timesheets. Each user runs at most one timer.
+type TimeEntryHandler struct {
+	db *database.Database
+}
+
+func NewTimeEntryHandler(db *database.Database) *TimeEntryHandler {
+	return &TimeEntryHandler{db: db}
+}
+
+// Create logs time on a task by hand.
+func (h *TimeEntryHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleEditor); !ok {
+		return
+	}
+
+	var req models.CreateTimeEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.StartedAt = req.StartedAt.UTC()
+	req.EndedAt = utcTime(req.EndedAt)
+
+	endedAt, ok := timeEntryEnd(c, req.StartedAt, req.EndedAt, req.DurationSeconds)
+	if !ok {
+		return
+	}
+
+	var entry models.TimeEntry
+	err = h.db.Pool.QueryRow(context.Background(),
+		`INSERT INTO time_entries AS e (task_id, user_id, started_at, ended_at, note) 
+		 VALUES ($1, $2, $3, $4, $5) 
+		 RETURNING `+timeEntryColumns,
+		taskID, userID, req.StartedAt, endedAt, req.Note).
+		Scan(timeEntryScanDest(&entry)...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23514" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The end must be after the start"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create time entry"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// List returns the time entries of a task, latest first.
+func (h *TimeEntryHandler) List(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleViewer); !ok {
+		return
+	}
+
+	rows, err := h.db.Pool.Query(context.Background(),
+		`SELECT `+timeEntryColumns+`, u.id, u.username, u.email, u.avatar_url 
+		 FROM time_entries e 
+		 JOIN users u ON e.user_id = u.id 
+		 WHERE e.task_id = $1 
+		 ORDER BY e.started_at DESC, e.id DESC`,
+		taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch time entries"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.TimeEntry{}
+	for rows.Next() {
+		var entry models.TimeEntry
+		var user models.User
+		dest := append(timeEntryScanDest(&entry), &user.ID, &user.Username, &user.Email, &user.AvatarURL)
+		if err := rows.Scan(dest...); err != nil {
+			continue
+		}
+		entry.User = &user
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// Update changes the times or note of an entry. Users can change their own
+// entries, admins any entry. Setting ended_at on a running entry stops it.
+func (h *TimeEntryHandler) Update(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time entry ID"})
+		return
+	}
+
+	var req models.UpdateTimeEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.StartedAt = utcTime(req.StartedAt)
+	req.EndedAt = utcTime(req.EndedAt)
+
+	_, role, ok := authorizeTimeEntry(c, h.db, entryID, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var entry models.TimeEntry
+	err = tx.QueryRow(ctx,
+		`SELECT `+timeEntryColumns+` FROM time_entries e 
+		 WHERE e.id = $1 AND (e.user_id = $2 OR $3) 
+		 FOR UPDATE`,
+		entryID, userID, role.AtLeast(models.RoleAdmin)).Scan(timeEntryScanDest(&entry)...)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time entry not found or unauthorized"})
+		return
+	}
+
+	if req.StartedAt != nil {
+		entry.StartedAt = *req.StartedAt
+	}
+	if req.Note != nil {
+		entry.Note = req.Note
+	}
+	endedAt := entry.EndedAt
+	if req.EndedAt != nil || req.DurationSeconds != nil || (req.StartedAt != nil && endedAt != nil) {
+		end := req.EndedAt
+		duration := req.DurationSeconds
+		if end == nil && duration == nil {
+			// Moving the start of a finished entry keeps its duration
+			duration = &entry.DurationSeconds
+		}
+		if endedAt, ok = timeEntryEnd(c, entry.StartedAt, end, duration); !ok {
+			return
+		}
+	}
+	if endedAt == nil && req.StartedAt != nil {
+		// A running entry's duration counts up to now, so it cannot start later
+		var future bool
+		if err = tx.QueryRow(ctx, "SELECT $1::timestamp > "+utcNowSQL, entry.StartedAt).Scan(&future); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update time entry"})
+			return
+		}
+		if future {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A running timer cannot start in the future"})
+			return
+		}
+	}
+
+	err = tx.QueryRow(ctx,
+		`UPDATE time_entries e SET started_at = $1, ended_at = $2, note = $3 
+		 WHERE e.id = $4 
+		 RETURNING `+timeEntryColumns,
+		entry.StartedAt, endedAt, entry.Note, entryID).
+		Scan(timeEntryScanDest(&entry)...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23514" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The end must be after the start"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update time entry"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// Delete removes an entry. Users can delete their own entries, admins any
+// entry.
+func (h *TimeEntryHandler) Delete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time entry ID"})
+		return
+	}
+
+	_, role, ok := authorizeTimeEntry(c, h.db, entryID, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	result, err := h.db.Pool.Exec(context.Background(),
+		"DELETE FROM time_entries WHERE id = $1 AND (user_id = $2 OR $3)",
+		entryID, userID, role.AtLeast(models.RoleAdmin))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete time entry"})
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time entry not found or unauthorized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Time entry deleted successfully"})
+}
+
+// StartTimer starts a timer on a task. It conflicts while the user has
+// another timer running, returning that timer's entry.
+func (h *TimeEntryHandler) StartTimer(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleEditor); !ok {
+		return
+	}
+
+	var req models.StartTimerRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx := context.Background()
+	var entry models.TimeEntry
+	err = h.db.Pool.QueryRow(ctx,
+		`INSERT INTO time_entries AS e (task_id, user_id, started_at, note) 
+		 VALUES ($1, $2, `+utcNowSQL+`, $3) 
+		 RETURNING `+timeEntryColumns,
+		taskID, userID, req.Note).
+		Scan(timeEntryScanDest(&entry)...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start timer"})
+			return
+		}
+
+		var running models.TimeEntry
+		err = h.db.Pool.QueryRow(ctx,
+			`SELECT `+timeEntryColumns+` FROM time_entries e WHERE e.user_id = $1 AND e.ended_at IS NULL`,
+			userID).Scan(timeEntryScanDest(&running)...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start timer"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      fmt.Sprintf("Stop the timer running on task %d first", running.TaskID),
+			"code":       models.ErrorCodeTimerRunning,
+			"time_entry": running,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// StopTimer stops the user's timer on a task.
+func (h *TimeEntryHandler) StopTimer(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, ok := authorizeTask(c, h.db, taskID, models.RoleEditor); !ok {
+		return
+	}
+
+	// A timer stopped in the second it started still lasts a second
+	var entry models.TimeEntry
+	err = h.db.Pool.QueryRow(context.Background(),
+		`UPDATE time_entries e SET ended_at = GREATEST(`+utcNowSQL+`, e.started_at + INTERVAL '1 second') 
+		 WHERE e.task_id = $1 AND e.user_id = $2 AND e.ended_at IS NULL 
+		 RETURNING `+timeEntryColumns,
+		taskID, userID).
+		Scan(timeEntryScanDest(&entry)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No timer is running on this task"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop timer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// RunningTimer returns the entry of the user's running timer.
+func (h *TimeEntryHandler) RunningTimer(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	query := `SELECT ` + timeEntryColumns + ` FROM time_entries e 
+		 JOIN tasks t ON e.task_id = t.id 
+		 JOIN boards b ON t.board_id = b.id 
+		 WHERE e.user_id = $1 AND e.ended_at IS NULL 
+		   AND b.project_id IN (` + fmt.Sprintf(memberProjectsSQL, "$1") + `)`
+	args := []interface{}{userID}
+	if restricted, ok := tokenProject(c); ok {
+		query += " AND b.project_id = $2"
+		args = append(args, restricted)
+	}
+
+	var entry models.TimeEntry
+	err := h.db.Pool.QueryRow(context.Background(), query, args...).Scan(timeEntryScanDest(&entry)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No timer is running"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch timer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// Timesheet adds up the finished time entries of the projects the user is
+// a member of between the from and to dates, per day, user and task. It
+// can be narrowed to a project_id and user_id, and is exported as CSV with
+// format=csv.
+func (h *TimeEntryHandler) Timesheet(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	from, to := c.Query("from"), c.Query("to")
+	start, end, err := timesheet.ParseRange(from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	query := `SELECT TO_CHAR(e.started_at, 'YYYY-MM-DD'), u.id, u.username, p.id, p.name, t.id, t.title, 
+		        SUM(EXTRACT(EPOCH FROM e.ended_at - e.started_at))::bigint 
+		 FROM time_entries e 
+		 JOIN users u ON e.user_id = u.id 
+		 JOIN tasks t ON e.task_id = t.id 
+		 JOIN boards b ON t.board_id = b.id 
+		 JOIN projects p ON b.project_id = p.id 
+		 WHERE e.ended_at IS NOT NULL AND e.started_at >= $2 AND e.started_at < $3 
+		   AND b.project_id IN (` + fmt.Sprintf(memberProjectsSQL, "$1") + `)`
+	args := []interface{}{userID, start, end}
+	addFilter := func(param, column string) bool {
+		v := c.Query(param)
+		if v == "" {
+			return true
+		}
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+			return false
+		}
+		args = append(args, id)
+		query += " AND " + column + " = $" + strconv.Itoa(len(args))
+		return true
+	}
+	if !addFilter("project_id", "b.project_id") || !addFilter("user_id", "e.user_id") {
+		return
+	}
+	if restricted, ok := tokenProject(c); ok {
+		args = append(args, restricted)
+		query += " AND b.project_id = $" + strconv.Itoa(len(args))
+	}
+	query += ` GROUP BY 1, u.id, u.username, p.id, p.name, t.id, t.title 
+		 ORDER BY 1, u.username, p.name, t.id`
+
+	rows, err := h.db.Pool.Query(context.Background(), query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch time entries"})
+		return
+	}
+	defer rows.Close()
+
+	var sheetRows []models.TimesheetRow
+	for rows.Next() {
+		var row models.TimesheetRow
+		err := rows.Scan(&row.Date, &row.UserID, &row.Username, &row.ProjectID, &row.ProjectName, &row.TaskID, &row.TaskTitle, &row.Seconds)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch time entries"})
+			return
+		}
+		sheetRows = append(sheetRows, row)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch time entries"})
+		return
+	}
+
+	sheet := timesheet.Build(from, to, sheetRows)
+	if format == "json" {
+		c.JSON(http.StatusOK, sheet)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="timesheet-%s-%s.csv"`, from, to))
+	c.Status(http.StatusOK)
+	if err := timesheet.WriteCSV(c.Writer, sheet); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// timeEntryEnd returns when an entry logged by hand ends, given either its
+// end or its duration. It writes a 400 response when neither or both are
+// given, or when the entry would end before it starts or last longer than
+// maxTimeEntryDuration.
+func timeEntryEnd(c *gin.Context, startedAt time.Time, endedAt *time.Time, durationSeconds *int) (*time.Time, bool) {
+	if (endedAt == nil) == (durationSeconds == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give either ended_at or duration_seconds"})
+		return nil, false
+	}
+	if durationSeconds != nil {
+		end := startedAt.Add(time.Duration(*durationSeconds) * time.Second)
+		return &end, true
+	}
+	if !endedAt.After(startedAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The end must be after the start"})
+		return nil, false
+	}
+	if endedAt.Sub(startedAt) > maxTimeEntryDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An entry can last at most 24 hours"})
+		return nil, false
+	}
+	return endedAt, true
+}
+
+// utcTime converts a time sent by a client to UTC, the time zone entries are
+// stored in, like the timers' utcNowSQL. Without it the offset would be
+// dropped and the client's local time stored.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// timeEntryScanDest returns the scan destinations matching timeEntryColumns.
+func timeEntryScanDest(entry *models.TimeEntry) []interface{} {
+	return []interface{}{&entry.ID, &entry.TaskID, &entry.UserID, &entry.StartedAt, &entry.EndedAt,
+		&entry.DurationSeconds, &entry.Note, &entry.CreatedAt, &entry.UpdatedAt}
+}
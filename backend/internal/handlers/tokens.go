@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/auth"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+type AccessTokenHandler struct {
+	db     *database.Database
+	tokens *auth.AccessTokens
+}
+
+func NewAccessTokenHandler(db *database.Database, tokens *auth.AccessTokens) *AccessTokenHandler {
+	return &AccessTokenHandler{db: db, tokens: tokens}
+}
+
+// Create issues a personal access token. The response is the only time the
+// token is shown.
+func (h *AccessTokenHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := make(map[string]bool)
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	if req.ProjectID != nil {
+		if _, ok := authorizeProject(c, h.db, *req.ProjectID, models.RoleViewer); !ok {
+			return
+		}
+	}
+
+	token, record, err := h.tokens.Create(context.Background(), userID.(int), req.Name, scopes, req.ProjectID, req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create access token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreateAccessTokenResponse{PersonalAccessToken: record, Token: token})
+}
+
+func (h *AccessTokenHandler) List(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	tokens, err := h.tokens.List(context.Background(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch access tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *AccessTokenHandler) Revoke(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	tokenID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid access token ID"})
+		return
+	}
+
+	revoked, err := h.tokens.Revoke(context.Background(), userID.(int), tokenID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access token"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Access token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access token revoked successfully"})
+}
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/totp"
+	"github.com/mochammadshenna/4me-backend/internal/utils"
+)
+
+const (
+	totpIssuer         = "4me"
+	totpSecretPurpose  = "totp"
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+// TwoFactorStatus reports whether the current user has two-factor
+// authentication enabled and how many recovery codes are left.
+func (h *AuthHandler) TwoFactorStatus(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var status models.TwoFactorStatus
+	err := h.db.Pool.QueryRow(context.Background(),
+		`SELECT u.totp_enabled_at IS NOT NULL,
+		        (SELECT COUNT(*) FROM recovery_codes WHERE user_id = u.id AND used_at IS NULL)
+		 FROM users u WHERE u.id = $1`,
+		userID).Scan(&status.Enabled, &status.RecoveryCodesRemaining)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// SetupTwoFactor starts enrollment with a new secret. Two-factor
+// authentication stays off until a code from the authenticator app is
+// confirmed with EnableTwoFactor.
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	ctx := context.Background()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	encrypted, err := utils.Encrypt(secret, h.config.TOTPEncryptionKey, totpSecretPurpose)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	var email string
+	err = h.db.Pool.QueryRow(ctx,
+		`UPDATE users SET totp_secret = $2, totp_last_step = NULL
+		 WHERE id = $1 AND totp_enabled_at IS NULL
+		 RETURNING email`,
+		userID, encrypted).Scan(&email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorSetupResponse{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, email, secret),
+	})
+}
+
+// EnableTwoFactor confirms enrollment with a code from the authenticator app
+// and returns the recovery codes. They are shown only once.
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var encrypted *string
+	var enabled bool
+	err = tx.QueryRow(ctx,
+		"SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = $1 FOR UPDATE",
+		userID).Scan(&encrypted, &enabled)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if encrypted == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		return
+	}
+
+	ok, err := h.verifyTOTP(ctx, tx, userID.(int), *encrypted, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE users SET totp_enabled_at = NOW() WHERE id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor turns two-factor authentication off. It requires the
+// current password and a TOTP or recovery code.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkCurrentPassword(c, userID.(int), req.CurrentPassword) {
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if !h.checkSecondFactor(c, tx, userID.(int), req.Code) {
+		return
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+		 WHERE id = $1`,
+		userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes. It requires a TOTP
+// code, so a leaked recovery code cannot be used to mint new ones.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var encrypted *string
+	err = tx.QueryRow(ctx,
+		"SELECT totp_secret FROM users WHERE id = $1 AND totp_enabled_at IS NOT NULL FOR UPDATE",
+		userID).Scan(&encrypted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	ok, err := h.verifyTOTP(ctx, tx, userID.(int), *encrypted, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// VerifyTwoFactor completes a login started with a password or OAuth. It is
+// the only endpoint that accepts the MFA pending token.
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := h.db.Pool.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if !h.checkSecondFactor(c, tx, userID.(int), req.Code) {
+		return
+	}
+
+	var user models.User
+	err = tx.QueryRow(ctx,
+		`SELECT `+userColumns+` FROM users u WHERE u.id = $1`,
+		userID).
+		Scan(userScanDest(&user)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	resp, err := h.issueTokens(c, tx, user, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	h.respondWithTokens(c, http.StatusOK, resp)
+}
+
+// checkSecondFactor accepts a TOTP code or an unused recovery code of a user
+// with two-factor authentication enabled, and writes the error response
+// otherwise.
+func (h *AuthHandler) checkSecondFactor(c *gin.Context, tx pgx.Tx, userID int, code string) bool {
+	ctx := context.Background()
+
+	limitKey := fmt.Sprintf("2fa:%d", userID)
+	if !h.limiter.Account(c, limitKey) {
+		return false
+	}
+
+	var encrypted *string
+	err := tx.QueryRow(ctx,
+		"SELECT totp_secret FROM users WHERE id = $1 AND totp_enabled_at IS NOT NULL FOR UPDATE",
+		userID).Scan(&encrypted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+
+	code = strings.TrimSpace(code)
+	var ok bool
+	if len(code) == totp.Digits {
+		ok, err = h.verifyTOTP(ctx, tx, userID, *encrypted, code)
+	} else {
+		ok, err = useRecoveryCode(ctx, tx, userID, code)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return false
+	}
+	if !ok {
+		h.limiter.Fail(c, limitKey)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return false
+	}
+
+	h.limiter.Succeed(c, limitKey)
+	return true
+}
+
+// verifyTOTP checks code against the user's encrypted secret and records its
+// time step, so each code is accepted at most once.
+func (h *AuthHandler) verifyTOTP(ctx context.Context, q querier, userID int, encrypted, code string) (bool, error) {
+	secret, err := utils.Decrypt(encrypted, h.config.TOTPEncryptionKey, totpSecretPurpose)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	result, err := q.Exec(ctx,
+		`UPDATE users SET totp_last_step = $2
+		 WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)`,
+		userID, step)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// useRecoveryCode marks an unused recovery code of the user as used.
+func useRecoveryCode(ctx context.Context, q querier, userID int, code string) (bool, error) {
+	result, err := q.Exec(ctx,
+		`UPDATE recovery_codes SET used_at = NOW()
+		 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, utils.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores the
+// hashes of new ones, which are returned formatted as "xxxxx-xxxxx".
+func replaceRecoveryCodes(ctx context.Context, q querier, userID int) ([]string, error) {
+	if _, err := q.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		raw, err := utils.RandomToken(recoveryCodeLength / 2)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = q.Exec(ctx,
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, utils.HashToken(raw))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:recoveryCodeLength/2]+"-"+raw[recoveryCodeLength/2:])
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips the separator and spacing users may type.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,277 @@
+// Package jwks holds the keys that sign access tokens and publishes their
+// public halves as a JSON Web Key Set, so other services can verify 4me
+// tokens.
+//
+// A key set is loaded from a directory holding a keyset.json manifest and
+// PEM files:
+//
+//	{
+//	  "signing": "2024-06",
+//	  "keys": [
+//	    {"kid": "2024-06", "file": "2024-06.pem"},
+//	    {"kid": "2024-01", "file": "2024-01.pem", "retired_at": "2024-06-01T00:00:00Z"}
+//	  ]
+//	}
+//
+// RSA keys sign with RS256 and Ed25519 keys with EdDSA. Every key listed is
+// published and verifies tokens; a retired key stops doing so once the grace
+// period after its retired_at has passed. Without a directory, tokens are
+// signed with HS256 and nothing is published.
+package jwks
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mochammadshenna/4me-backend/internal/config"
+)
+
+// ManifestFile is the name of the manifest in a key directory.
+const ManifestFile = "keyset.json"
+
+type manifest struct {
+	Signing string `json:"signing"`
+	Keys    []struct {
+		KID       string     `json:"kid"`
+		File      string     `json:"file"`
+		RetiredAt *time.Time `json:"retired_at"`
+	} `json:"keys"`
+}
+
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+	// expires is when a retired key stops verifying tokens; zero for keys
+	// in use.
+	expires time.Time
+}
+
+func (k *key) active(now time.Time) bool {
+	return k.expires.IsZero() || now.Before(k.expires)
+}
+
+// KeySet signs tokens with one key and verifies them with any current key.
+type KeySet struct {
+	signing *key
+	keys    map[string]*key
+	// secret is the HS256 key when no key directory is configured.
+	secret []byte
+	now    func() time.Time
+}
+
+// NewHMAC returns a key set that signs and verifies with an HS256 secret.
+func NewHMAC(secret string) *KeySet {
+	return &KeySet{secret: []byte(secret), now: time.Now}
+}
+
+// NewFromConfig loads the key set from cfg.JWTKeysDir, or falls back to
+// HS256 with cfg.JWTSecret when it is not set.
+func NewFromConfig(cfg *config.Config) (*KeySet, error) {
+	if cfg.JWTKeysDir == "" {
+		return NewHMAC(cfg.JWTSecret), nil
+	}
+	return Load(cfg.JWTKeysDir, cfg.JWTKeyGracePeriod)
+}
+
+// Load reads the manifest and keys in dir. Retired keys verify tokens for
+// grace after they were retired.
+func Load(dir string, grace time.Duration) (*KeySet, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", ManifestFile, err)
+	}
+
+	ks := &KeySet{keys: make(map[string]*key), now: time.Now}
+	for _, entry := range m.Keys {
+		if entry.KID == "" {
+			return nil, errors.New("key without kid")
+		}
+		if _, ok := ks.keys[entry.KID]; ok {
+			return nil, fmt.Errorf("duplicate kid %q", entry.KID)
+		}
+
+		k, err := loadKey(filepath.Join(dir, entry.File))
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", entry.KID, err)
+		}
+		k.id = entry.KID
+		if entry.RetiredAt != nil {
+			k.expires = entry.RetiredAt.Add(grace)
+		}
+		ks.keys[entry.KID] = k
+	}
+
+	signing, ok := ks.keys[m.Signing]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q is not listed", m.Signing)
+	}
+	if signing.private == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", m.Signing)
+	}
+	if !signing.expires.IsZero() {
+		return nil, fmt.Errorf("signing key %q is retired", m.Signing)
+	}
+	ks.signing = signing
+
+	return ks, nil
+}
+
+// loadKey reads a PEM private key, or a public key that only verifies.
+func loadKey(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	k := &key{}
+	switch v := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.private, k.public = jwt.SigningMethodRS256, v, &v.PublicKey
+	case *rsa.PublicKey:
+		k.method, k.public = jwt.SigningMethodRS256, v
+	case ed25519.PrivateKey:
+		k.method, k.private, k.public = jwt.SigningMethodEdDSA, v, v.Public()
+	case ed25519.PublicKey:
+		k.method, k.public = jwt.SigningMethodEdDSA, v
+	default:
+		return nil, fmt.Errorf("unsupported key type %T; use RSA or Ed25519", parsed)
+	}
+
+	if pub, ok := k.public.(*rsa.PublicKey); ok && pub.N.BitLen() < 2048 {
+		return nil, errors.New("RSA keys must have at least 2048 bits")
+	}
+
+	return k, nil
+}
+
+// Sign signs claims with the signing key and sets its kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.secret)
+	}
+
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+	return token.SignedString(ks.signing.private)
+}
+
+// Keyfunc returns the key that verifies a token, for jwt.Parse. It rejects
+// unknown or expired kids and algorithms other than the key's.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if ks.signing == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return ks.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	k, ok := ks.keys[kid]
+	if !ok || !k.active(ks.now()) {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, errors.New("invalid signing method")
+	}
+	return k.public, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Public returns the keys that currently verify tokens, signing key first.
+// It is empty for an HS256 key set, whose secret must not be published.
+func (ks *KeySet) Public() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if ks.signing == nil {
+		return set
+	}
+
+	now := ks.now()
+	ids := make([]string, 0, len(ks.keys))
+	for id, k := range ks.keys {
+		if k != ks.signing && k.active(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	set.Keys = append(set.Keys, ks.signing.jwk())
+	for _, id := range ids {
+		set.Keys = append(set.Keys, ks.keys[id].jwk())
+	}
+	return set
+}
+
+func (k *key) jwk() JWK {
+	encode := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{KeyID: k.id, Use: "sig", Algorithm: k.method.Alg()}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(pub.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encode(pub)
+	}
+	return jwk
+}
@@ -0,0 +1,135 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, dir, name string, key interface{}) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0600))
+}
+
+func writeManifest(t *testing.T, dir, manifest string) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ManifestFile), []byte(manifest), 0600))
+}
+
+// newRotatedKeySet loads an Ed25519 signing key and an RSA key retired an
+// hour ago.
+func newRotatedKeySet(t *testing.T, grace time.Duration) *KeySet {
+	dir := t.TempDir()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeKey(t, dir, "new.pem", edKey)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writeKey(t, dir, "old.pem", rsaKey)
+
+	retired := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	writeManifest(t, dir, `{
+		"signing": "new",
+		"keys": [
+			{"kid": "new", "file": "new.pem"},
+			{"kid": "old", "file": "old.pem", "retired_at": "`+retired+`"}
+		]
+	}`)
+
+	ks, err := Load(dir, grace)
+	require.NoError(t, err)
+	return ks
+}
+
+func parse(ks *KeySet, token string) error {
+	_, err := jwt.Parse(token, ks.Keyfunc)
+	return err
+}
+
+func TestSignAndVerify(t *testing.T) {
+	ks := newRotatedKeySet(t, 24*time.Hour)
+
+	token, err := ks.Sign(jwt.MapClaims{"sub": "1"})
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+	assert.Equal(t, "new", parsed.Header["kid"])
+
+	assert.NoError(t, parse(ks, token))
+
+	// Tokens signed with the retired key verify during the grace period
+	old := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "1"})
+	old.Header["kid"] = "old"
+	oldToken, err := old.SignedString(ks.keys["old"].private)
+	require.NoError(t, err)
+	assert.NoError(t, parse(ks, oldToken))
+
+	ks.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+	assert.Error(t, parse(ks, oldToken))
+	assert.NoError(t, parse(ks, token))
+}
+
+func TestVerifyRejectsForgedTokens(t *testing.T) {
+	ks := newRotatedKeySet(t, time.Hour)
+
+	// No kid
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"sub": "1"})
+	token, _ := unsigned.SignedString(ks.signing.private)
+	assert.Error(t, parse(ks, token))
+
+	// HS256 with the public key as secret
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"})
+	hmac.Header["kid"] = "new"
+	token, _ = hmac.SignedString([]byte(ks.keys["new"].public.(ed25519.PublicKey)))
+	assert.Error(t, parse(ks, token))
+
+	// A key the set doesn't know
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	foreign := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"sub": "1"})
+	foreign.Header["kid"] = "new"
+	token, _ = foreign.SignedString(other)
+	assert.Error(t, parse(ks, token))
+}
+
+func TestPublic(t *testing.T) {
+	ks := newRotatedKeySet(t, 24*time.Hour)
+
+	set := ks.Public()
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, JWK{KeyType: "OKP", KeyID: "new", Use: "sig", Algorithm: "EdDSA", Curve: "Ed25519", X: set.Keys[0].X}, set.Keys[0])
+	assert.Equal(t, "RSA", set.Keys[1].KeyType)
+	assert.Equal(t, "RS256", set.Keys[1].Algorithm)
+	assert.Equal(t, "AQAB", set.Keys[1].E)
+
+	// Retired keys are unpublished after the grace period
+	ks.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+	assert.Len(t, ks.Public().Keys, 1)
+
+	// HMAC secrets are never published
+	assert.Empty(t, NewHMAC("secret").Public().Keys)
+}
+
+func TestLoadRejectsRetiredSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	writeKey(t, dir, "a.pem", key)
+	writeManifest(t, dir, `{"signing": "a", "keys": [{"kid": "a", "file": "a.pem", "retired_at": "2024-01-01T00:00:00Z"}]}`)
+
+	_, err := Load(dir, time.Hour)
+	assert.Error(t, err)
+}
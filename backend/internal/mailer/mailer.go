@@ -0,0 +1,35 @@
+// Package mailer sends transactional email such as project invitations.
+// The backend is chosen by configuration: SMTP in production, or a log or
+// file sender for local development and tests.
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mochammadshenna/4me-backend/internal/config"
+)
+
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the sender selected by cfg.MailDriver.
+func New(cfg *config.Config) (Sender, error) {
+	switch cfg.MailDriver {
+	case "smtp":
+		return NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "file":
+		return NewFileSender(cfg.MailDir, cfg.MailFrom), nil
+	case "log", "":
+		return NewLogSender(cfg.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.MailDriver)
+	}
+}
@@ -5,29 +5,106 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/auth"
+	"github.com/mochammadshenna/4me-backend/internal/config"
+	"github.com/mochammadshenna/4me-backend/internal/jwks"
 	"github.com/mochammadshenna/4me-backend/internal/utils"
 )
 
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// AuthMiddleware accepts access tokens from an interactive login and
+// personal access tokens. In the cookie auth mode the access token is read
+// from its cookie when there is no Authorization header. For personal access
+// tokens it also sets "accessTokenID", "scopes" and, for tokens restricted
+// to a project, "tokenProjectID"; RequireScope and RequireSession check them.
+func AuthMiddleware(cfg *config.Config, keys *jwks.KeySet, sessions *auth.Sessions, tokens *auth.AccessTokens) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		token, ok := requestToken(c, cfg.CookieMode())
+		if !ok {
+			return
+		}
+
+		if auth.IsAccessToken(token) {
+			principal, err := tokens.Authenticate(c.Request.Context(), token)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid, expired or revoked access token"})
+				c.Abort()
+				return
+			}
+
+			c.Set("userID", principal.UserID)
+			c.Set("username", principal.Username)
+			c.Set("accessTokenID", principal.TokenID)
+			c.Set("scopes", principal.Scopes)
+			if principal.ProjectID != nil {
+				c.Set("tokenProjectID", *principal.ProjectID)
+			}
+			c.Next()
+			return
+		}
+
+		claims, err := utils.ValidateToken(token, keys)
+		if err != nil || claims.SessionID == 0 {
+			if _, mfaErr := utils.ValidateMFAPendingToken(token, cfg.JWTSecret); mfaErr == nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor verification required"})
+			} else {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			}
+			c.Abort()
+			return
+		}
+
+		if sessions.IsRevoked(c.Request.Context(), claims.SessionID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
+		c.Set("userID", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("sessionID", claims.SessionID)
+		c.Next()
+	}
+}
+
+// RequireScope rejects personal access tokens without scope. Interactive
+// sessions are not limited by scopes.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, isToken := c.Get("scopes")
+		if isToken && !auth.HasScope(scopes.([]string), scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This access token lacks the " + scope + " scope"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+// RequireSession rejects personal access tokens, for account management
+// that needs an interactive login.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isToken := c.Get("accessTokenID"); isToken {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Personal access tokens cannot be used for this endpoint"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		token := tokenParts[1]
-		claims, err := utils.ValidateToken(token, jwtSecret)
+// MFAPendingMiddleware accepts only the MFA pending token issued by the
+// first login step. It guards the two-factor verification endpoint.
+func MFAPendingMiddleware(jwtSecret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !ok {
+			return
+		}
+
+		claims, err := utils.ValidateMFAPendingToken(token, jwtSecret)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor token; please sign in again"})
 			c.Abort()
 			return
 		}
@@ -38,3 +115,33 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	}
 }
 
+// requestToken returns the bearer token, or in cookie mode the access token
+// cookie of a request without an Authorization header.
+func requestToken(c *gin.Context, cookieMode bool) (string, bool) {
+	if cookieMode && c.GetHeader("Authorization") == "" {
+		if token, err := c.Cookie(auth.AccessCookie); err == nil && token != "" {
+			return token, true
+		}
+	}
+	return bearerToken(c)
+}
+
+// bearerToken returns the token from the Authorization header, or aborts
+// the request when the header is missing or malformed.
+func bearerToken(c *gin.Context) (string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		c.Abort()
+		return "", false
+	}
+
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		c.Abort()
+		return "", false
+	}
+
+	return tokenParts[1], true
+}
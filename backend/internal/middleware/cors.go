@@ -1,22 +1,167 @@
 package middleware
 
 import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+var (
+	corsMethods       = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsExposeHeaders = "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset"
 )
 
-func CORSMiddleware(frontendURL string) gin.HandlerFunc {
+// originPattern is an allowed origin such as "https://app.example.com".
+// The host may start with "*." to match any subdomain, and the port may be
+// "*" to match any port.
+type originPattern struct {
+	scheme string
+	host   string
+	port   string
+}
+
+func parseOriginPattern(pattern string) (originPattern, error) {
+	scheme, rest, ok := strings.Cut(strings.ToLower(strings.TrimSuffix(pattern, "/")), "://")
+	if !ok || scheme == "" || rest == "" || strings.Contains(rest, "/") {
+		return originPattern{}, fmt.Errorf("%q is not an origin like https://app.example.com", pattern)
+	}
+
+	host, port := rest, ""
+	if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.HasSuffix(rest, "]") {
+		host, port = rest[:i], rest[i+1:]
+		if _, err := strconv.Atoi(port); err != nil && port != "*" {
+			return originPattern{}, fmt.Errorf("%q has an invalid port", pattern)
+		}
+	}
+	if strings.Contains(strings.TrimPrefix(host, "*."), "*") || host == "" || host == "*." {
+		return originPattern{}, fmt.Errorf("%q: only a leading *. is allowed in the host", pattern)
+	}
+
+	return originPattern{scheme: scheme, host: host, port: port}, nil
+}
+
+func (p originPattern) matches(scheme, host, port string) bool {
+	if scheme != p.scheme || (p.port != "*" && port != p.port) {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(p.host, "*"); ok {
+		return len(host) > len(suffix) && strings.HasSuffix(host, suffix)
+	}
+	return host == p.host
+}
+
+// allowedOrigin reports whether an Origin header matches one of patterns.
+func allowedOrigin(patterns []originPattern, origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.User != nil {
+		return false
+	}
+	// Patterns keep the brackets of IPv6 hosts
+	host := u.Hostname()
+	if strings.HasPrefix(u.Host, "[") {
+		host = "[" + host + "]"
+	}
+
+	for _, p := range patterns {
+		if p.matches(u.Scheme, host, u.Port()) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORSMiddleware lets the allowed origins call the API with credentials,
+// which the cookie auth mode needs. Browsers reject credentialed responses
+// with a wildcard origin, so the request's origin is echoed when it is
+// allowed. Requests from other origins are rejected; requests without an
+// Origin header, such as those of scripts, are let through.
+//
+// Preflight requests get the allowed methods, the requested headers and a
+// max age of maxAge.
+//
+// publicPaths, such as the JWKS endpoint, can be read by any origin without
+// credentials, so that third-party verifiers can fetch them from a browser.
+func CORSMiddleware(origins []string, maxAge time.Duration, publicPaths ...string) (gin.HandlerFunc, error) {
+	patterns := make([]originPattern, 0, len(origins))
+	for _, origin := range origins {
+		p, err := parseOriginPattern(origin)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+
+	allowMethods := strings.Join(corsMethods, ", ")
+	maxAgeSeconds := strconv.Itoa(int(maxAge.Seconds()))
+
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", frontendURL)
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		header := c.Writer.Header()
+		if slices.Contains(publicPaths, c.Request.URL.Path) {
+			header.Set("Access-Control-Allow-Origin", "*")
+			if c.Request.Method == http.MethodOptions {
+				header.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+				header.Set("Access-Control-Max-Age", maxAgeSeconds)
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		header.Add("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method, Access-Control-Request-Headers")
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if origin == "" {
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if !allowedOrigin(patterns, origin) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Origin not allowed", "code": models.ErrorCodeOriginNotAllowed})
+			return
+		}
+
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Allow-Credentials", "true")
+
+		if preflight {
+			method := strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))
+			if !slices.Contains(corsMethods, method) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Method not allowed", "code": models.ErrorCodeOriginNotAllowed})
+				return
+			}
+
+			header.Set("Access-Control-Allow-Methods", allowMethods)
+			if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+				header.Set("Access-Control-Allow-Headers", requested)
+			}
+			header.Set("Access-Control-Max-Age", maxAgeSeconds)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		header.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
 		c.Next()
-	}
+	}, nil
 }
-
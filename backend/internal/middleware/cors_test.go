@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCORSRouter(t *testing.T, origins ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cors, err := CORSMiddleware(origins, 2*time.Hour)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(cors)
+	router.Any("/api/projects", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func corsRequest(router *gin.Engine, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/projects", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSOriginPatterns(t *testing.T) {
+	router := newCORSRouter(t, "https://app.example.com", "https://*.preview.example.com", "http://localhost:*", "capacitor://localhost")
+
+	allowed := []string{
+		"https://app.example.com",
+		"https://pr-12.preview.example.com",
+		"https://a.b.preview.example.com",
+		"http://localhost:5173",
+		"http://localhost",
+		"capacitor://localhost",
+	}
+	for _, origin := range allowed {
+		w := corsRequest(router, "GET", origin, nil)
+		assert.Equal(t, http.StatusOK, w.Code, origin)
+		assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"), origin)
+		assert.Equal(t, "Origin", w.Header().Get("Vary"), origin)
+	}
+
+	rejected := []string{
+		"http://app.example.com",
+		"https://app.example.com:8443",
+		"https://preview.example.com",
+		"https://evilpreview.example.com",
+		"https://app.example.com.evil.test",
+		"https://localhost:5173",
+		"null",
+	}
+	for _, origin := range rejected {
+		w := corsRequest(router, "GET", origin, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code, origin)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	// Requests without an Origin header are not CORS requests
+	w := corsRequest(router, "POST", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := newCORSRouter(t, "https://app.example.com")
+
+	w := corsRequest(router, "OPTIONS", "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method":  "PATCH",
+		"Access-Control-Request-Headers": "content-type, x-csrf-token",
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "PATCH")
+	assert.Equal(t, "content-type, x-csrf-token", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "7200", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method, Access-Control-Request-Headers"}, w.Header().Values("Vary"))
+
+	w = corsRequest(router, "OPTIONS", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "TRACE"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = corsRequest(router, "OPTIONS", "https://other.example.com", map[string]string{"Access-Control-Request-Method": "GET"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSPublicPaths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cors, err := CORSMiddleware([]string{"https://app.example.com"}, 2*time.Hour, "/.well-known/jwks.json")
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(cors)
+	router.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	req.Header.Set("Origin", "https://verifier.example.org")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	req = httptest.NewRequest("OPTIONS", "/.well-known/jwks.json", nil)
+	req.Header.Set("Origin", "https://verifier.example.org")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Other paths keep the allowlist
+	assert.Equal(t, http.StatusForbidden, corsRequest(router, "GET", "https://verifier.example.org", nil).Code)
+}
+
+func TestCORSInvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{"*", "app.example.com", "https://*", "https://app.*.com", "https://example.com/app", "https://example.com:http"} {
+		_, err := CORSMiddleware([]string{pattern}, time.Hour)
+		assert.Error(t, err, pattern)
+	}
+}
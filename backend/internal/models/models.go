@@ -1,58 +1,382 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	GoogleID     *string   `json:"google_id,omitempty"`
-	AvatarURL    *string   `json:"avatar_url,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              int        `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	PasswordHash    string     `json:"-"`
+	AvatarURL       *string    `json:"avatar_url,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// TwoFactorEnabled reports whether login requires a TOTP code
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 type Project struct {
-	ID          int       `json:"id"`
-	UserID      int       `json:"user_id"`
-	Name        string    `json:"name"`
-	Description *string   `json:"description,omitempty"`
-	Color       string    `json:"color"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int     `json:"id"`
+	UserID      int     `json:"user_id"`
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+	Color       string  `json:"color"`
+	// EstimateUnit is what task estimates are counted in, hours or points
+	EstimateUnit string      `json:"estimate_unit"`
+	Role         ProjectRole `json:"role,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// Estimate units
+const (
+	EstimateUnitHours  = "hours"
+	EstimateUnitPoints = "points"
+)
+
+// ProjectRole is a member's role in a project. Each role includes the
+// permissions of the roles below it.
+type ProjectRole string
+
+const (
+	RoleOwner     ProjectRole = "owner"
+	RoleAdmin     ProjectRole = "admin"
+	RoleEditor    ProjectRole = "editor"
+	RoleCommenter ProjectRole = "commenter"
+	RoleViewer    ProjectRole = "viewer"
+)
+
+var projectRoleRanks = map[ProjectRole]int{
+	RoleViewer:    1,
+	RoleCommenter: 2,
+	RoleEditor:    3,
+	RoleAdmin:     4,
+	RoleOwner:     5,
+}
+
+func (r ProjectRole) Valid() bool {
+	_, ok := projectRoleRanks[r]
+	return ok
+}
+
+// AtLeast reports whether r grants every permission of min.
+func (r ProjectRole) AtLeast(min ProjectRole) bool {
+	return projectRoleRanks[r] >= projectRoleRanks[min]
+}
+
+type ProjectMember struct {
+	ProjectID int         `json:"project_id"`
+	UserID    int         `json:"user_id"`
+	Role      ProjectRole `json:"role"`
+	CreatedAt time.Time   `json:"created_at"`
+	User      *User       `json:"user,omitempty"`
 }
 
 type Board struct {
+	ID        int    `json:"id"`
+	ProjectID int    `json:"project_id"`
+	Name      string `json:"name"`
+	Position  int    `json:"position"`
+	// StatusID is the status tasks take when they are moved to the board
+	StatusID  *int      `json:"status_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Task struct {
+	ID           int        `json:"id"`
+	BoardID      int        `json:"board_id"`
+	ParentTaskID *int       `json:"parent_task_id,omitempty"`
+	Title        string     `json:"title"`
+	Description  *string    `json:"description,omitempty"`
+	Status       string     `json:"status"`
+	Priority     string     `json:"priority"`
+	AssigneeID   *int       `json:"assignee_id,omitempty"`
+	DueDate      *time.Time `json:"due_date,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	// OriginalEstimate and RemainingEstimate are in the project's estimate
+	// unit
+	OriginalEstimate  *float64  `json:"original_estimate,omitempty"`
+	RemainingEstimate *float64  `json:"remaining_estimate,omitempty"`
+	Position          int       `json:"position"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	Labels            []Label   `json:"labels,omitempty"`
+	// CustomFields holds the task's custom field values by field ID
+	CustomFields map[int]interface{} `json:"custom_fields,omitempty"`
+
+	// RecurrenceRule repeats the task, e.g. "FREQ=WEEKLY;BYDAY=MO". Only the
+	// latest instance of a series has it; RecursFromTaskID links each
+	// instance to the one before.
+	RecurrenceRule       *string `json:"recurrence_rule,omitempty"`
+	RecurAfterCompletion bool    `json:"recur_after_completion"`
+	RecursFromTaskID     *int    `json:"recurs_from_task_id,omitempty"`
+
+	CommentCount    int          `json:"comment_count"`
+	AttachmentCount int          `json:"attachment_count"`
+	Progress        TaskProgress `json:"progress"`
+	// IsBlocked reports whether a task blocking this one is not finished yet
+	IsBlocked bool `json:"is_blocked"`
+	// TimeSpentSeconds is the time logged on the task, including running
+	// timers
+	TimeSpentSeconds int `json:"time_spent_seconds"`
+
+	// Checklist, Subtasks and Blockers are only included when fetching a
+	// single task
+	Checklist []ChecklistItem `json:"checklist,omitempty"`
+	Subtasks  []Task          `json:"subtasks,omitempty"`
+	Blockers  []TaskRef       `json:"blockers,omitempty"`
+}
+
+// TaskRef identifies a task in links between tasks.
+type TaskRef struct {
+	ID      int    `json:"id"`
+	BoardID int    `json:"board_id"`
+	Title   string `json:"title"`
+	Status  string `json:"status"`
+}
+
+// Dependency types. A task blocks another when it has to be done before the
+// other can start; blocked_by is the same link seen from the other task.
+const (
+	DependencyBlocks    = "blocks"
+	DependencyBlockedBy = "blocked_by"
+	DependencyRelatesTo = "relates_to"
+)
+
+// TaskDependency is a link from the task it is listed for to Task, with the
+// Type seen from that task.
+type TaskDependency struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	Task      TaskRef   `json:"task"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DependencyGraph holds the tasks of a project that have dependencies and
+// the links between them. CriticalPath is the longest chain of unfinished
+// tasks, each blocking the next.
+type DependencyGraph struct {
+	Nodes        []DependencyNode `json:"nodes"`
+	Edges        []DependencyEdge `json:"edges"`
+	CriticalPath []int            `json:"critical_path"`
+}
+
+type DependencyNode struct {
+	TaskRef
+	DueDate   *time.Time `json:"due_date,omitempty"`
+	IsBlocked bool       `json:"is_blocked"`
+}
+
+// DependencyEdge links task From to task To; for "blocks" edges From blocks
+// To.
+type DependencyEdge struct {
+	ID   int    `json:"id"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Type string `json:"type"`
+}
+
+// TimeEntry is time a user spent on a task. The entry's timer runs while
+// EndedAt is nil, and DurationSeconds counts up to now until it stops.
+type TimeEntry struct {
+	ID              int        `json:"id"`
+	TaskID          int        `json:"task_id"`
+	UserID          int        `json:"user_id"`
+	StartedAt       time.Time  `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at"`
+	DurationSeconds int        `json:"duration_seconds"`
+	Note            *string    `json:"note,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	User            *User      `json:"user,omitempty"`
+}
+
+// Timesheet is the finished time entries of a date range added up per day,
+// user and task, with totals per user and project.
+type Timesheet struct {
+	From         string           `json:"from"`
+	To           string           `json:"to"`
+	Rows         []TimesheetRow   `json:"rows"`
+	Totals       []TimesheetTotal `json:"totals"`
+	TotalSeconds int64            `json:"total_seconds"`
+	TotalHours   float64          `json:"total_hours"`
+}
+
+type TimesheetRow struct {
+	Date        string  `json:"date"`
+	UserID      int     `json:"user_id"`
+	Username    string  `json:"username"`
+	ProjectID   int     `json:"project_id"`
+	ProjectName string  `json:"project_name"`
+	TaskID      int     `json:"task_id"`
+	TaskTitle   string  `json:"task_title"`
+	Seconds     int64   `json:"seconds"`
+	Hours       float64 `json:"hours"`
+}
+
+type TimesheetTotal struct {
+	UserID      int     `json:"user_id"`
+	Username    string  `json:"username"`
+	ProjectID   int     `json:"project_id"`
+	ProjectName string  `json:"project_name"`
+	Seconds     int64   `json:"seconds"`
+	Hours       float64 `json:"hours"`
+}
+
+// EstimateReport compares the estimates of a project's tasks with the time
+// logged on them, for the whole project, per board and per assignee.
+type EstimateReport struct {
+	ProjectID int                `json:"project_id"`
+	Unit      string             `json:"unit"`
+	Total     EstimateRollup     `json:"total"`
+	Boards    []BoardEstimate    `json:"boards"`
+	Assignees []AssigneeEstimate `json:"assignees"`
+}
+
+// EstimateRollup adds up the estimates of a group of tasks and the time
+// logged on them. Estimates are in the project's unit; finished tasks have
+// no remaining work.
+type EstimateRollup struct {
+	TaskCount          int     `json:"task_count"`
+	EstimatedTaskCount int     `json:"estimated_task_count"`
+	OriginalEstimate   float64 `json:"original_estimate"`
+	RemainingEstimate  float64 `json:"remaining_estimate"`
+	SpentSeconds       int64   `json:"spent_seconds"`
+	SpentHours         float64 `json:"spent_hours"`
+}
+
+type BoardEstimate struct {
+	BoardID   int    `json:"board_id"`
+	BoardName string `json:"board_name"`
+	EstimateRollup
+}
+
+// AssigneeEstimate covers the tasks assigned to a user, or the unassigned
+// ones when AssigneeID is nil.
+type AssigneeEstimate struct {
+	AssigneeID *int    `json:"assignee_id"`
+	Username   *string `json:"username"`
+	EstimateRollup
+}
+
+// TaskProgress counts the checklist items and subtasks of a task that are
+// done. Percent covers both and is 0 when there are none.
+type TaskProgress struct {
+	ChecklistDone  int `json:"checklist_done"`
+	ChecklistTotal int `json:"checklist_total"`
+	SubtasksDone   int `json:"subtasks_done"`
+	SubtasksTotal  int `json:"subtasks_total"`
+	Percent        int `json:"percent"`
+}
+
+type ChecklistItem struct {
+	ID        int       `json:"id"`
+	TaskID    int       `json:"task_id"`
+	Text      string    `json:"text"`
+	Done      bool      `json:"done"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BoardWithTasks is a board together with its tasks, used to load a whole
+// project view in a single request.
+type BoardWithTasks struct {
+	Board
+	Tasks      []Task  `json:"tasks"`
+	NextCursor *string `json:"next_cursor,omitempty"`
+}
+
+// TaskPage is one page of a filtered task list. NextCursor is nil on the
+// last page.
+type TaskPage struct {
+	Tasks      []Task  `json:"tasks"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+type Label struct {
+	ID        int       `json:"id"`
+	ProjectID int       `json:"project_id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Status categories. Tasks in a status of the done category are finished.
+const (
+	StatusCategoryTodo       = "todo"
+	StatusCategoryInProgress = "in_progress"
+	StatusCategoryDone       = "done"
+)
+
+// ProjectStatus is a status the tasks of a project can have. Tasks store
+// its Key.
+type ProjectStatus struct {
 	ID        int       `json:"id"`
 	ProjectID int       `json:"project_id"`
+	Key       string    `json:"key"`
 	Name      string    `json:"name"`
+	Category  string    `json:"category"`
 	Position  int       `json:"position"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-type Task struct {
-	ID          int        `json:"id"`
-	BoardID     int        `json:"board_id"`
-	Title       string     `json:"title"`
-	Description *string    `json:"description,omitempty"`
-	Status      string     `json:"status"`
-	Priority    string     `json:"priority"`
-	AssigneeID  *int       `json:"assignee_id,omitempty"`
-	DueDate     *time.Time `json:"due_date,omitempty"`
-	Position    int        `json:"position"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	Labels      []Label    `json:"labels,omitempty"`
+// StatusTransition allows tasks to change from one status to another, by
+// status key.
+type StatusTransition struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to" binding:"required"`
 }
 
-type Label struct {
+// Workflow is a project's statuses in order and the transitions between
+// them. Without transitions, tasks can change between any statuses.
+type Workflow struct {
+	Statuses    []ProjectStatus    `json:"statuses"`
+	Transitions []StatusTransition `json:"transitions"`
+}
+
+// ProjectPriority is a priority the tasks of a project can have. Tasks store
+// its Key; a higher Rank is more urgent. New tasks get the default priority.
+type ProjectPriority struct {
 	ID        int       `json:"id"`
 	ProjectID int       `json:"project_id"`
+	Key       string    `json:"key"`
 	Name      string    `json:"name"`
 	Color     string    `json:"color"`
+	Rank      int       `json:"rank"`
+	IsDefault bool      `json:"is_default"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Custom field types
+const (
+	CustomFieldText         = "text"
+	CustomFieldNumber       = "number"
+	CustomFieldDate         = "date"
+	CustomFieldSingleSelect = "single_select"
+	CustomFieldMultiSelect  = "multi_select"
+	CustomFieldUser         = "user"
+	CustomFieldURL          = "url"
+	CustomFieldCheckbox     = "checkbox"
+)
+
+// CustomField is a field defined by a project for its tasks. Options lists
+// the choices of select fields.
+type CustomField struct {
+	ID        int       `json:"id"`
+	ProjectID int       `json:"project_id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Options   []string  `json:"options"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Comment struct {
@@ -72,6 +396,7 @@ type Attachment struct {
 	FileURL    string    `json:"file_url"`
 	FileType   *string   `json:"file_type,omitempty"`
 	Size       *int64    `json:"size,omitempty"`
+	UploadedBy *int      `json:"uploaded_by,omitempty"`
 	UploadedAt time.Time `json:"uploaded_at"`
 }
 
@@ -85,6 +410,27 @@ type TaskHistory struct {
 	User        *User                  `json:"user,omitempty"`
 }
 
+// Error codes sent in the "code" field of error responses that clients are
+// expected to handle.
+const (
+	ErrorCodeRateLimited       = "rate_limited"
+	ErrorCodeQuotaExceeded     = "quota_exceeded"
+	ErrorCodeCSRFFailed        = "csrf_failed"
+	ErrorCodeOriginNotAllowed  = "origin_not_allowed"
+	ErrorCodeDependencyCycle   = "dependency_cycle"
+	ErrorCodeInvalidTransition = "invalid_transition"
+	ErrorCodeTimerRunning      = "timer_running"
+	ErrorCodeReauthRequired    = "reauthentication_required"
+)
+
+// Quotas limit how much each user can store. They are named in the "quota"
+// field of quota_exceeded errors.
+const (
+	QuotaProjectsPerUser        = "projects_per_user"
+	QuotaTasksPerBoard          = "tasks_per_board"
+	QuotaAttachmentBytesPerUser = "attachment_bytes_per_user"
+)
+
 // Request/Response DTOs
 
 type RegisterRequest struct {
@@ -98,32 +444,192 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-type AuthResponse struct {
-	Token        string `json:"token"`
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ChangePasswordRequest requires the current password unless the user signs
+// in only through OAuth providers and has none.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+type ChangeEmailRequest struct {
+	Email           string `json:"email" binding:"required,email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+// MFAChallengeResponse is returned by login instead of tokens when the user
+// has two-factor authentication enabled. MFAToken is only accepted by
+// POST /auth/2fa/verify.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code or, where accepted, a recovery
+// code.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Code            string `json:"code" binding:"required"`
+	CurrentPassword string `json:"current_password"`
+}
+
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// PersonalAccessToken is a long-lived token for scripts and integrations.
+// The token itself is only returned once, when it is created.
+type PersonalAccessToken struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`
+	Scopes      []string   `json:"scopes"`
+	ProjectID   *int       `json:"project_id"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name" binding:"required,min=1,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ProjectID *int       `json:"project_id"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type CreateAccessTokenResponse struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
+
+type UserIdentity struct {
+	Provider  string    `json:"provider"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Session struct {
+	ID         int       `json:"id"`
+	Device     string    `json:"device"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ExchangeCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type ConfirmLinkRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RefreshRequest carries the refresh token, which comes from its cookie
+// instead in the cookie auth mode.
+type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token"`
+}
+
+// AuthResponse carries a new token pair. In the cookie auth mode the tokens
+// are set as cookies instead, and the response carries the CSRF token.
+type AuthResponse struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken    string `json:"csrf_token,omitempty"`
 	User         User   `json:"user"`
 }
 
 type CreateProjectRequest struct {
-	Name        string  `json:"name" binding:"required,min=1,max=255"`
-	Description *string `json:"description"`
-	Color       string  `json:"color"`
+	Name         string  `json:"name" binding:"required,min=1,max=255"`
+	Description  *string `json:"description"`
+	Color        string  `json:"color"`
+	EstimateUnit string  `json:"estimate_unit" binding:"omitempty,oneof=hours points"`
 }
 
 type UpdateProjectRequest struct {
-	Name        *string `json:"name"`
-	Description *string `json:"description"`
-	Color       *string `json:"color"`
+	Name         *string `json:"name"`
+	Description  *string `json:"description"`
+	Color        *string `json:"color"`
+	EstimateUnit *string `json:"estimate_unit" binding:"omitempty,oneof=hours points"`
+}
+
+type AddMemberRequest struct {
+	UserID *int        `json:"user_id"`
+	Email  *string     `json:"email"`
+	Role   ProjectRole `json:"role" binding:"required"`
+}
+
+type UpdateMemberRequest struct {
+	Role ProjectRole `json:"role" binding:"required"`
+}
+
+type ProjectInvitation struct {
+	ID          int         `json:"id"`
+	ProjectID   int         `json:"project_id"`
+	ProjectName string      `json:"project_name,omitempty"`
+	Email       string      `json:"email"`
+	Role        ProjectRole `json:"role"`
+	Status      string      `json:"status"`
+	InvitedBy   *int        `json:"invited_by,omitempty"`
+	Inviter     *User       `json:"inviter,omitempty"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+type CreateInvitationRequest struct {
+	Email string      `json:"email" binding:"required,email"`
+	Role  ProjectRole `json:"role" binding:"required"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// MeResponse is the current user together with the project invitations
+// waiting for them.
+type MeResponse struct {
+	User
+	PendingInvitations []ProjectInvitation `json:"pending_invitations"`
 }
 
 type CreateBoardRequest struct {
 	Name     string `json:"name" binding:"required,min=1,max=255"`
 	Position int    `json:"position"`
+	StatusID *int   `json:"status_id"`
 }
 
 type UpdateBoardRequest struct {
 	Name     *string `json:"name"`
 	Position *int    `json:"position"`
+	// A StatusID of 0 unmaps the board
+	StatusID *int `json:"status_id"`
 }
 
 type CreateTaskRequest struct {
@@ -133,17 +639,33 @@ type CreateTaskRequest struct {
 	AssigneeID  *int       `json:"assignee_id"`
 	DueDate     *time.Time `json:"due_date"`
 	LabelIDs    []int      `json:"label_ids"`
+	// RemainingEstimate defaults to OriginalEstimate
+	OriginalEstimate  *float64 `json:"original_estimate" binding:"omitempty,min=0,max=99999999"`
+	RemainingEstimate *float64 `json:"remaining_estimate" binding:"omitempty,min=0,max=99999999"`
+	// RecurrenceRule repeats the task on a schedule, or after each
+	// completion when RecurAfterCompletion is set
+	RecurrenceRule       *string `json:"recurrence_rule"`
+	RecurAfterCompletion bool    `json:"recur_after_completion"`
+	// CustomFields sets custom field values by field ID
+	CustomFields map[int]json.RawMessage `json:"custom_fields"`
 }
 
 type UpdateTaskRequest struct {
-	Title       *string    `json:"title"`
-	Description *string    `json:"description"`
-	Status      *string    `json:"status"`
-	Priority    *string    `json:"priority"`
-	AssigneeID  *int       `json:"assignee_id"`
-	DueDate     *time.Time `json:"due_date"`
-	Position    *int       `json:"position"`
-	LabelIDs    []int      `json:"label_ids"`
+	Title             *string    `json:"title"`
+	Description       *string    `json:"description"`
+	Status            *string    `json:"status"`
+	Priority          *string    `json:"priority"`
+	AssigneeID        *int       `json:"assignee_id"`
+	DueDate           *time.Time `json:"due_date"`
+	Position          *int       `json:"position"`
+	LabelIDs          []int      `json:"label_ids"`
+	OriginalEstimate  *float64   `json:"original_estimate" binding:"omitempty,min=0,max=99999999"`
+	RemainingEstimate *float64   `json:"remaining_estimate" binding:"omitempty,min=0,max=99999999"`
+	// An empty RecurrenceRule stops the task from repeating
+	RecurrenceRule       *string `json:"recurrence_rule"`
+	RecurAfterCompletion *bool   `json:"recur_after_completion"`
+	// CustomFields sets custom field values by field ID; null clears one
+	CustomFields map[int]json.RawMessage `json:"custom_fields"`
 }
 
 type MoveTaskRequest struct {
@@ -156,6 +678,98 @@ type CreateLabelRequest struct {
 	Color string `json:"color"`
 }
 
+type CreateStatusRequest struct {
+	Key      string `json:"key" binding:"required,min=1,max=50"`
+	Name     string `json:"name" binding:"required,min=1,max=100"`
+	Category string `json:"category" binding:"required,oneof=todo in_progress done"`
+}
+
+type UpdateStatusRequest struct {
+	Name     *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Category *string `json:"category" binding:"omitempty,oneof=todo in_progress done"`
+	Position *int    `json:"position"`
+}
+
+// UpdateTransitionsRequest replaces the transitions of a project; an empty
+// list lets tasks change between any statuses.
+type UpdateTransitionsRequest struct {
+	Transitions []StatusTransition `json:"transitions" binding:"dive"`
+}
+
+// CreateTimeEntryRequest logs time by hand, from StartedAt until EndedAt or
+// for DurationSeconds.
+type CreateTimeEntryRequest struct {
+	StartedAt       time.Time  `json:"started_at" binding:"required"`
+	EndedAt         *time.Time `json:"ended_at"`
+	DurationSeconds *int       `json:"duration_seconds" binding:"omitempty,min=1,max=86400"`
+	Note            *string    `json:"note" binding:"omitempty,max=1000"`
+}
+
+type UpdateTimeEntryRequest struct {
+	StartedAt       *time.Time `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at"`
+	DurationSeconds *int       `json:"duration_seconds" binding:"omitempty,min=1,max=86400"`
+	Note            *string    `json:"note" binding:"omitempty,max=1000"`
+}
+
+type StartTimerRequest struct {
+	Note *string `json:"note" binding:"omitempty,max=1000"`
+}
+
+// CreatePriorityRequest adds a priority; without a rank it becomes the most
+// urgent.
+type CreatePriorityRequest struct {
+	Key       string `json:"key" binding:"required,min=1,max=20"`
+	Name      string `json:"name" binding:"required,min=1,max=100"`
+	Color     string `json:"color" binding:"omitempty,hexcolor,len=7"`
+	Rank      *int   `json:"rank"`
+	IsDefault bool   `json:"is_default"`
+}
+
+// UpdatePriorityRequest changes a priority. Making it the default unsets
+// the previous default; the default cannot be unset directly.
+type UpdatePriorityRequest struct {
+	Name      *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Color     *string `json:"color" binding:"omitempty,hexcolor,len=7"`
+	Rank      *int    `json:"rank"`
+	IsDefault *bool   `json:"is_default"`
+}
+
+type CreateCustomFieldRequest struct {
+	Name    string   `json:"name" binding:"required,min=1,max=100"`
+	Type    string   `json:"type" binding:"required,oneof=text number date single_select multi_select user url checkbox"`
+	Options []string `json:"options"`
+}
+
+// UpdateCustomFieldRequest changes a custom field; its type cannot change.
+// Removing an option clears it from the tasks using it.
+type UpdateCustomFieldRequest struct {
+	Name     *string  `json:"name" binding:"omitempty,min=1,max=100"`
+	Options  []string `json:"options"`
+	Position *int     `json:"position"`
+}
+
+type CreateChecklistItemRequest struct {
+	Text string `json:"text" binding:"required,min=1,max=500"`
+	Done bool   `json:"done"`
+}
+
+type UpdateChecklistItemRequest struct {
+	Text *string `json:"text" binding:"omitempty,min=1,max=500"`
+	Done *bool   `json:"done"`
+}
+
+// ReorderRequest lists every item of a list in its new order.
+type ReorderRequest struct {
+	IDs []int `json:"ids" binding:"required"`
+}
+
+// CreateDependencyRequest links the task in the URL to TaskID.
+type CreateDependencyRequest struct {
+	Type   string `json:"type" binding:"required,oneof=blocks blocked_by relates_to"`
+	TaskID int    `json:"task_id" binding:"required"`
+}
+
 type CreateCommentRequest struct {
 	Content string `json:"content" binding:"required,min=1"`
 }
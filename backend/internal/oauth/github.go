@@ -0,0 +1,65 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+const githubAPIURL = "https://api.github.com"
+
+func NewGitHub(clientID, clientSecret, redirectURL string) Provider {
+	return newGitHub(clientID, clientSecret, redirectURL, github.Endpoint, githubAPIURL)
+}
+
+func newGitHub(clientID, clientSecret, redirectURL string, endpoint oauth2.Endpoint, apiURL string) Provider {
+	return &oauthProvider{
+		name: "github",
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"read:user", "user:email"},
+			Endpoint:     endpoint,
+		},
+		identify: func(ctx context.Context, client *http.Client) (*Identity, error) {
+			var user struct {
+				ID        int64  `json:"id"`
+				Login     string `json:"login"`
+				Name      string `json:"name"`
+				AvatarURL string `json:"avatar_url"`
+			}
+			if err := getJSON(ctx, client, apiURL+"/user", &user); err != nil {
+				return nil, err
+			}
+
+			// The profile email is optional and unverified; use the primary
+			// address from the emails endpoint instead
+			var emails []struct {
+				Email    string `json:"email"`
+				Primary  bool   `json:"primary"`
+				Verified bool   `json:"verified"`
+			}
+			if err := getJSON(ctx, client, apiURL+"/user/emails", &emails); err != nil {
+				return nil, err
+			}
+
+			identity := &Identity{
+				Subject:   strconv.FormatInt(user.ID, 10),
+				Name:      user.Name,
+				Username:  user.Login,
+				AvatarURL: user.AvatarURL,
+			}
+			for _, email := range emails {
+				if email.Primary {
+					identity.Email = email.Email
+					identity.EmailVerified = email.Verified
+				}
+			}
+			return identity, nil
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const googleUserInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
+
+func NewGoogle(clientID, clientSecret, redirectURL string) Provider {
+	return &oauthProvider{
+		name: "google",
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes: []string{
+				"https://www.googleapis.com/auth/userinfo.email",
+				"https://www.googleapis.com/auth/userinfo.profile",
+			},
+			Endpoint: google.Endpoint,
+		},
+		identify: func(ctx context.Context, client *http.Client) (*Identity, error) {
+			var user struct {
+				ID            string `json:"id"`
+				Email         string `json:"email"`
+				VerifiedEmail bool   `json:"verified_email"`
+				Name          string `json:"name"`
+				Picture       string `json:"picture"`
+			}
+			if err := getJSON(ctx, client, googleUserInfoURL, &user); err != nil {
+				return nil, err
+			}
+
+			return &Identity{
+				Subject:       user.ID,
+				Email:         user.Email,
+				EmailVerified: user.VerifiedEmail,
+				Name:          user.Name,
+				Username:      user.Name,
+				AvatarURL:     user.Picture,
+			}, nil
+		},
+	}
+}
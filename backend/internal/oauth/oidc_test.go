@@ -0,0 +1,151 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// mockServer is a minimal OIDC issuer and GitHub API. It hands out the code
+// "test-code" and only redeems it with the PKCE verifier matching the
+// challenge of the last authorization request.
+type mockServer struct {
+	*httptest.Server
+	challenge string
+}
+
+func newMockServer(t *testing.T) *mockServer {
+	m := &mockServer{}
+	mux := http.NewServeMux()
+
+	discovery := func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"userinfo_endpoint":      m.URL + "/userinfo",
+		})
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", discovery)
+	// Served under another path, the document names the wrong issuer
+	mux.HandleFunc("/realms/other/.well-known/openid-configuration", discovery)
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "test-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "test-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer test-access-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("/userinfo", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":                "kc-123",
+			"email":              "jane@example.com",
+			"email_verified":     true,
+			"name":               "Jane Doe",
+			"preferred_username": "jane",
+		})
+	}))
+	mux.HandleFunc("/user", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "login": "octocat", "name": "Octo Cat"})
+	}))
+	mux.HandleFunc("/user/emails", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"email": "octo@users.noreply.github.com", "primary": false, "verified": true},
+			{"email": "octo@example.com", "primary": true, "verified": true},
+		})
+	}))
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// authorize follows the provider's authorization URL the way the mock
+// issuer would, remembering the PKCE challenge.
+func (m *mockServer) authorize(t *testing.T, p Provider, verifier string) {
+	u, err := url.Parse(p.AuthCodeURL("some-state", verifier))
+	require.NoError(t, err)
+	assert.Equal(t, "some-state", u.Query().Get("state"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	m.challenge = u.Query().Get("code_challenge")
+}
+
+func TestOIDCProvider(t *testing.T) {
+	server := newMockServer(t)
+	ctx := context.Background()
+
+	p, err := NewOIDC(ctx, "keycloak", server.URL+"/", "client", "secret", "http://localhost/callback", []string{"openid", "email"})
+	require.NoError(t, err)
+	assert.Equal(t, "keycloak", p.Name())
+
+	verifier := oauth2.GenerateVerifier()
+	server.authorize(t, p, verifier)
+
+	identity, err := p.Exchange(ctx, "test-code", verifier)
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Provider:      "keycloak",
+		Subject:       "kc-123",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Name:          "Jane Doe",
+		Username:      "jane",
+	}, identity)
+
+	// A different verifier fails the PKCE check
+	_, err = p.Exchange(ctx, "test-code", oauth2.GenerateVerifier())
+	assert.Error(t, err)
+}
+
+func TestOIDCDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	server := newMockServer(t)
+
+	_, err := NewOIDC(context.Background(), "oidc", server.URL+"/realms/other", "client", "secret", "", nil)
+	assert.Error(t, err)
+}
+
+func TestGitHubProvider(t *testing.T) {
+	server := newMockServer(t)
+	ctx := context.Background()
+
+	p := newGitHub("client", "secret", "http://localhost/callback",
+		oauth2.Endpoint{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token"}, server.URL)
+
+	verifier := oauth2.GenerateVerifier()
+	server.authorize(t, p, verifier)
+
+	identity, err := p.Exchange(ctx, "test-code", verifier)
+	require.NoError(t, err)
+	assert.Equal(t, "github", identity.Provider)
+	assert.Equal(t, "42", identity.Subject)
+	assert.Equal(t, "octocat", identity.Username)
+	assert.Equal(t, "octo@example.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+}
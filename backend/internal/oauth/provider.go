@@ -0,0 +1,111 @@
+// Package oauth implements the external sign-in providers: Google, GitHub and
+// any OpenID Connect issuer that supports discovery.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// requestTimeout bounds each call to a provider: OIDC discovery at startup,
+// and the code exchange with the identity lookup in a callback.
+const requestTimeout = 10 * time.Second
+
+// httpClient is used for every request to a provider, instead of
+// http.DefaultClient, which never times out.
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+// Identity is the account a provider vouches for after a successful login.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+	AvatarURL     string
+}
+
+// Provider runs the authorization code flow against one identity provider.
+type Provider interface {
+	Name() string
+	// AuthCodeURL returns the URL to send the browser to, with a PKCE
+	// challenge derived from verifier.
+	AuthCodeURL(state, verifier string) string
+	// Exchange redeems an authorization code and returns the identity.
+	Exchange(ctx context.Context, code, verifier string) (*Identity, error)
+	// RedirectURL is the configured callback URL on this API.
+	RedirectURL() string
+}
+
+// oauthProvider implements Provider for an oauth2.Config and a function
+// that loads the identity with an authenticated client.
+type oauthProvider struct {
+	name     string
+	config   *oauth2.Config
+	identify func(ctx context.Context, client *http.Client) (*Identity, error)
+}
+
+func (p *oauthProvider) Name() string {
+	return p.name
+}
+
+func (p *oauthProvider) RedirectURL() string {
+	return p.config.RedirectURL
+}
+
+func (p *oauthProvider) AuthCodeURL(state, verifier string) string {
+	return p.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+func (p *oauthProvider) Exchange(ctx context.Context, code, verifier string) (*Identity, error) {
+	// The client oauth2 builds for the identity lookup keeps only the
+	// transport of httpClient, so the deadline bounds it instead
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+
+	identity, err := p.identify(ctx, p.config.Client(ctx, token))
+	if err != nil {
+		return nil, err
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%s returned no account ID", p.name)
+	}
+
+	identity.Provider = p.name
+	return identity, nil
+}
+
+// getJSON fetches url with client and decodes the JSON response into v.
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("GET %s: %s: %s", url, resp.Status, body)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
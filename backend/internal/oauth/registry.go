@@ -0,0 +1,60 @@
+package oauth
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/mochammadshenna/4me-backend/internal/config"
+)
+
+// Registry holds the providers enabled in the configuration by name.
+type Registry struct {
+	providers map[string]Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider)}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// NewRegistryFromConfig enables every provider with a client ID. OIDC
+// discovery runs here, so a misconfigured issuer fails at startup.
+func NewRegistryFromConfig(ctx context.Context, cfg *config.Config) (*Registry, error) {
+	var providers []Provider
+
+	if cfg.GoogleClientID != "" {
+		providers = append(providers, NewGoogle(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleRedirectURL))
+	}
+	if cfg.GitHubClientID != "" {
+		providers = append(providers, NewGitHub(cfg.GitHubClientID, cfg.GitHubClientSecret, cfg.GitHubRedirectURL))
+	}
+	if cfg.OIDCClientID != "" {
+		p, err := NewOIDC(ctx, cfg.OIDCName, cfg.OIDCIssuerURL, cfg.OIDCClientID, cfg.OIDCClientSecret,
+			cfg.OIDCRedirectURL, strings.Fields(cfg.OIDCScopes))
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+
+	return NewRegistry(providers...), nil
+}
+
+func (r *Registry) Get(name string) (Provider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names returns the names of the enabled providers in alphabetical order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,55 @@
+package oauth
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	minUsernameLength = 3
+	// maxUsernameBase leaves room for a numeric suffix within the 50
+	// characters allowed for usernames.
+	maxUsernameBase = 40
+)
+
+// UsernameBase derives a username from the identity's provider username,
+// display name or email, in that order. The result only contains lowercase
+// letters, digits, dots, dashes and underscores and may already be taken.
+func (i *Identity) UsernameBase() string {
+	local, _, _ := strings.Cut(i.Email, "@")
+	for _, candidate := range []string{i.Username, i.Name, local} {
+		if base := sanitizeUsername(candidate); len(base) >= minUsernameLength {
+			return base
+		}
+	}
+	return "user"
+}
+
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	separator := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if separator && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			separator = false
+			b.WriteRune(r)
+		case r == '.' || r == '-' || r == '_':
+			if separator && b.Len() > 0 {
+				b.WriteByte('_')
+				separator = false
+			}
+			if b.Len() > 0 {
+				b.WriteRune(r)
+			}
+		default:
+			separator = true
+		}
+		if b.Len() >= maxUsernameBase {
+			break
+		}
+	}
+	return strings.TrimRight(b.String()[:min(b.Len(), maxUsernameBase)], ".-_")
+}
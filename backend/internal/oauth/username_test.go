@@ -0,0 +1,26 @@
+package oauth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsernameBase(t *testing.T) {
+	tests := []struct {
+		identity Identity
+		want     string
+	}{
+		{Identity{Username: "octocat"}, "octocat"},
+		{Identity{Name: "Jane Doe"}, "jane_doe"},
+		{Identity{Name: "  José  García "}, "jos_garc_a"},
+		{Identity{Name: "李小龍", Email: "bruce.lee@example.com"}, "bruce.lee"},
+		{Identity{Name: "Al", Email: "al@example.com"}, "user"},
+		{Identity{Username: "--weird--name--"}, "weird--name"},
+		{Identity{Name: "a very long display name that keeps going and going"}, "a_very_long_display_name_that_keeps_goin"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.identity.UsernameBase(), "%+v", tt.identity)
+	}
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/config"
+)
+
+// APILimiter limits requests to the whole API per client IP, per user and per
+// personal access token, and reports the limits in X-RateLimit-* headers.
+// A limit of zero requests is off.
+type APILimiter struct {
+	store Store
+	ip    Limit
+	user  Limit
+	token Limit
+}
+
+func NewAPI(store Store, ip, user, token Limit) *APILimiter {
+	return &APILimiter{
+		store: store,
+		ip:    ip,
+		user:  user,
+		token: token,
+	}
+}
+
+// NewAPIFromConfig creates the limiter of the API with the limits in cfg.
+func NewAPIFromConfig(cfg *config.Config, store Store) *APILimiter {
+	return NewAPI(store,
+		Limit{Requests: cfg.APIRateLimitPerIP, Per: time.Minute},
+		Limit{Requests: cfg.APIRateLimitPerUser, Per: time.Minute},
+		Limit{Requests: cfg.APIRateLimitPerToken, Per: time.Minute},
+	)
+}
+
+// ByIP limits the requests of each client IP.
+func (l *APILimiter) ByIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !l.allow(c, "api-ip:"+c.ClientIP(), l.ip) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ByUser limits the requests of the authenticated user. Requests with a
+// personal access token count against the token and against its owner. It
+// must run after the auth middleware.
+func (l *APILimiter) ByUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tokenID, ok := c.Get("accessTokenID"); ok {
+			if !l.allow(c, "api-token:"+strconv.Itoa(tokenID.(int)), l.token) {
+				c.Abort()
+				return
+			}
+		}
+
+		userID, _ := c.Get("userID")
+		if !l.allow(c, "api-user:"+strconv.Itoa(userID.(int)), l.user) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// allow counts a request against a bucket and sets the rate limit headers.
+// Otherwise it writes the error response and returns false.
+func (l *APILimiter) allow(c *gin.Context, key string, limit Limit) bool {
+	if limit.Requests <= 0 {
+		return true
+	}
+
+	result, err := l.store.Allow(c.Request.Context(), key, limit)
+	if err != nil {
+		log.Printf("Rate limiter unavailable: %v", err)
+		return true
+	}
+
+	setHeaders(c, result)
+	if !result.Allowed {
+		TooManyRequests(c, result.RetryAfter, "Rate limit exceeded; try again later")
+		return false
+	}
+	return true
+}
+
+// setHeaders reports a bucket in the X-RateLimit-* headers, unless the
+// request was allowed and a bucket with fewer requests remaining was already
+// reported. X-RateLimit-Reset is the number of seconds until the bucket is
+// full again.
+func setHeaders(c *gin.Context, result Result) {
+	header := c.Writer.Header()
+	if current := header.Get("X-RateLimit-Remaining"); current != "" && result.Allowed {
+		if remaining, err := strconv.Atoi(current); err == nil && remaining <= result.Remaining {
+			return
+		}
+	}
+
+	header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+}
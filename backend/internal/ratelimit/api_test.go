@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPILimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewAPI(NewMemoryStore(),
+		Limit{Requests: 10, Per: time.Minute},
+		Limit{Requests: 5, Per: time.Minute},
+		Limit{Requests: 2, Per: time.Minute})
+
+	router := gin.New()
+	router.Use(limiter.ByIP(), func(c *gin.Context) {
+		c.Set("userID", 1)
+		if c.GetHeader("Authorization") != "" {
+			c.Set("accessTokenID", 7)
+		}
+		c.Next()
+	}, limiter.ByUser())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(token bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if token {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The headers describe the bucket with the fewest requests left
+	w := get(false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "4", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "12", w.Header().Get("X-RateLimit-Reset"))
+
+	w = get(true)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+
+	get(true)
+	w = get(true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":"rate_limited"`)
+
+	// The token's requests counted against its owner too
+	w = get(false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/config"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+// Limiter applies the limits of the authentication endpoints: a token bucket
+// per client IP, a token bucket per account, and a lockout of accounts after
+// repeated failures. A limit of zero requests, or a lockout after zero
+// failures, is off.
+//
+// Store errors are logged and the request is let through, so an outage of
+// the store does not lock everyone out.
+type Limiter struct {
+	store   Store
+	ip      Limit
+	account Limit
+	lockout Lockout
+}
+
+func New(store Store, ip, account Limit, lockout Lockout) *Limiter {
+	return &Limiter{
+		store:   store,
+		ip:      ip,
+		account: account,
+		lockout: lockout,
+	}
+}
+
+// NewStore creates the store selected by cfg.RateLimitStore.
+func NewStore(cfg *config.Config, db *database.Database) (Store, error) {
+	switch cfg.RateLimitStore {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "postgres":
+		return NewPostgresStore(db), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimitStore)
+	}
+}
+
+// NewFromConfig creates the limiter of the authentication endpoints with the
+// limits in cfg.
+func NewFromConfig(cfg *config.Config, store Store) *Limiter {
+	return New(store,
+		Limit{Requests: cfg.AuthRateLimitPerIP, Per: time.Minute},
+		Limit{Requests: cfg.AuthRateLimitPerAccount, Per: time.Minute},
+		Lockout{
+			MaxFailures: cfg.LoginMaxFailures,
+			Window:      cfg.LoginFailureWindow,
+			Duration:    cfg.LoginLockoutDuration,
+		},
+	)
+}
+
+// ByIP limits the requests of each client IP. All routes using it share one
+// bucket per IP.
+func (l *Limiter) ByIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l.ip.Requests <= 0 {
+			c.Next()
+			return
+		}
+
+		result, err := l.store.Allow(c.Request.Context(), "auth-ip:"+c.ClientIP(), l.ip)
+		if err != nil {
+			log.Printf("Rate limiter unavailable: %v", err)
+			c.Next()
+			return
+		}
+		if !result.Allowed {
+			TooManyRequests(c, result.RetryAfter, "Too many requests; try again later")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Account counts an attempt against an account and checks that the account
+// is not locked out. Otherwise it writes the error response and returns
+// false. The key names the account, e.g. "login:alice"; keys are case
+// insensitive.
+func (l *Limiter) Account(c *gin.Context, key string) bool {
+	key = strings.ToLower(key)
+	ctx := c.Request.Context()
+
+	locked, err := l.store.Locked(ctx, key)
+	if err != nil {
+		log.Printf("Rate limiter unavailable: %v", err)
+		return true
+	}
+	if locked > 0 {
+		TooManyRequests(c, locked, "Too many failed attempts; try again later")
+		return false
+	}
+	if l.account.Requests <= 0 {
+		return true
+	}
+
+	result, err := l.store.Allow(ctx, "account:"+key, l.account)
+	if err != nil {
+		log.Printf("Rate limiter unavailable: %v", err)
+		return true
+	}
+	if !result.Allowed {
+		TooManyRequests(c, result.RetryAfter, "Too many attempts; try again later")
+		return false
+	}
+	return true
+}
+
+// Fail records a failed attempt for an account, which locks it once too
+// many failures were recorded.
+func (l *Limiter) Fail(c *gin.Context, key string) {
+	if l.lockout.MaxFailures <= 0 {
+		return
+	}
+
+	locked, err := l.store.Fail(c.Request.Context(), strings.ToLower(key), l.lockout)
+	if err != nil {
+		log.Printf("Failed to record failed attempt: %v", err)
+		return
+	}
+	if locked > 0 {
+		log.Printf("Locked out %s for %s after repeated failures", key, locked.Round(time.Second))
+	}
+}
+
+// Succeed forgets the failed attempts of an account.
+func (l *Limiter) Succeed(c *gin.Context, key string) {
+	if err := l.store.Reset(c.Request.Context(), strings.ToLower(key)); err != nil {
+		log.Printf("Failed to reset failed attempts: %v", err)
+	}
+}
+
+// TooManyRequests writes a 429 response telling the client when to retry.
+func TooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	c.Header("Retry-After", strconv.Itoa(retrySeconds(retryAfter)))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message, "code": models.ErrorCodeRateLimited})
+}
+
+// retrySeconds rounds a wait up to whole seconds, as Retry-After requires.
+func retrySeconds(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterZeroLimitsAreOff(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := New(NewMemoryStore(),
+		Limit{Requests: 0, Per: time.Minute},
+		Limit{Requests: 0, Per: time.Minute},
+		Lockout{MaxFailures: 0, Window: time.Minute, Duration: time.Minute})
+
+	router := gin.New()
+	router.POST("/login", limiter.ByIP(), func(c *gin.Context) {
+		if !limiter.Account(c, "login:alice") {
+			return
+		}
+		limiter.Fail(c, "login:alice")
+		c.Status(http.StatusUnauthorized)
+	})
+
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/login", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get("Retry-After"))
+	}
+}
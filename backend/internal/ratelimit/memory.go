@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle entries are dropped from memory.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// fullAt is when the bucket will have refilled; after that it can be
+	// dropped, since a missing bucket counts as full.
+	fullAt time.Time
+}
+
+type failures struct {
+	count       int
+	windowStart time.Time
+	lockedUntil time.Time
+	expires     time.Time
+}
+
+// MemoryStore keeps limits in process memory. Each instance of the server
+// has its own limits.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	failures  map[string]*failures
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		failures: make(map[string]*failures),
+		now:      time.Now,
+	}
+}
+
+func (s *MemoryStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), updated: now}
+		s.buckets[key] = b
+	}
+
+	tokens, result := take(b.tokens, now.Sub(b.updated), limit)
+	b.tokens = tokens
+	b.updated = now
+	b.fullAt = now.Add(result.Reset)
+
+	return result, nil
+}
+
+func (s *MemoryStore) Locked(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.failures[key]; ok {
+		if remaining := f.lockedUntil.Sub(s.now()); remaining > 0 {
+			return remaining, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, lockout Lockout) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	f, ok := s.failures[key]
+	if !ok {
+		f = &failures{lockedUntil: now}
+		s.failures[key] = f
+	}
+	if now.Sub(f.windowStart) > lockout.Window {
+		f.count = 0
+		f.windowStart = now
+	}
+
+	f.count++
+	if f.count >= lockout.MaxFailures {
+		// Start counting again once the lockout ends
+		f.count = 0
+		f.windowStart = now
+		f.lockedUntil = now.Add(lockout.Duration)
+	}
+
+	f.expires = f.windowStart.Add(lockout.Window)
+	if f.lockedUntil.After(f.expires) {
+		f.expires = f.lockedUntil
+	}
+
+	if remaining := f.lockedUntil.Sub(now); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+// sweep drops full buckets and expired failure counts. The caller must hold
+// s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.After(b.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, f := range s.failures {
+		if now.After(f.expires) {
+			delete(s.failures, key)
+		}
+	}
+}
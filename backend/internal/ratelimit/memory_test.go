@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore() (*MemoryStore, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	return store, &now
+}
+
+func TestMemoryStoreAllow(t *testing.T) {
+	ctx := context.Background()
+	store, now := newTestStore()
+	limit := Limit{Requests: 3, Per: time.Minute}
+
+	// The burst is allowed
+	for i := 2; i >= 0; i-- {
+		result, err := store.Allow(ctx, "ip:1", limit)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	// Then one request every 20 seconds
+	result, _ := store.Allow(ctx, "ip:1", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 20*time.Second, result.RetryAfter)
+	assert.Equal(t, time.Minute, result.Reset)
+
+	// Other keys have their own bucket
+	result, _ = store.Allow(ctx, "ip:2", limit)
+	assert.True(t, result.Allowed)
+
+	*now = now.Add(20 * time.Second)
+	result, _ = store.Allow(ctx, "ip:1", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+}
+
+func TestMemoryStoreLockout(t *testing.T) {
+	ctx := context.Background()
+	store, now := newTestStore()
+	lockout := Lockout{MaxFailures: 3, Window: 10 * time.Minute, Duration: 15 * time.Minute}
+
+	for i := 0; i < 2; i++ {
+		locked, err := store.Fail(ctx, "login:alice", lockout)
+		assert.NoError(t, err)
+		assert.Zero(t, locked)
+	}
+
+	locked, _ := store.Fail(ctx, "login:alice", lockout)
+	assert.Equal(t, 15*time.Minute, locked)
+
+	*now = now.Add(5 * time.Minute)
+	locked, _ = store.Locked(ctx, "login:alice")
+	assert.Equal(t, 10*time.Minute, locked)
+	locked, _ = store.Locked(ctx, "login:bob")
+	assert.Zero(t, locked)
+
+	*now = now.Add(10 * time.Minute)
+	locked, _ = store.Locked(ctx, "login:alice")
+	assert.Zero(t, locked)
+}
+
+func TestMemoryStoreFailureWindow(t *testing.T) {
+	ctx := context.Background()
+	store, now := newTestStore()
+	lockout := Lockout{MaxFailures: 2, Window: time.Minute, Duration: time.Hour}
+
+	store.Fail(ctx, "login:alice", lockout)
+	*now = now.Add(2 * time.Minute)
+
+	// The first failure is outside the window
+	locked, _ := store.Fail(ctx, "login:alice", lockout)
+	assert.Zero(t, locked)
+
+	// A success forgets the failures
+	assert.NoError(t, store.Reset(ctx, "login:alice"))
+	locked, _ = store.Fail(ctx, "login:alice", lockout)
+	assert.Zero(t, locked)
+
+	locked, _ = store.Fail(ctx, "login:alice", lockout)
+	assert.Equal(t, time.Hour, locked)
+}
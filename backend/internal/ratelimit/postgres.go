@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+)
+
+// cleanupInterval is how often each instance deletes idle rows.
+const cleanupInterval = 10 * time.Minute
+
+// PostgresStore keeps limits in the database, so every instance of the
+// server shares them. Time is taken from the database clock.
+type PostgresStore struct {
+	db *database.Database
+
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewPostgresStore(db *database.Database) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.cleanup(ctx)
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Create a full bucket or lock the existing one
+	var tokens, elapsed float64
+	err = tx.QueryRow(ctx,
+		`INSERT INTO rate_limit_buckets (key, tokens) VALUES ($1, $2)
+		 ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+		 RETURNING tokens, EXTRACT(EPOCH FROM NOW() - updated_at)::float8`,
+		key, float64(limit.Requests)).Scan(&tokens, &elapsed)
+	if err != nil {
+		return Result{}, err
+	}
+
+	tokens, result := take(tokens, seconds(elapsed), limit)
+
+	_, err = tx.Exec(ctx,
+		`UPDATE rate_limit_buckets
+		 SET tokens = $2, updated_at = NOW(), full_at = NOW() + make_interval(secs => $3)
+		 WHERE key = $1`,
+		key, tokens, result.Reset.Seconds())
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, tx.Commit(ctx)
+}
+
+func (s *PostgresStore) Locked(ctx context.Context, key string) (time.Duration, error) {
+	var remaining float64
+	err := s.db.Pool.QueryRow(ctx,
+		`SELECT EXTRACT(EPOCH FROM locked_until - NOW())::float8
+		 FROM rate_limit_lockouts
+		 WHERE key = $1 AND locked_until > NOW()`,
+		key).Scan(&remaining)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return seconds(remaining), nil
+}
+
+func (s *PostgresStore) Fail(ctx context.Context, key string, lockout Lockout) (time.Duration, error) {
+	// Count the failure in the current window, or start a new window. The
+	// failure that reaches the limit locks the key and starts counting again.
+	// Every expression of the update reads the row as it was before, so the
+	// new count is spelled out wherever it is needed.
+	const (
+		expired = "l.window_started_at < NOW() - make_interval(secs => $2)"
+		count   = "CASE WHEN " + expired + " THEN 1 ELSE l.failures + 1 END"
+		reached = "(" + count + ") >= $3"
+		started = "CASE WHEN " + reached + " OR " + expired + " THEN NOW() ELSE l.window_started_at END"
+		locked  = "CASE WHEN " + reached + " THEN NOW() + make_interval(secs => $4) ELSE l.locked_until END"
+	)
+	var remaining float64
+	err := s.db.Pool.QueryRow(ctx,
+		`INSERT INTO rate_limit_lockouts AS l (key, failures, window_started_at, locked_until, expires_at)
+		 VALUES ($1,
+		         CASE WHEN 1 >= $3 THEN 0 ELSE 1 END,
+		         NOW(),
+		         CASE WHEN 1 >= $3 THEN NOW() + make_interval(secs => $4) END,
+		         GREATEST(NOW() + make_interval(secs => $2),
+		                  CASE WHEN 1 >= $3 THEN NOW() + make_interval(secs => $4) END))
+		 ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN `+reached+` THEN 0 ELSE `+count+` END,
+			window_started_at = `+started+`,
+			locked_until = `+locked+`,
+			expires_at = GREATEST((`+started+`) + make_interval(secs => $2), `+locked+`)
+		 RETURNING GREATEST(EXTRACT(EPOCH FROM l.locked_until - NOW())::float8, 0)`,
+		key, lockout.Window.Seconds(), lockout.MaxFailures, lockout.Duration.Seconds()).Scan(&remaining)
+	if err != nil {
+		return 0, err
+	}
+	return seconds(remaining), nil
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.Pool.Exec(ctx, "DELETE FROM rate_limit_lockouts WHERE key = $1", key)
+	return err
+}
+
+// cleanup deletes full buckets and expired failure counts at most once per
+// cleanupInterval.
+func (s *PostgresStore) cleanup(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastCleanup) < cleanupInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastCleanup = time.Now()
+	s.mu.Unlock()
+
+	if _, err := s.db.Pool.Exec(ctx, "DELETE FROM rate_limit_buckets WHERE full_at < NOW()"); err != nil {
+		log.Printf("Failed to clean up rate limit buckets: %v", err)
+	}
+	if _, err := s.db.Pool.Exec(ctx, "DELETE FROM rate_limit_lockouts WHERE expires_at < NOW()"); err != nil {
+		log.Printf("Failed to clean up rate limit lockouts: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Package ratelimit throttles requests with token buckets and locks out
+// accounts after repeated failed attempts. State lives in a Store: the
+// in-memory store suits a single instance, and the Postgres store shares
+// limits between replicas.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit allows Requests requests per Per on average, with bursts of up to
+// Requests requests.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result describes the bucket after a request was counted against it.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long to wait until the next request is allowed; it
+	// is zero when this one was allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Lockout locks a key for Duration once MaxFailures failures were recorded
+// within Window.
+type Lockout struct {
+	MaxFailures int
+	Window      time.Duration
+	Duration    time.Duration
+}
+
+// Store keeps token buckets and failure counts by key.
+type Store interface {
+	// Allow counts a request against the bucket key.
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	// Locked returns how long key stays locked out, or zero.
+	Locked(ctx context.Context, key string) (time.Duration, error)
+	// Fail records a failed attempt for key and returns how long key is now
+	// locked out, or zero.
+	Fail(ctx context.Context, key string, lockout Lockout) (time.Duration, error)
+	// Reset forgets the failed attempts of key.
+	Reset(ctx context.Context, key string) error
+}
+
+// take refills a bucket that held tokens elapsed ago and takes one token if
+// there is one. It returns the tokens left and the result.
+func take(tokens float64, elapsed time.Duration, limit Limit) (float64, Result) {
+	burst := float64(limit.Requests)
+	rate := limit.rate()
+
+	tokens = math.Min(burst, tokens+elapsed.Seconds()*rate)
+
+	result := Result{Limit: limit.Requests}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = seconds((burst - tokens) / rate)
+
+	return tokens, result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
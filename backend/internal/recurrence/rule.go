@@ -0,0 +1,283 @@
+// Package recurrence repeats tasks. Rules are written in a subset of the
+// RFC 5545 RRULE syntax:
+//
+//	FREQ=DAILY;INTERVAL=3
+//	FREQ=WEEKLY;BYDAY=MO,WE,FR
+//	FREQ=MONTHLY;BYMONTHDAY=1,-1;UNTIL=20251231
+//
+// FREQ is DAILY, WEEKLY or MONTHLY; INTERVAL, BYDAY (weekly rules only),
+// BYMONTHDAY (monthly rules only) and UNTIL are optional. Weeks start on
+// Monday, and months without a given day are skipped.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+const maxInterval = 1000
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// ByDay lists the weekdays of weekly rules; empty means the weekday of
+	// the start
+	ByDay []time.Weekday
+	// ByMonthDay lists the days of monthly rules, negative days counting
+	// from the end of the month; empty means the day of the start
+	ByMonthDay []int
+	Until      *time.Time
+}
+
+// Parse parses a rule, with or without an "RRULE:" prefix.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	if s == "" {
+		return nil, errors.New("recurrence rule is empty")
+	}
+
+	r := &Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%s is given twice", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			r.Freq = Frequency(value)
+			if r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly {
+				return nil, fmt.Errorf("FREQ must be DAILY, WEEKLY or MONTHLY, not %s", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxInterval {
+				return nil, fmt.Errorf("INTERVAL must be a number from 1 to %d", maxInterval)
+			}
+			r.Interval = n
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY weekday %q; use MO, TU, WE, TH, FR, SA or SU", day)
+				}
+				r.ByDay = append(r.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q; use 1 to 31 or -31 to -1", day)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = &until
+		default:
+			return nil, fmt.Errorf("unsupported recurrence rule part %s", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("recurrence rule needs a FREQ")
+	}
+	if len(r.ByDay) > 0 && r.Freq != Weekly {
+		return nil, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != Monthly {
+		return nil, errors.New("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+
+	sort.Slice(r.ByDay, func(i, j int) bool { return weekdayIndex(r.ByDay[i]) < weekdayIndex(r.ByDay[j]) })
+	sort.Ints(r.ByMonthDay)
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A date includes the whole day
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("UNTIL must be a date like 20251231 or 20251231T235959Z")
+}
+
+// String returns the rule in canonical form.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, weekday := range r.ByDay {
+			days[i] = strings.ToUpper(weekday.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence after the given time of the series
+// starting at start, at the time of day of start. It returns false when the
+// series ended before then.
+func (r *Rule) Next(start, after time.Time) (time.Time, bool) {
+	var next time.Time
+	switch r.Freq {
+	case Daily:
+		next = r.nextDaily(start, after)
+	case Weekly:
+		next = r.nextWeekly(start, after)
+	case Monthly:
+		next = r.nextMonthly(start, after)
+	}
+
+	if next.IsZero() || (r.Until != nil && next.After(*r.Until)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// First returns the first occurrence of a series starting on the day of
+// from, at midnight.
+func (r *Rule) First(from time.Time) (time.Time, bool) {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	return r.Next(start, start.Add(-time.Nanosecond))
+}
+
+func (r *Rule) nextDaily(start, after time.Time) time.Time {
+	if after.Before(start) {
+		return start
+	}
+	// Skip whole intervals, then step past after
+	k := int(after.Sub(start).Hours()/24) / r.Interval
+	next := start.AddDate(0, 0, k*r.Interval)
+	for !next.After(after) {
+		next = next.AddDate(0, 0, r.Interval)
+	}
+	return next
+}
+
+func (r *Rule) nextWeekly(start, after time.Time) time.Time {
+	days := r.ByDay
+	if len(days) == 0 {
+		days = []time.Weekday{start.Weekday()}
+	}
+	firstWeek := start.AddDate(0, 0, -weekdayIndex(start.Weekday()))
+
+	day := start
+	if after.After(start) {
+		day = time.Date(after.Year(), after.Month(), after.Day(), start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+	// Every interval has a matching day within 7 * interval days
+	for i := 0; i <= 7*r.Interval+7; i, day = i+1, day.AddDate(0, 0, 1) {
+		if day.Before(start) || !day.After(after) || !containsWeekday(days, day.Weekday()) {
+			continue
+		}
+		weeks := int(day.Sub(firstWeek).Hours()/24) / 7
+		if weeks%r.Interval == 0 {
+			return day
+		}
+	}
+	return time.Time{}
+}
+
+func (r *Rule) nextMonthly(start, after time.Time) time.Time {
+	days := r.ByMonthDay
+	if len(days) == 0 {
+		days = []int{start.Day()}
+	}
+
+	from := start
+	if after.After(start) {
+		from = after
+	}
+	months := (from.Year()-start.Year())*12 + int(from.Month()-start.Month())
+	months -= months % r.Interval
+
+	// A month with a matching day comes at least every four intervals, even
+	// for BYMONTHDAY=31
+	for i := 0; i < 12*r.Interval+12; i += r.Interval {
+		first := time.Date(start.Year(), start.Month()+time.Month(months+i), 1, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+		length := first.AddDate(0, 1, -1).Day()
+
+		var candidates []int
+		for _, day := range days {
+			if day < 0 {
+				day = length + day + 1
+			}
+			if day >= 1 && day <= length {
+				candidates = append(candidates, day)
+			}
+		}
+		sort.Ints(candidates)
+
+		for _, day := range candidates {
+			next := first.AddDate(0, 0, day-1)
+			if !next.Before(start) && next.After(after) {
+				return next
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// weekdayIndex numbers weekdays from Monday.
+func weekdayIndex(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
+
+func containsWeekday(days []time.Weekday, d time.Weekday) bool {
+	for _, day := range days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParse(t *testing.T) {
+	r, err := Parse("rrule:freq=weekly;byday=fr,mo;interval=2")
+	require.NoError(t, err)
+	assert.Equal(t, Weekly, r.Freq)
+	assert.Equal(t, 2, r.Interval)
+	assert.Equal(t, []time.Weekday{time.Monday, time.Friday}, r.ByDay)
+	assert.Equal(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", r.String())
+
+	r, err = Parse("FREQ=MONTHLY;BYMONTHDAY=-1,15;UNTIL=20251231")
+	require.NoError(t, err)
+	assert.Equal(t, []int{-1, 15}, r.ByMonthDay)
+	assert.Equal(t, "FREQ=MONTHLY;BYMONTHDAY=-1,15;UNTIL=20251231T235959Z", r.String())
+
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;COUNT=5",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;UNTIL=tomorrow",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ",
+	} {
+		_, err := Parse(rule)
+		assert.Error(t, err, rule)
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		rule  string
+		start string
+		after string
+		want  string
+	}{
+		// Every third day, skipping missed occurrences
+		{"FREQ=DAILY;INTERVAL=3", "2025-03-01 09:00", "2025-03-01 09:00", "2025-03-04 09:00"},
+		{"FREQ=DAILY;INTERVAL=3", "2025-03-01 09:00", "2025-03-20 12:00", "2025-03-22 09:00"},
+		{"FREQ=DAILY", "2025-03-01 09:00", "2025-02-01 00:00", "2025-03-01 09:00"},
+		// Weekdays of the start's week, then every other week
+		{"FREQ=WEEKLY;BYDAY=MO,WE,FR", "2025-03-05 09:00", "2025-03-05 09:00", "2025-03-07 09:00"},
+		{"FREQ=WEEKLY;BYDAY=MO,WE,FR", "2025-03-05 09:00", "2025-03-07 10:00", "2025-03-10 09:00"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "2025-03-07 09:00", "2025-03-07 09:00", "2025-03-17 09:00"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "2025-03-07 09:00", "2025-03-17 09:00", "2025-03-21 09:00"},
+		{"FREQ=WEEKLY;INTERVAL=2", "2025-03-05 09:00", "2025-03-05 09:00", "2025-03-19 09:00"},
+		// Days of the month, counting back from the end and skipping short months
+		{"FREQ=MONTHLY", "2025-01-15 09:00", "2025-01-15 09:00", "2025-02-15 09:00"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "2025-01-31 09:00", "2025-01-31 09:00", "2025-02-28 09:00"},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", "2025-01-31 09:00", "2025-01-31 09:00", "2025-03-31 09:00"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,15", "2025-01-01 09:00", "2025-01-01 09:00", "2025-01-15 09:00"},
+		{"FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=10", "2025-01-10 09:00", "2025-05-01 00:00", "2025-07-10 09:00"},
+	}
+
+	for _, tt := range tests {
+		r, err := Parse(tt.rule)
+		require.NoError(t, err)
+
+		next, ok := r.Next(date(tt.start), date(tt.after))
+		require.True(t, ok, tt.rule)
+		assert.Equal(t, date(tt.want), next, "%s after %s", tt.rule, tt.after)
+	}
+}
+
+func TestNextUntil(t *testing.T) {
+	r, err := Parse("FREQ=WEEKLY;UNTIL=20250310")
+	require.NoError(t, err)
+
+	next, ok := r.Next(date("2025-03-03 09:00"), date("2025-03-03 09:00"))
+	require.True(t, ok)
+	assert.Equal(t, date("2025-03-10 09:00"), next)
+
+	_, ok = r.Next(date("2025-03-03 09:00"), next)
+	assert.False(t, ok)
+}
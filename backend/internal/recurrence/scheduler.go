@@ -0,0 +1,307 @@
+package recurrence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mochammadshenna/4me-backend/internal/database"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/workflow"
+)
+
+// batchSize is how many series the scheduler advances per run.
+const batchSize = 100
+
+// Scheduler creates the next instance of recurring tasks. Each run picks up
+// the latest instances that were completed or, for series repeating on a
+// schedule, whose due date has arrived, copies them with a new due date and
+// moves the rule to the copy. Instances share nothing but their history, so
+// editing one leaves the others alone.
+//
+// Instances count against the board's task quota like any other task. A
+// series whose next instance would exceed it ends instead.
+type Scheduler struct {
+	db               *database.Database
+	interval         time.Duration
+	maxTasksPerBoard int
+	now              func() time.Time
+
+	// after is the last task ID of the previous batch when it was full, so
+	// the next run continues past series that failed to advance
+	after int
+}
+
+func NewScheduler(db *database.Database, interval time.Duration, maxTasksPerBoard int) *Scheduler {
+	return &Scheduler{db: db, interval: interval, maxTasksPerBoard: maxTasksPerBoard, now: time.Now}
+}
+
+// Run advances due series every interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunOnce(ctx); err != nil {
+			log.Printf("Failed to create recurring tasks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce advances a batch of the series that are due and returns how many
+// instances it created. Batches go through the series in ID order and start
+// over once one comes back short. Several API instances can run it at once;
+// each series is advanced by one of them. A Scheduler must not run it
+// concurrently.
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx,
+		`SELECT id FROM tasks 
+		 WHERE recurrence_rule IS NOT NULL 
+		   AND (completed_at IS NOT NULL OR (NOT recur_after_completion AND due_date <= $1)) 
+		   AND id > $3 
+		 ORDER BY id 
+		 LIMIT $2`,
+		s.now().UTC(), batchSize, s.after)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return 0, err
+	}
+
+	s.after = 0
+	if len(ids) == batchSize {
+		s.after = ids[len(ids)-1]
+	}
+
+	created := 0
+	for _, id := range ids {
+		ok, err := s.advance(ctx, id)
+		if err != nil {
+			log.Printf("Failed to create the next instance of task %d: %v", id, err)
+			continue
+		}
+		if ok {
+			created++
+		}
+	}
+	return created, nil
+}
+
+// advance creates the next instance of a task, or ends its series when the
+// rule has no occurrences left or the board is full. It reports whether an instance was created.
+func (s *Scheduler) advance(ctx context.Context, taskID int) (bool, error) {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var rule string
+	var dueDate, completedAt *time.Time
+	var afterCompletion bool
+	var projectID, userID int
+	// History entries are attributed to whoever set the rule, or to the
+	// project owner once they are gone
+	err = tx.QueryRow(ctx,
+		`SELECT t.due_date, t.completed_at, t.recurrence_rule, t.recur_after_completion, 
+		        b.project_id, COALESCE(t.recurrence_set_by, p.user_id) 
+		 FROM tasks t 
+		 JOIN boards b ON t.board_id = b.id 
+		 JOIN projects p ON b.project_id = p.id 
+		 WHERE t.id = $1 AND t.recurrence_rule IS NOT NULL 
+		 FOR UPDATE OF t SKIP LOCKED`,
+		taskID).Scan(&dueDate, &completedAt, &rule, &afterCompletion, &projectID, &userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Advanced or edited meanwhile
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	now := s.now().UTC()
+	if completedAt == nil && (afterCompletion || dueDate == nil || dueDate.After(now)) {
+		return false, nil
+	}
+
+	next, ok := s.nextDueDate(rule, afterCompletion, dueDate, completedAt, now)
+	if !ok {
+		return false, endSeries(ctx, tx, taskID, userID, map[string]interface{}{
+			"recurrence_rule": rule,
+		})
+	}
+
+	flow, err := workflow.Load(ctx, tx, projectID)
+	if err != nil {
+		return false, err
+	}
+	initial := flow.Initial()
+
+	// A top-level task on a board mapped to another status than the initial
+	// one goes to the first board mapped to the initial status, if there is
+	// one.
+	var boardID int
+	err = tx.QueryRow(ctx,
+		`SELECT CASE WHEN t.parent_task_id IS NULL AND b.status_id <> $2 
+		             THEN COALESCE((SELECT nb.id FROM boards nb WHERE nb.project_id = b.project_id AND nb.status_id = $2 
+		                            ORDER BY nb.position, nb.id LIMIT 1), t.board_id) 
+		             ELSE t.board_id END 
+		 FROM tasks t 
+		 JOIN boards b ON t.board_id = b.id 
+		 WHERE t.id = $1`,
+		taskID, initial.ID).Scan(&boardID)
+	if err != nil {
+		return false, err
+	}
+
+	full, err := s.boardFull(ctx, tx, boardID)
+	if err != nil {
+		return false, err
+	}
+	if full {
+		log.Printf("Ending recurrence of task %d: board %d holds %d tasks", taskID, boardID, s.maxTasksPerBoard)
+		return false, endSeries(ctx, tx, taskID, userID, map[string]interface{}{
+			"recurrence_rule": rule,
+			"reason":          "quota_exceeded",
+			"quota":           models.QuotaTasksPerBoard,
+			"limit":           s.maxTasksPerBoard,
+		})
+	}
+
+	// The next instance starts in the project's initial status, with all of
+	// its original estimate remaining
+	var nextID int
+	var title string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO tasks (board_id, parent_task_id, subtask_position, title, description, priority, assignee_id, 
+		                    due_date, status, original_estimate, remaining_estimate, position, 
+		                    recurrence_rule, recur_after_completion, recurrence_set_by, recurs_from_task_id) 
+		 SELECT $4, 
+		        t.parent_task_id, 
+		        (SELECT COALESCE(MAX(s.subtask_position) + 1, 0) FROM tasks s WHERE s.parent_task_id = t.parent_task_id), 
+		        t.title, t.description, t.priority, t.assignee_id, 
+		        $2, $3, t.original_estimate, t.original_estimate, t.position, 
+		        t.recurrence_rule, t.recur_after_completion, t.recurrence_set_by, t.id 
+		 FROM tasks t 
+		 WHERE t.id = $1 
+		 RETURNING id, title`,
+		taskID, next, initial.Key, boardID).Scan(&nextID, &title)
+	if err != nil {
+		return false, err
+	}
+
+	// Labels, custom field values and checklist items carry over, with the
+	// items unchecked
+	_, err = tx.Exec(ctx,
+		"INSERT INTO task_labels (task_id, label_id) SELECT $2, label_id FROM task_labels WHERE task_id = $1",
+		taskID, nextID)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO task_custom_field_values (task_id, field_id, value) 
+		 SELECT $2, field_id, value FROM task_custom_field_values WHERE task_id = $1`,
+		taskID, nextID)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO checklist_items (task_id, text, done, position) 
+		 SELECT $2, text, FALSE, position FROM checklist_items WHERE task_id = $1`,
+		taskID, nextID)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE tasks SET recurrence_rule = NULL WHERE id = $1", taskID)
+	if err != nil {
+		return false, err
+	}
+
+	addHistory(ctx, tx, taskID, userID, "recurrence_continued", map[string]interface{}{
+		"next_task_id": nextID,
+		"due_date":     next,
+	})
+	addHistory(ctx, tx, nextID, userID, "created", map[string]interface{}{
+		"action":              "created",
+		"title":               title,
+		"recurs_from_task_id": taskID,
+		"recurrence_rule":     rule,
+	})
+
+	return true, tx.Commit(ctx)
+}
+
+// boardFull locks a board until tx ends and reports whether it holds as many
+// tasks as the quota allows. A max of zero is unlimited.
+func (s *Scheduler) boardFull(ctx context.Context, tx pgx.Tx, boardID int) (bool, error) {
+	if s.maxTasksPerBoard <= 0 {
+		return false, nil
+	}
+
+	var count int
+	err := tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM tasks
+		 WHERE board_id = (SELECT id FROM boards WHERE id = $1 FOR UPDATE)`,
+		boardID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count >= s.maxTasksPerBoard, nil
+}
+
+// endSeries removes the rule of a task, records why in its history and
+// commits tx.
+func endSeries(ctx context.Context, tx pgx.Tx, taskID, userID int, changes map[string]interface{}) error {
+	_, err := tx.Exec(ctx, "UPDATE tasks SET recurrence_rule = NULL WHERE id = $1", taskID)
+	if err != nil {
+		return err
+	}
+	addHistory(ctx, tx, taskID, userID, "recurrence_ended", changes)
+	return tx.Commit(ctx)
+}
+
+// nextDueDate returns the due date of the next instance. Series repeating
+// after completion count from the completion; others continue from the due
+// date, skipping occurrences that have already passed.
+func (s *Scheduler) nextDueDate(rule string, afterCompletion bool, dueDate, completedAt *time.Time, now time.Time) (time.Time, bool) {
+	r, err := Parse(rule)
+	if err != nil {
+		log.Printf("Ending recurrence with invalid rule %q: %v", rule, err)
+		return time.Time{}, false
+	}
+
+	if afterCompletion || dueDate == nil {
+		from := now
+		if completedAt != nil {
+			from = *completedAt
+		}
+		return r.Next(from, from)
+	}
+
+	after := now
+	if dueDate.After(now) {
+		after = *dueDate
+	}
+	return r.Next(*dueDate, after)
+}
+
+// addHistory records a change made by the scheduler. Like the handlers, it
+// ignores failures.
+func addHistory(ctx context.Context, tx pgx.Tx, taskID, userID int, action string, changes map[string]interface{}) {
+	changesJSON, _ := json.Marshal(changes)
+	_, _ = tx.Exec(ctx,
+		"INSERT INTO task_history (task_id, user_id, action, changes_json) VALUES ($1, $2, $3, $4)",
+		taskID, userID, action, changesJSON)
+}
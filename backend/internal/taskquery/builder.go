@@ -0,0 +1,40 @@
+package taskquery
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Builder accumulates WHERE conditions together with their positional
+// arguments.
+type Builder struct {
+	conds []string
+	args  []interface{}
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Arg registers a query argument and returns its placeholder.
+func (b *Builder) Arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// Where adds a condition; all conditions are combined with AND.
+func (b *Builder) Where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+// SQL returns the combined conditions, suitable for use after WHERE.
+func (b *Builder) SQL() string {
+	if len(b.conds) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(b.conds, " AND ")
+}
+
+func (b *Builder) Args() []interface{} {
+	return b.args
+}
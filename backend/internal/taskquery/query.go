@@ -0,0 +1,592 @@
+// Package taskquery parses the query-string filter language accepted by the
+// task list endpoints and turns it into SQL conditions, ordering and keyset
+// pagination.
+//
+// Filters are written as field=value or field[op]=value, for example
+//
+//	?status=todo,in_progress&priority[ne]=low&due_date[lt]=2025-01-01&q=login
+//
+// Only whitelisted fields and operators are accepted. A comma separated
+// value without an explicit operator is treated as "in". Custom fields are
+// filtered as cf.<field ID>, e.g. cf.12[gte]=3, once their types are known
+// (see SetCustomFieldTypes). Queries built from a Query expect the tasks
+// table to be aliased "t" and boards "b".
+package taskquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/utils"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 500
+
+	maxValues    = 50
+	maxTextValue = 200
+)
+
+type Operator string
+
+const (
+	OpEq   Operator = "eq"
+	OpNe   Operator = "ne"
+	OpIn   Operator = "in"
+	OpNin  Operator = "nin"
+	OpAll  Operator = "all"
+	OpGt   Operator = "gt"
+	OpGte  Operator = "gte"
+	OpLt   Operator = "lt"
+	OpLte  Operator = "lte"
+	OpNull Operator = "null"
+)
+
+type valueKind int
+
+const (
+	kindText valueKind = iota
+	kindInt
+	kindTime
+	kindNumber
+	kindBool
+)
+
+type field struct {
+	column string
+	kind   valueKind
+	ops    []Operator
+	// multi fields hold a JSON array and match when any value does
+	multi bool
+}
+
+// statusCategory selects the category of the task's status in its project.
+const statusCategory = "(SELECT s.category FROM project_statuses s WHERE s.project_id = b.project_id AND s.key = t.status)"
+
+var fields = map[string]field{
+	"status":          {column: "t.status", kind: kindText, ops: []Operator{OpEq, OpNe, OpIn, OpNin}},
+	"status_category": {column: statusCategory, kind: kindText, ops: []Operator{OpEq, OpNe, OpIn, OpNin}},
+	"priority":        {column: "t.priority", kind: kindText, ops: []Operator{OpEq, OpNe, OpIn, OpNin}},
+	"assignee_id":     {column: "t.assignee_id", kind: kindInt, ops: []Operator{OpEq, OpNe, OpIn, OpNin, OpNull}},
+	"board_id":        {column: "t.board_id", kind: kindInt, ops: []Operator{OpEq, OpNe, OpIn, OpNin}},
+	"parent_task_id":  {column: "t.parent_task_id", kind: kindInt, ops: []Operator{OpEq, OpNe, OpIn, OpNin, OpNull}},
+	"project_id":      {column: "b.project_id", kind: kindInt, ops: []Operator{OpEq, OpNe, OpIn, OpNin}},
+	"label":           {kind: kindInt, ops: []Operator{OpEq, OpNe, OpIn, OpNin, OpAll}},
+	"due_date":        {column: "t.due_date", kind: kindTime, ops: []Operator{OpEq, OpGt, OpGte, OpLt, OpLte, OpNull}},
+	"created_at":      {column: "t.created_at", kind: kindTime, ops: []Operator{OpGt, OpGte, OpLt, OpLte}},
+	"updated_at":      {column: "t.updated_at", kind: kindTime, ops: []Operator{OpGt, OpGte, OpLt, OpLte}},
+}
+
+// customValue selects the value of the custom field with ID %[1]d as text,
+// wrapped by the column of each custom field type.
+const customValue = "(SELECT v.value #>> '{}' FROM task_custom_field_values v WHERE v.task_id = t.id AND v.field_id = %[1]d)"
+
+var customFields = map[string]field{
+	models.CustomFieldText:         {column: customValue, kind: kindText, ops: []Operator{OpEq, OpNe, OpIn, OpNin, OpNull}},
+	models.CustomFieldURL:          {column: customValue, kind: kindText, ops: []Operator{OpEq, OpNe, OpIn, OpNin, OpNull}},
+	models.CustomFieldSingleSelect: {column: customValue, kind: kindText, ops: []Operator{OpEq, OpNe, OpIn, OpNin, OpNull}},
+	models.CustomFieldUser:         {column: customValue + "::int", kind: kindInt, ops: []Operator{OpEq, OpNe, OpIn, OpNin, OpNull}},
+	models.CustomFieldNumber:       {column: customValue + "::numeric", kind: kindNumber, ops: []Operator{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpNull}},
+	models.CustomFieldDate:         {column: customValue + "::timestamp", kind: kindTime, ops: []Operator{OpEq, OpGt, OpGte, OpLt, OpLte, OpNull}},
+	models.CustomFieldCheckbox:     {column: "COALESCE(" + customValue + "::boolean, FALSE)", kind: kindBool, ops: []Operator{OpEq}},
+	models.CustomFieldMultiSelect: {
+		column: "(SELECT v.value FROM task_custom_field_values v WHERE v.task_id = t.id AND v.field_id = %[1]d)",
+		kind:   kindText, ops: []Operator{OpEq, OpNe, OpIn, OpNin, OpAll, OpNull}, multi: true,
+	},
+}
+
+type sortField struct {
+	asc  string
+	desc string
+	cast string
+}
+
+// priorityRank selects the rank of the task's priority in its project.
+// Priorities the project doesn't define rank lowest.
+const priorityRank = "COALESCE((SELECT p.rank FROM project_priorities p WHERE p.project_id = b.project_id AND p.key = t.priority), -1)"
+
+var sortFields = map[string]sortField{
+	"position":   {asc: "t.position", desc: "t.position", cast: "int"},
+	"title":      {asc: "t.title", desc: "t.title", cast: "text"},
+	"priority":   {asc: priorityRank, desc: priorityRank, cast: "int"},
+	"created_at": {asc: "COALESCE(t.created_at, '-infinity'::timestamp)", desc: "COALESCE(t.created_at, '-infinity'::timestamp)", cast: "timestamp"},
+	"updated_at": {asc: "COALESCE(t.updated_at, '-infinity'::timestamp)", desc: "COALESCE(t.updated_at, '-infinity'::timestamp)", cast: "timestamp"},
+	// Tasks without a due date sort last in both directions.
+	"due_date": {asc: "COALESCE(t.due_date, 'infinity'::timestamp)", desc: "COALESCE(t.due_date, '-infinity'::timestamp)", cast: "timestamp"},
+}
+
+var keyPattern = regexp.MustCompile(`^([a-z_]+|cf\.[1-9][0-9]{0,8})(?:\[([a-z]+)\])?$`)
+
+// Error is returned for any invalid filter, sort or pagination parameter.
+type Error struct {
+	Param   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid query parameter %q: %s", e.Param, e.Message)
+}
+
+type condition struct {
+	field  string
+	def    field
+	op     Operator
+	values []interface{}
+	// day is set when a time is compared for equality with a bare date
+	day bool
+}
+
+// customFilter is a custom field filter waiting for the field's type.
+type customFilter struct {
+	key     string
+	raw     string
+	fieldID int
+}
+
+// Sort is the requested ordering. Ties are always broken by task ID.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// Cursor identifies the last task of a page.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+type Query struct {
+	Text   string
+	Sort   Sort
+	Limit  int
+	Cursor *Cursor
+
+	conditions []condition
+	custom     []customFilter
+}
+
+// Parse validates the query parameters of a task list request. defaultSort
+// is used when no sort parameter is given and uses the same "-field" syntax.
+func Parse(values url.Values, defaultSort string) (*Query, error) {
+	q := &Query{Limit: DefaultLimit}
+
+	sortParam := defaultSort
+	if v := values.Get("sort"); v != "" {
+		sortParam = v
+	}
+	s, err := parseSort(sortParam)
+	if err != nil {
+		return nil, err
+	}
+	q.Sort = s
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return nil, &Error{Param: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxLimit)}
+		}
+		q.Limit = limit
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			return nil, &Error{Param: "cursor", Message: "malformed cursor"}
+		}
+		if cursor.Sort != q.Sort.String() {
+			return nil, &Error{Param: "cursor", Message: "cursor does not match the requested sort order"}
+		}
+		if !validCursorValue(sortFields[q.Sort.Field].cast, cursor.Value) {
+			return nil, &Error{Param: "cursor", Message: "malformed cursor"}
+		}
+		q.Cursor = cursor
+	}
+
+	if v := strings.TrimSpace(values.Get("q")); v != "" {
+		if len(v) > maxTextValue {
+			return nil, &Error{Param: "q", Message: fmt.Sprintf("must be at most %d characters", maxTextValue)}
+		}
+		q.Text = v
+	}
+
+	// Iterate in a stable order so generated SQL is deterministic.
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		switch key {
+		case "sort", "limit", "cursor", "q":
+			continue
+		}
+		for _, raw := range values[key] {
+			if id, ok := customFieldID(key); ok {
+				q.custom = append(q.custom, customFilter{key: key, raw: raw, fieldID: id})
+				continue
+			}
+			cond, err := parseCondition(key, raw, func(name string) (field, bool) {
+				f, ok := fields[name]
+				return f, ok
+			})
+			if err != nil {
+				return nil, err
+			}
+			q.conditions = append(q.conditions, cond)
+		}
+	}
+
+	return q, nil
+}
+
+// CustomFields returns the IDs of the custom fields the query filters on.
+func (q *Query) CustomFields() []int {
+	ids := []int{}
+	seen := map[int]bool{}
+	for _, f := range q.custom {
+		if !seen[f.fieldID] {
+			seen[f.fieldID] = true
+			ids = append(ids, f.fieldID)
+		}
+	}
+	return ids
+}
+
+// SetCustomFieldTypes validates the custom field filters against the types
+// of their fields, by field ID. It must be called before Apply when
+// CustomFields is not empty; fields missing from types are rejected.
+func (q *Query) SetCustomFieldTypes(types map[int]string) error {
+	for _, f := range q.custom {
+		def, ok := customFields[types[f.fieldID]]
+		if !ok {
+			return &Error{Param: f.key, Message: "unknown custom field"}
+		}
+		def.column = fmt.Sprintf(def.column, f.fieldID)
+
+		cond, err := parseCondition(f.key, f.raw, func(string) (field, bool) { return def, true })
+		if err != nil {
+			return err
+		}
+		q.conditions = append(q.conditions, cond)
+	}
+	q.custom = nil
+	return nil
+}
+
+// customFieldID returns the field ID of a custom field filter key.
+func customFieldID(key string) (int, bool) {
+	m := keyPattern.FindStringSubmatch(key)
+	if m == nil || !strings.HasPrefix(m[1], "cf.") {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(m[1], "cf."))
+	return id, err == nil
+}
+
+func parseSort(param string) (Sort, error) {
+	s := Sort{Field: strings.TrimPrefix(param, "-"), Desc: strings.HasPrefix(param, "-")}
+	if _, ok := sortFields[s.Field]; !ok {
+		return Sort{}, &Error{Param: "sort", Message: fmt.Sprintf("cannot sort by %q", s.Field)}
+	}
+	return s, nil
+}
+
+func parseCondition(key, raw string, lookup func(name string) (field, bool)) (condition, error) {
+	m := keyPattern.FindStringSubmatch(key)
+	if m == nil {
+		return condition{}, &Error{Param: key, Message: "unknown filter"}
+	}
+	name, op := m[1], Operator(m[2])
+
+	f, ok := lookup(name)
+	if !ok {
+		return condition{}, &Error{Param: key, Message: fmt.Sprintf("unknown filter field %q", name)}
+	}
+
+	if op == "" {
+		op = OpEq
+		if strings.Contains(raw, ",") && f.supports(OpIn) {
+			op = OpIn
+		}
+	}
+	if !f.supports(op) {
+		return condition{}, &Error{Param: key, Message: fmt.Sprintf("operator %q is not supported for %q", op, name)}
+	}
+
+	if op == OpNull {
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return condition{}, &Error{Param: key, Message: "expected true or false"}
+		}
+		return condition{field: name, def: f, op: op, values: []interface{}{isNull}}, nil
+	}
+
+	parts := []string{raw}
+	if op == OpIn || op == OpNin || op == OpAll {
+		parts = strings.Split(raw, ",")
+	}
+	if len(parts) > maxValues {
+		return condition{}, &Error{Param: key, Message: fmt.Sprintf("at most %d values are allowed", maxValues)}
+	}
+
+	values := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		v, err := parseValue(f.kind, strings.TrimSpace(part))
+		if err != nil {
+			return condition{}, &Error{Param: key, Message: err.Error()}
+		}
+		values = append(values, v)
+	}
+
+	cond := condition{field: name, def: f, op: op, values: values}
+	if f.kind == kindTime && op == OpEq {
+		_, err := time.Parse(dateLayout, strings.TrimSpace(raw))
+		cond.day = err == nil
+	}
+	return cond, nil
+}
+
+func (f field) supports(op Operator) bool {
+	for _, o := range f.ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func parseValue(kind valueKind, raw string) (interface{}, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("empty value")
+	}
+
+	switch kind {
+	case kindInt:
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid integer", raw)
+		}
+		return v, nil
+	case kindNumber:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid number", raw)
+		}
+		return v, nil
+	case kindBool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("expected true or false")
+		}
+		return v, nil
+	case kindTime:
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			return t.UTC(), nil
+		}
+		if t, err := time.Parse(dateLayout, raw); err == nil {
+			return t, nil
+		}
+		return nil, fmt.Errorf("%q is not a valid date (use YYYY-MM-DD or RFC 3339)", raw)
+	default:
+		if len(raw) > maxTextValue {
+			return nil, fmt.Errorf("value must be at most %d characters", maxTextValue)
+		}
+		return raw, nil
+	}
+}
+
+// Apply adds the filter and free-text conditions to b.
+func (q *Query) Apply(b *Builder) {
+	for _, cond := range q.conditions {
+		b.Where(cond.sql(b))
+	}
+
+	if q.Text != "" {
+		pattern := b.Arg("%" + utils.EscapeLike(q.Text) + "%")
+		b.Where("(t.title ILIKE " + pattern + " OR t.description ILIKE " + pattern + ")")
+	}
+}
+
+// ApplyCursor adds the keyset condition that skips everything up to and
+// including the cursor. Because it compares sort values rather than using an
+// offset, pages stay stable while tasks are inserted.
+func (q *Query) ApplyCursor(b *Builder) {
+	if q.Cursor == nil {
+		return
+	}
+
+	s := sortFields[q.Sort.Field]
+	cmp := ">"
+	if q.Sort.Desc {
+		cmp = "<"
+	}
+	b.Where(fmt.Sprintf("(%s, t.id) %s (%s::%s, %s)",
+		q.SortExpr(), cmp, b.Arg(q.Cursor.Value), s.cast, b.Arg(q.Cursor.ID)))
+}
+
+// SortExpr is the SQL expression tasks are ordered by. Selecting it cast to
+// text gives the value to pass to NextCursor.
+func (q *Query) SortExpr() string {
+	s := sortFields[q.Sort.Field]
+	if q.Sort.Desc {
+		return s.desc
+	}
+	return s.asc
+}
+
+// OrderBy returns the ORDER BY clause, without the keywords.
+func (q *Query) OrderBy() string {
+	dir := "ASC"
+	if q.Sort.Desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s %s, t.id %s", q.SortExpr(), dir, dir)
+}
+
+// NextCursor encodes a cursor pointing after the task with the given sort
+// value and ID.
+func (q *Query) NextCursor(sortValue string, id int) string {
+	data, _ := json.Marshal(Cursor{Sort: q.Sort.String(), Value: sortValue, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// dateLayout is the bare date accepted by time filters.
+const dateLayout = "2006-01-02"
+
+// cursorTimeLayout is how Postgres prints a timestamp cast to text.
+const cursorTimeLayout = "2006-01-02 15:04:05.999999999"
+
+// validCursorValue reports whether a cursor's sort value can be cast to the
+// sort field's type, so a tampered cursor is rejected instead of failing
+// the query.
+func validCursorValue(cast, value string) bool {
+	switch cast {
+	case "int":
+		_, err := strconv.Atoi(value)
+		return err == nil
+	case "timestamp":
+		if value == "infinity" || value == "-infinity" {
+			return true
+		}
+		_, err := time.Parse(cursorTimeLayout, value)
+		return err == nil
+	default:
+		return true
+	}
+}
+
+func (cond condition) sql(b *Builder) string {
+	if cond.field == "label" {
+		ids := b.Arg(intSlice(cond.values))
+		exists := "EXISTS (SELECT 1 FROM task_labels tl WHERE tl.task_id = t.id AND tl.label_id = ANY(" + ids + "))"
+		switch cond.op {
+		case OpNe, OpNin:
+			return "NOT " + exists
+		case OpAll:
+			return fmt.Sprintf("(SELECT COUNT(DISTINCT tl.label_id) FROM task_labels tl WHERE tl.task_id = t.id AND tl.label_id = ANY(%s)) = %d",
+				ids, len(distinctInts(cond.values)))
+		default:
+			return exists
+		}
+	}
+
+	f := cond.def
+	if f.multi && cond.op != OpNull {
+		// A JSON array of options contains any (?|) or all (?&) of the values
+		values := b.Arg(typedSlice(f.kind, cond.values))
+		switch cond.op {
+		case OpNe, OpNin:
+			return "NOT COALESCE(" + f.column + " ?| " + values + ", FALSE)"
+		case OpAll:
+			return "COALESCE(" + f.column + " ?& " + values + ", FALSE)"
+		default:
+			return "COALESCE(" + f.column + " ?| " + values + ", FALSE)"
+		}
+	}
+
+	switch cond.op {
+	case OpNull:
+		if cond.values[0].(bool) {
+			return f.column + " IS NULL"
+		}
+		return f.column + " IS NOT NULL"
+	case OpIn:
+		return f.column + " = ANY(" + b.Arg(typedSlice(f.kind, cond.values)) + ")"
+	case OpNin:
+		return "NOT COALESCE(" + f.column + " = ANY(" + b.Arg(typedSlice(f.kind, cond.values)) + "), FALSE)"
+	case OpNe:
+		return f.column + " IS DISTINCT FROM " + b.Arg(cond.values[0])
+	case OpGt:
+		return f.column + " > " + b.Arg(cond.values[0])
+	case OpGte:
+		return f.column + " >= " + b.Arg(cond.values[0])
+	case OpLt:
+		return f.column + " < " + b.Arg(cond.values[0])
+	case OpLte:
+		return f.column + " <= " + b.Arg(cond.values[0])
+	default:
+		if cond.day {
+			// A bare date matches the whole day.
+			day := cond.values[0].(time.Time)
+			return fmt.Sprintf("(%s >= %s AND %s < %s)", f.column, b.Arg(day), f.column, b.Arg(day.Add(24*time.Hour)))
+		}
+		return f.column + " = " + b.Arg(cond.values[0])
+	}
+}
+
+func typedSlice(kind valueKind, values []interface{}) interface{} {
+	if kind == kindInt {
+		return intSlice(values)
+	}
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = v.(string)
+	}
+	return out
+}
+
+func intSlice(values []interface{}) []int {
+	out := make([]int, len(values))
+	for i, v := range values {
+		out[i] = v.(int)
+	}
+	return out
+}
+
+func distinctInts(values []interface{}) map[int]struct{} {
+	seen := map[int]struct{}{}
+	for _, v := range values {
+		seen[v.(int)] = struct{}{}
+	}
+	return seen
+}
@@ -0,0 +1,170 @@
+package taskquery
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilters(t *testing.T) {
+	values, _ := url.ParseQuery("status=todo,in_progress&assignee_id[null]=false&label[all]=1,2,2&due_date[lt]=2025-01-31&q=50%25_off")
+
+	q, err := Parse(values, "position")
+	require.NoError(t, err)
+
+	b := NewBuilder()
+	b.Where("t.board_id = " + b.Arg(7))
+	q.Apply(b)
+
+	assert.Equal(t,
+		"t.board_id = $1 AND t.assignee_id IS NOT NULL AND "+
+			"t.due_date < $2 AND "+
+			"(SELECT COUNT(DISTINCT tl.label_id) FROM task_labels tl WHERE tl.task_id = t.id AND tl.label_id = ANY($3)) = 2 AND "+
+			"t.status = ANY($4) AND "+
+			"(t.title ILIKE $5 OR t.description ILIKE $5)",
+		b.SQL())
+	assert.Equal(t, []interface{}{
+		7,
+		time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+		[]int{1, 2, 2},
+		[]string{"todo", "in_progress"},
+		`%50\%\_off%`,
+	}, b.Args())
+}
+
+func TestStatusCategoryFilter(t *testing.T) {
+	values, _ := url.ParseQuery("status_category[ne]=done")
+
+	q, err := Parse(values, "position")
+	require.NoError(t, err)
+
+	b := NewBuilder()
+	q.Apply(b)
+
+	assert.Equal(t,
+		"(SELECT s.category FROM project_statuses s WHERE s.project_id = b.project_id AND s.key = t.status) IS DISTINCT FROM $1",
+		b.SQL())
+	assert.Equal(t, []interface{}{"done"}, b.Args())
+}
+
+func TestDueDateEquality(t *testing.T) {
+	// A bare date matches the whole day
+	q, err := Parse(url.Values{"due_date": {"2025-01-31"}}, "position")
+	require.NoError(t, err)
+	b := NewBuilder()
+	q.Apply(b)
+	assert.Equal(t, "(t.due_date >= $1 AND t.due_date < $2)", b.SQL())
+	assert.Equal(t, []interface{}{
+		time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+	}, b.Args())
+
+	// A timestamp matches exactly
+	q, err = Parse(url.Values{"due_date": {"2025-01-31T23:30:00+05:00"}}, "position")
+	require.NoError(t, err)
+	b = NewBuilder()
+	q.Apply(b)
+	assert.Equal(t, "t.due_date = $1", b.SQL())
+	assert.Equal(t, []interface{}{time.Date(2025, 1, 31, 18, 30, 0, 0, time.UTC)}, b.Args())
+}
+
+func TestParseRejectsInvalidParameters(t *testing.T) {
+	tests := map[string]url.Values{
+		"unknown field":         {"password": {"x"}},
+		"unsupported operator":  {"status[gt]": {"todo"}},
+		"bad integer":           {"assignee_id": {"me"}},
+		"bad date":              {"due_date[lt]": {"tomorrow"}},
+		"bad null flag":         {"assignee_id[null]": {"maybe"}},
+		"unknown sort":          {"sort": {"password"}},
+		"limit too large":       {"limit": {"100000"}},
+		"malformed cursor":      {"cursor": {"!!!"}},
+		"injection in key":      {"status;DROP TABLE tasks": {"1"}},
+		"injection in operator": {"status[eq OR 1=1]": {"todo"}},
+	}
+
+	for name, values := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(values, "position")
+			var qerr *Error
+			assert.ErrorAs(t, err, &qerr)
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	q, err := Parse(url.Values{"sort": {"-due_date"}, "limit": {"10"}}, "position")
+	require.NoError(t, err)
+	assert.Equal(t, "COALESCE(t.due_date, '-infinity'::timestamp) DESC, t.id DESC", q.OrderBy())
+
+	cursor := q.NextCursor("2025-01-31 00:00:00", 42)
+
+	next, err := Parse(url.Values{"sort": {"-due_date"}, "cursor": {cursor}}, "position")
+	require.NoError(t, err)
+	require.NotNil(t, next.Cursor)
+	assert.Equal(t, 42, next.Cursor.ID)
+
+	b := NewBuilder()
+	next.ApplyCursor(b)
+	assert.Equal(t, "(COALESCE(t.due_date, '-infinity'::timestamp), t.id) < ($1::timestamp, $2)", b.SQL())
+	assert.Equal(t, []interface{}{"2025-01-31 00:00:00", 42}, b.Args())
+
+	// Postgres prints infinite and fractional timestamps too
+	_, err = Parse(url.Values{"sort": {"-due_date"}, "cursor": {q.NextCursor("-infinity", 42)}}, "position")
+	assert.NoError(t, err)
+	_, err = Parse(url.Values{"sort": {"-due_date"}, "cursor": {q.NextCursor("2025-01-31 10:20:30.123456", 42)}}, "position")
+	assert.NoError(t, err)
+
+	// A tampered sort value is rejected before it reaches the database
+	var qerr *Error
+	_, err = Parse(url.Values{"sort": {"-due_date"}, "cursor": {q.NextCursor("x", 42)}}, "position")
+	assert.ErrorAs(t, err, &qerr)
+
+	// A cursor is only valid for the sort order it was issued for.
+	_, err = Parse(url.Values{"sort": {"title"}, "cursor": {cursor}}, "position")
+	assert.Error(t, err)
+}
+
+func TestSortByPriorityRank(t *testing.T) {
+	q, err := Parse(url.Values{"sort": {"-priority"}}, "position")
+	require.NoError(t, err)
+	assert.Equal(t,
+		"COALESCE((SELECT p.rank FROM project_priorities p WHERE p.project_id = b.project_id AND p.key = t.priority), -1) DESC, t.id DESC",
+		q.OrderBy())
+}
+
+func TestCustomFieldFilters(t *testing.T) {
+	values, _ := url.ParseQuery("cf.3[gte]=2.5&cf.4=dev,prod&cf.4[all]=qa&cf.5[null]=true&status=todo")
+
+	q, err := Parse(values, "position")
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 4, 5}, q.CustomFields())
+
+	_, err = Parse(url.Values{"cf.x": {"1"}}, "position")
+	assert.Error(t, err)
+
+	// Types decide the operators and values accepted
+	err = q.SetCustomFieldTypes(map[int]string{3: "number", 4: "multi_select"})
+	var qerr *Error
+	require.ErrorAs(t, err, &qerr)
+	assert.Equal(t, "cf.5[null]", qerr.Param)
+
+	q, _ = Parse(values, "position")
+	require.NoError(t, q.SetCustomFieldTypes(map[int]string{3: "number", 4: "multi_select", 5: "text"}))
+
+	b := NewBuilder()
+	q.Apply(b)
+	assert.Equal(t,
+		"t.status = $1 AND "+
+			"(SELECT v.value #>> '{}' FROM task_custom_field_values v WHERE v.task_id = t.id AND v.field_id = 3)::numeric >= $2 AND "+
+			"COALESCE((SELECT v.value FROM task_custom_field_values v WHERE v.task_id = t.id AND v.field_id = 4) ?| $3, FALSE) AND "+
+			"COALESCE((SELECT v.value FROM task_custom_field_values v WHERE v.task_id = t.id AND v.field_id = 4) ?& $4, FALSE) AND "+
+			"(SELECT v.value #>> '{}' FROM task_custom_field_values v WHERE v.task_id = t.id AND v.field_id = 5) IS NULL",
+		b.SQL())
+	assert.Equal(t, []interface{}{"todo", 2.5, []string{"dev", "prod"}, []string{"qa"}}, b.Args())
+
+	q, _ = Parse(url.Values{"cf.6[gt]": {"1"}}, "position")
+	assert.Error(t, q.SetCustomFieldTypes(map[int]string{6: "checkbox"}))
+}
@@ -0,0 +1,128 @@
+// Package timesheet builds timesheet reports from logged time and exports
+// them as CSV.
+package timesheet
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+// DateLayout is the format of the dates of a timesheet.
+const DateLayout = "2006-01-02"
+
+// MaxDays is the longest date range a timesheet covers.
+const MaxDays = 366
+
+// ParseRange parses the first and last day of a timesheet. It returns the
+// start of from and the start of the day after to, so entries can be
+// selected with started_at >= start AND started_at < end.
+func ParseRange(from, to string) (time.Time, time.Time, error) {
+	if from == "" || to == "" {
+		return time.Time{}, time.Time{}, errors.New("from and to are required, as YYYY-MM-DD")
+	}
+	start, err := time.Parse(DateLayout, from)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("from must be a date as YYYY-MM-DD")
+	}
+	last, err := time.Parse(DateLayout, to)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("to must be a date as YYYY-MM-DD")
+	}
+	if last.Before(start) {
+		return time.Time{}, time.Time{}, errors.New("to must not be before from")
+	}
+	end := last.AddDate(0, 0, 1)
+	if end.Sub(start) > MaxDays*24*time.Hour {
+		return time.Time{}, time.Time{}, errors.New("a timesheet covers at most " + strconv.Itoa(MaxDays) + " days")
+	}
+	return start, end, nil
+}
+
+// Build adds up the rows, already aggregated per day, user and task, into a
+// timesheet with totals per user and project.
+func Build(from, to string, rows []models.TimesheetRow) models.Timesheet {
+	sheet := models.Timesheet{From: from, To: to, Rows: rows, Totals: []models.TimesheetTotal{}}
+	if sheet.Rows == nil {
+		sheet.Rows = []models.TimesheetRow{}
+	}
+
+	type key struct{ user, project int }
+	index := map[key]int{}
+	for i := range sheet.Rows {
+		row := &sheet.Rows[i]
+		row.Hours = Hours(row.Seconds)
+		sheet.TotalSeconds += row.Seconds
+
+		k := key{row.UserID, row.ProjectID}
+		j, ok := index[k]
+		if !ok {
+			j = len(sheet.Totals)
+			index[k] = j
+			sheet.Totals = append(sheet.Totals, models.TimesheetTotal{
+				UserID:      row.UserID,
+				Username:    row.Username,
+				ProjectID:   row.ProjectID,
+				ProjectName: row.ProjectName,
+			})
+		}
+		sheet.Totals[j].Seconds += row.Seconds
+	}
+
+	for i := range sheet.Totals {
+		sheet.Totals[i].Hours = Hours(sheet.Totals[i].Seconds)
+	}
+	sort.SliceStable(sheet.Totals, func(i, j int) bool {
+		a, b := sheet.Totals[i], sheet.Totals[j]
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		return a.ProjectName < b.ProjectName
+	})
+	sheet.TotalHours = Hours(sheet.TotalSeconds)
+
+	return sheet
+}
+
+// Hours converts seconds to hours, rounded to two decimals.
+func Hours(seconds int64) float64 {
+	return math.Round(float64(seconds)/36) / 100
+}
+
+// WriteCSV writes the rows of a timesheet as CSV with a header line.
+func WriteCSV(w io.Writer, sheet models.Timesheet) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"date", "user", "project", "task_id", "task", "hours"}); err != nil {
+		return err
+	}
+	for _, row := range sheet.Rows {
+		err := cw.Write([]string{
+			row.Date,
+			cell(row.Username),
+			cell(row.ProjectName),
+			strconv.Itoa(row.TaskID),
+			cell(row.TaskTitle),
+			strconv.FormatFloat(row.Hours, 'f', 2, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// cell escapes text that spreadsheets would otherwise run as a formula.
+func cell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
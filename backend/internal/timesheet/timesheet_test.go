@@ -0,0 +1,59 @@
+package timesheet
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	start, end, err := ParseRange("2025-01-01", "2025-01-31")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), end)
+
+	_, _, err = ParseRange("2024-01-01", "2024-12-31")
+	assert.NoError(t, err)
+
+	for _, r := range [][2]string{{"", "2025-01-31"}, {"2025-01-31", "2025-01-01"}, {"2025-01-01", "31/01/2025"}, {"2024-01-01", "2025-01-01"}} {
+		_, _, err := ParseRange(r[0], r[1])
+		assert.Error(t, err, r)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	sheet := Build("2025-01-01", "2025-01-31", []models.TimesheetRow{
+		{Date: "2025-01-02", UserID: 2, Username: "zoe", ProjectID: 1, ProjectName: "Acme", TaskID: 10, Seconds: 5400},
+		{Date: "2025-01-02", UserID: 1, Username: "ann", ProjectID: 1, ProjectName: "Acme", TaskID: 10, Seconds: 600},
+		{Date: "2025-01-03", UserID: 2, Username: "zoe", ProjectID: 1, ProjectName: "Acme", TaskID: 11, Seconds: 1800},
+	})
+
+	assert.Equal(t, 1.5, sheet.Rows[0].Hours)
+	assert.Equal(t, 0.17, sheet.Rows[1].Hours)
+	assert.Equal(t, int64(7800), sheet.TotalSeconds)
+	assert.Equal(t, []models.TimesheetTotal{
+		{UserID: 1, Username: "ann", ProjectID: 1, ProjectName: "Acme", Seconds: 600, Hours: 0.17},
+		{UserID: 2, Username: "zoe", ProjectID: 1, ProjectName: "Acme", Seconds: 7200, Hours: 2},
+	}, sheet.Totals)
+
+	empty := Build("2025-01-01", "2025-01-01", nil)
+	assert.NotNil(t, empty.Rows)
+	assert.NotNil(t, empty.Totals)
+}
+
+func TestWriteCSV(t *testing.T) {
+	sheet := Build("2025-01-01", "2025-01-31", []models.TimesheetRow{
+		{Date: "2025-01-02", Username: "ann", ProjectName: "Acme, Inc", TaskID: 10, TaskTitle: "=HYPERLINK(\"x\")", Seconds: 5400},
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, sheet))
+	assert.Equal(t,
+		"date,user,project,task_id,task,hours\n"+
+			"2025-01-02,ann,\"Acme, Inc\",10,\"'=HYPERLINK(\"\"x\"\")\",1.50\n",
+		buf.String())
+}
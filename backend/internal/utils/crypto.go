@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+)
+
+// Encrypt seals plaintext with AES-GCM under a key derived from secret for
+// purpose, and returns the nonce and ciphertext encoded as base64.
+func Encrypt(plaintext, secret, purpose string) (string, error) {
+	gcm, err := newGCM(secret, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value returned by Encrypt with the same secret and
+// purpose.
+func Decrypt(ciphertext, secret, purpose string) (string, error) {
+	gcm, err := newGCM(secret, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(secret, purpose string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(secret, purpose))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -1,64 +1,248 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/mochammadshenna/4me-backend/internal/jwks"
+)
+
+// Token types carried in the typ claim. Only access tokens are accepted as
+// bearer tokens; refresh tokens are only accepted by the refresh endpoint and
+// MFA pending tokens only by the two-factor verification endpoint.
+const (
+	TokenTypeAccess     = "access"
+	TokenTypeRefresh    = "refresh"
+	TokenTypeMFAPending = "mfa_pending"
+)
+
+const (
+	AccessTokenTTL     = 24 * time.Hour
+	RefreshTokenTTL    = 7 * 24 * time.Hour
+	MFAPendingTokenTTL = 5 * time.Minute
 )
 
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Type      string `json:"typ"`
+	SessionID int    `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID int, username, email, secret string) (string, error) {
+// GenerateToken signs an access token with the signing key of keys. Other
+// tokens are only read by this server and are signed with keys derived from
+// the JWT secret.
+func GenerateToken(userID, sessionID int, username, email string, keys *jwks.KeySet) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
-		Email:    email,
+		UserID:    userID,
+		Username:  username,
+		Email:     email,
+		Type:      TokenTypeAccess,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return keys.Sign(claims)
+}
+
+// GenerateRefreshToken signs a single-use refresh token with a random ID and
+// a key derived from the JWT secret.
+func GenerateRefreshToken(userID, sessionID int, username, email, secret string) (string, error) {
+	id, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := Claims{
+		UserID:    userID,
+		Username:  username,
+		Email:     email,
+		Type:      TokenTypeRefresh,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return token.SignedString(deriveKey(secret, TokenTypeRefresh))
 }
 
-func GenerateRefreshToken(userID int, username, email, secret string) (string, error) {
+// GenerateMFAPendingToken signs the token returned by the first login step
+// of a user with two-factor authentication. It has no session and only
+// proves that the password was correct.
+func GenerateMFAPendingToken(userID int, username, email, secret string) (string, error) {
 	claims := Claims{
 		UserID:   userID,
 		Username: username,
 		Email:    email,
+		Type:     TokenTypeMFAPending,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFAPendingTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(deriveKey(secret, TokenTypeMFAPending))
+}
+
+// ValidateToken validates an access token.
+func ValidateToken(tokenString string, keys *jwks.KeySet) (*Claims, error) {
+	return parseClaims(tokenString, keys.Keyfunc, TokenTypeAccess)
+}
+
+// ValidateRefreshToken validates a refresh token's signature, expiry and
+// type. Callers must still check it against the stored token.
+func ValidateRefreshToken(tokenString, secret string) (*Claims, error) {
+	return validateClaims(tokenString, deriveKey(secret, TokenTypeRefresh), TokenTypeRefresh)
+}
+
+func ValidateMFAPendingToken(tokenString, secret string) (*Claims, error) {
+	return validateClaims(tokenString, deriveKey(secret, TokenTypeMFAPending), TokenTypeMFAPending)
+}
+
+func validateClaims(tokenString string, key []byte, tokenType string) (*Claims, error) {
+	return parseClaims(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return key, nil
+	}, tokenType)
+}
+
+func parseClaims(tokenString string, keyFunc jwt.Keyfunc, tokenType string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keyFunc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.Type == tokenType {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
+
+// HashToken returns the hex SHA-256 digest under which a token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns n random bytes encoded as hex.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type InvitationClaims struct {
+	InvitationID int    `json:"invitation_id"`
+	Email        string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// GenerateInvitationToken signs a project invitation. It uses a key derived
+// from the JWT secret so an invitation can never pass as an access token.
+func GenerateInvitationToken(invitationID int, email, secret string, expiresAt time.Time) (string, error) {
+	claims := InvitationClaims{
+		InvitationID: invitationID,
+		Email:        email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(deriveKey(secret, "invitation"))
+}
+
+func ValidateInvitationToken(tokenString, secret string) (*InvitationClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &InvitationClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return deriveKey(secret, "invitation"), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*InvitationClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
+
+type OAuthStateClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	// LinkUserID is set when the login links an identity to this user
+	// instead of signing in.
+	LinkUserID int `json:"link_user_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateOAuthStateToken signs the state and PKCE verifier of an OAuth login
+// so they can be kept in a cookie until the provider redirects back.
+func GenerateOAuthStateToken(provider, state, verifier string, linkUserID int, secret string, expiresAt time.Time) (string, error) {
+	claims := OAuthStateClaims{
+		Provider:   provider,
+		State:      state,
+		Verifier:   verifier,
+		LinkUserID: linkUserID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return token.SignedString(deriveKey(secret, "oauth-state"))
 }
 
-func ValidateToken(tokenString, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+func ValidateOAuthStateToken(tokenString, secret string) (*OAuthStateClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &OAuthStateClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("invalid signing method")
 		}
-		return []byte(secret), nil
+		return deriveKey(secret, "oauth-state"), nil
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	if claims, ok := token.Claims.(*OAuthStateClaims); ok && token.Valid {
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid token")
 }
+
+// deriveKey returns a purpose-specific signing key for secret.
+func deriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,9 @@
+package utils
+
+import "strings"
+
+// EscapeLike escapes the wildcards of a LIKE pattern, so s matches only
+// itself. Postgres uses backslash as the default escape character.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
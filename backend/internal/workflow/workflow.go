@@ -0,0 +1,194 @@
+// Package workflow checks task status changes against the statuses a
+// project defines and the transitions allowed between them.
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mochammadshenna/4me-backend/internal/models"
+)
+
+var keyPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ValidKey reports whether a status or priority key is usable: lowercase
+// letters, digits and underscores, so keys can be listed in task filters.
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// Workflow is a project's statuses in order and the transitions between
+// them.
+type Workflow struct {
+	Statuses []models.ProjectStatus
+	// next lists the keys each status can change to; nil allows any change
+	next map[string][]string
+}
+
+// New returns the workflow of the given statuses and transitions.
+func New(statuses []models.ProjectStatus, transitions []models.StatusTransition) *Workflow {
+	w := &Workflow{Statuses: statuses}
+	if len(transitions) > 0 {
+		w.next = map[string][]string{}
+		for _, t := range transitions {
+			w.next[t.From] = append(w.next[t.From], t.To)
+		}
+	}
+	return w
+}
+
+// Querier runs queries, in a transaction or not.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Load reads the workflow of a project.
+func Load(ctx context.Context, q Querier, projectID int) (*Workflow, error) {
+	rows, err := q.Query(ctx,
+		`SELECT id, project_id, key, name, category, position, created_at, updated_at 
+		 FROM project_statuses WHERE project_id = $1 ORDER BY position, id`,
+		projectID)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ProjectStatus, error) {
+		var s models.ProjectStatus
+		err := row.Scan(&s.ID, &s.ProjectID, &s.Key, &s.Name, &s.Category, &s.Position, &s.CreatedAt, &s.UpdatedAt)
+		return s, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(ctx,
+		`SELECT f.key, t.key 
+		 FROM status_transitions st 
+		 JOIN project_statuses f ON st.from_status_id = f.id 
+		 JOIN project_statuses t ON st.to_status_id = t.id 
+		 WHERE f.project_id = $1 
+		 ORDER BY f.position, f.id, t.position, t.id`,
+		projectID)
+	if err != nil {
+		return nil, err
+	}
+	transitions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.StatusTransition, error) {
+		var t models.StatusTransition
+		err := row.Scan(&t.From, &t.To)
+		return t, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return New(statuses, transitions), nil
+}
+
+// Transitions returns the allowed transitions, empty when any change is
+// allowed.
+func (w *Workflow) Transitions() []models.StatusTransition {
+	transitions := []models.StatusTransition{}
+	for _, from := range w.Statuses {
+		for _, to := range w.next[from.Key] {
+			transitions = append(transitions, models.StatusTransition{From: from.Key, To: to})
+		}
+	}
+	return transitions
+}
+
+// Status returns the status with the given key.
+func (w *Workflow) Status(key string) (models.ProjectStatus, bool) {
+	for _, s := range w.Statuses {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return models.ProjectStatus{}, false
+}
+
+// StatusByID returns the status with the given ID.
+func (w *Workflow) StatusByID(id int) (models.ProjectStatus, bool) {
+	for _, s := range w.Statuses {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return models.ProjectStatus{}, false
+}
+
+// Initial returns the status new tasks start in: the first status of the
+// todo category, or the first status when there is none.
+func (w *Workflow) Initial() models.ProjectStatus {
+	for _, s := range w.Statuses {
+		if s.Category == models.StatusCategoryTodo {
+			return s
+		}
+	}
+	if len(w.Statuses) > 0 {
+		return w.Statuses[0]
+	}
+	return models.ProjectStatus{Key: "todo", Name: "To Do", Category: models.StatusCategoryTodo}
+}
+
+// UnknownStatusError is returned for a status the project doesn't define.
+type UnknownStatusError struct {
+	Status string
+	Known  []string
+}
+
+func (e *UnknownStatusError) Error() string {
+	return fmt.Sprintf("unknown status %q; the project's statuses are %s", e.Status, strings.Join(e.Known, ", "))
+}
+
+// TransitionError is returned for a status change the workflow doesn't
+// allow. Allowed lists the statuses the task can change to instead.
+type TransitionError struct {
+	From    models.ProjectStatus
+	To      models.ProjectStatus
+	Allowed []models.ProjectStatus
+}
+
+func (e *TransitionError) Error() string {
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("tasks cannot change status from %q", e.From.Name)
+	}
+	names := make([]string, len(e.Allowed))
+	for i, s := range e.Allowed {
+		names[i] = fmt.Sprintf("%q", s.Name)
+	}
+	return fmt.Sprintf("tasks cannot change status from %q to %q; allowed next statuses: %s",
+		e.From.Name, e.To.Name, strings.Join(names, ", "))
+}
+
+// Check returns the status a task changes to, or an error when to is not a
+// status of the project or the change from the current status is not
+// allowed. Tasks in a status the project no longer defines can change to
+// any status.
+func (w *Workflow) Check(from, to string) (models.ProjectStatus, error) {
+	target, ok := w.Status(to)
+	if !ok {
+		known := make([]string, len(w.Statuses))
+		for i, s := range w.Statuses {
+			known[i] = s.Key
+		}
+		return models.ProjectStatus{}, &UnknownStatusError{Status: to, Known: known}
+	}
+
+	current, ok := w.Status(from)
+	if from == to || w.next == nil || !ok {
+		return target, nil
+	}
+
+	var allowed []models.ProjectStatus
+	for _, key := range w.next[from] {
+		if key == to {
+			return target, nil
+		}
+		if s, ok := w.Status(key); ok {
+			allowed = append(allowed, s)
+		}
+	}
+	return models.ProjectStatus{}, &TransitionError{From: current, To: target, Allowed: allowed}
+}
@@ -0,0 +1,79 @@
+package workflow
+
+import (
+	"testing"
+
+	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWorkflow(transitions ...models.StatusTransition) *Workflow {
+	return New([]models.ProjectStatus{
+		{ID: 1, Key: "backlog", Name: "Backlog", Category: models.StatusCategoryTodo},
+		{ID: 2, Key: "doing", Name: "Doing", Category: models.StatusCategoryInProgress},
+		{ID: 3, Key: "review", Name: "Review", Category: models.StatusCategoryInProgress},
+		{ID: 4, Key: "done", Name: "Done", Category: models.StatusCategoryDone},
+	}, transitions)
+}
+
+func TestCheckWithoutTransitions(t *testing.T) {
+	w := newWorkflow()
+
+	status, err := w.Check("backlog", "done")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCategoryDone, status.Category)
+
+	_, err = w.Check("backlog", "finished")
+	var unknown *UnknownStatusError
+	require.ErrorAs(t, err, &unknown)
+	assert.Equal(t, `unknown status "finished"; the project's statuses are backlog, doing, review, done`, err.Error())
+}
+
+func TestCheckTransitions(t *testing.T) {
+	w := newWorkflow(
+		models.StatusTransition{From: "backlog", To: "doing"},
+		models.StatusTransition{From: "doing", To: "review"},
+		models.StatusTransition{From: "review", To: "doing"},
+		models.StatusTransition{From: "review", To: "done"},
+	)
+
+	_, err := w.Check("doing", "review")
+	assert.NoError(t, err)
+	_, err = w.Check("review", "review")
+	assert.NoError(t, err)
+
+	// Tasks in a status that was removed can go anywhere
+	_, err = w.Check("legacy", "done")
+	assert.NoError(t, err)
+
+	_, err = w.Check("backlog", "done")
+	var transition *TransitionError
+	require.ErrorAs(t, err, &transition)
+	assert.Equal(t, "Backlog", transition.From.Name)
+	assert.Equal(t, `tasks cannot change status from "Backlog" to "Done"; allowed next statuses: "Doing"`, err.Error())
+
+	_, err = w.Check("done", "doing")
+	assert.EqualError(t, err, `tasks cannot change status from "Done"`)
+
+	assert.Equal(t, []models.StatusTransition{
+		{From: "backlog", To: "doing"},
+		{From: "doing", To: "review"},
+		{From: "review", To: "doing"},
+		{From: "review", To: "done"},
+	}, w.Transitions())
+}
+
+func TestInitial(t *testing.T) {
+	assert.Equal(t, "backlog", newWorkflow().Initial().Key)
+	assert.Equal(t, "todo", New(nil, nil).Initial().Key)
+
+	w := New([]models.ProjectStatus{{Key: "doing", Category: models.StatusCategoryInProgress}}, nil)
+	assert.Equal(t, "doing", w.Initial().Key)
+}
+
+func TestValidKey(t *testing.T) {
+	assert.True(t, ValidKey("in_review2"))
+	assert.False(t, ValidKey("In Review"))
+	assert.False(t, ValidKey("a,b"))
+}
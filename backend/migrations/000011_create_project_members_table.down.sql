@@ -0,0 +1,6 @@
+-- Drop project_members table and related objects
+DROP TRIGGER IF EXISTS update_project_members_updated_at ON project_members;
+DROP TRIGGER IF EXISTS add_project_owner_member_after_insert ON projects;
+DROP FUNCTION IF EXISTS add_project_owner_member();
+DROP INDEX IF EXISTS idx_project_members_user_id;
+DROP TABLE IF EXISTS project_members;
@@ -0,0 +1,40 @@
+-- Create project_members table
+CREATE TABLE project_members (
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'viewer'
+        CHECK (role IN ('owner', 'admin', 'editor', 'commenter', 'viewer')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, user_id)
+);
+
+-- Create indexes for project_members table
+CREATE INDEX idx_project_members_user_id ON project_members(user_id);
+
+-- Existing project owners become owner members
+INSERT INTO project_members (project_id, user_id, role, created_at)
+SELECT id, user_id, 'owner', created_at FROM projects
+ON CONFLICT DO NOTHING;
+
+-- The creator of a project is always its first owner
+CREATE OR REPLACE FUNCTION add_project_owner_member()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO project_members (project_id, user_id, role)
+    VALUES (NEW.id, NEW.user_id, 'owner')
+    ON CONFLICT DO NOTHING;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER add_project_owner_member_after_insert
+    AFTER INSERT ON projects
+    FOR EACH ROW
+    EXECUTE FUNCTION add_project_owner_member();
+
+-- Add trigger for updated_at
+CREATE TRIGGER update_project_members_updated_at 
+    BEFORE UPDATE ON project_members 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,5 @@
+-- Drop project_invitations table and related objects
+DROP INDEX IF EXISTS idx_project_invitations_pending;
+DROP INDEX IF EXISTS idx_project_invitations_email;
+DROP INDEX IF EXISTS idx_project_invitations_project_id;
+DROP TABLE IF EXISTS project_invitations;
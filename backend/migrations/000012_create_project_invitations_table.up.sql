@@ -0,0 +1,22 @@
+-- Create project_invitations table
+CREATE TABLE project_invitations (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'viewer'
+        CHECK (role IN ('owner', 'admin', 'editor', 'commenter', 'viewer')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'accepted', 'declined', 'revoked')),
+    invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    accepted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    responded_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for project_invitations table
+CREATE INDEX idx_project_invitations_project_id ON project_invitations(project_id);
+CREATE INDEX idx_project_invitations_email ON project_invitations(LOWER(email)) WHERE status = 'pending';
+
+-- Only one pending invitation per email and project
+CREATE UNIQUE INDEX idx_project_invitations_pending ON project_invitations(project_id, LOWER(email)) WHERE status = 'pending';
@@ -0,0 +1,13 @@
+-- Restore refresh token families
+DELETE FROM refresh_tokens;
+DROP INDEX IF EXISTS idx_refresh_tokens_session_id;
+ALTER TABLE refresh_tokens
+    DROP COLUMN session_id,
+    ADD COLUMN family_id VARCHAR(64) NOT NULL,
+    ADD COLUMN revoked_at TIMESTAMP;
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+-- Drop sessions table and related objects
+DROP INDEX IF EXISTS idx_sessions_revoked_at;
+DROP INDEX IF EXISTS idx_sessions_user_id;
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,26 @@
+-- Create sessions table
+-- Each login starts a session; access and refresh tokens carry its ID.
+CREATE TABLE sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for sessions table
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_revoked_at ON sessions(revoked_at) WHERE revoked_at IS NOT NULL;
+
+-- Refresh tokens now belong to a session, which replaces the token family.
+-- Existing refresh tokens have no session and are discarded.
+DELETE FROM refresh_tokens;
+DROP INDEX IF EXISTS idx_refresh_tokens_family_id;
+ALTER TABLE refresh_tokens
+    DROP COLUMN family_id,
+    DROP COLUMN revoked_at,
+    ADD COLUMN session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE;
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens(session_id);
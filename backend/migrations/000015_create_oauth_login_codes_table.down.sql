@@ -0,0 +1,3 @@
+-- Drop oauth_login_codes table and related objects
+DROP INDEX IF EXISTS idx_oauth_login_codes_user_id;
+DROP TABLE IF EXISTS oauth_login_codes;
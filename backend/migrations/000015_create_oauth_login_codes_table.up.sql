@@ -0,0 +1,14 @@
+-- Create oauth_login_codes table
+-- One-time codes handed to the frontend after an OAuth callback and
+-- exchanged for tokens, so tokens never appear in redirect URLs.
+CREATE TABLE oauth_login_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for oauth_login_codes table
+CREATE INDEX idx_oauth_login_codes_user_id ON oauth_login_codes(user_id);
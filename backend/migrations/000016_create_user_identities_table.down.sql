@@ -0,0 +1,12 @@
+-- Restore users.google_id
+ALTER TABLE users ADD COLUMN google_id VARCHAR(255) UNIQUE;
+CREATE INDEX idx_users_google_id ON users(google_id) WHERE google_id IS NOT NULL;
+
+UPDATE users u SET google_id = i.subject
+FROM user_identities i
+WHERE i.user_id = u.id AND i.provider = 'google';
+
+-- Drop user_identities table and related objects
+DROP TRIGGER IF EXISTS update_user_identities_updated_at ON user_identities;
+DROP INDEX IF EXISTS idx_user_identities_user_id;
+DROP TABLE IF EXISTS user_identities;
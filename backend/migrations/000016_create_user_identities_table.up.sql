@@ -0,0 +1,30 @@
+-- Create user_identities table
+-- Links users to accounts at external sign-in providers; a user can have
+-- one identity per provider.
+CREATE TABLE user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(provider, subject),
+    UNIQUE(user_id, provider)
+);
+
+-- Create indexes for user_identities table
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+-- Add trigger for updated_at
+CREATE TRIGGER update_user_identities_updated_at
+    BEFORE UPDATE ON user_identities
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Move Google accounts into user_identities
+INSERT INTO user_identities (user_id, provider, subject, email)
+SELECT id, 'google', google_id, email FROM users WHERE google_id IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_google_id;
+ALTER TABLE users DROP COLUMN google_id;
@@ -0,0 +1,7 @@
+-- Record whether the provider verified the identity's email address.
+-- Only verified addresses are used to match existing accounts.
+ALTER TABLE user_identities ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Google only ever signed users in with verified addresses, so the
+-- identities moved over from users.google_id count as verified.
+UPDATE user_identities SET email_verified = TRUE WHERE provider = 'google';
@@ -0,0 +1,29 @@
+-- Add email verification to users
+-- Users whose address was verified by a linked sign-in provider count as
+-- verified.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+UPDATE users u SET email_verified_at = NOW()
+WHERE EXISTS (
+    SELECT 1 FROM user_identities i
+    WHERE i.user_id = u.id AND i.email_verified AND LOWER(i.email) = LOWER(u.email)
+);
+
+-- Create user_tokens table
+-- Single-use tokens emailed for password resets and email verification.
+-- Only the SHA-256 hash of each token is stored. Verification tokens carry
+-- the address being verified, which differs from users.email while an
+-- email change is pending.
+CREATE TABLE user_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL CHECK (purpose IN ('password_reset', 'email_verification')),
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    email VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for user_tokens table
+CREATE INDEX idx_user_tokens_user_id ON user_tokens(user_id);
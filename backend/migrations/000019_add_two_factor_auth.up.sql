@@ -0,0 +1,19 @@
+-- Add TOTP two-factor authentication to users
+-- totp_secret is encrypted and set when enrollment starts; two-factor
+-- authentication is on once totp_enabled_at is set. totp_last_step is the
+-- time step of the last accepted code, so a code cannot be used twice.
+ALTER TABLE users ADD COLUMN totp_secret TEXT;
+ALTER TABLE users ADD COLUMN totp_enabled_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT;
+
+-- Create recovery_codes table
+-- Single-use codes that replace a TOTP code when the authenticator is lost.
+-- Only the SHA-256 hash of each code is stored.
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, code_hash)
+);
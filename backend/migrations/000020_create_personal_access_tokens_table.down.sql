@@ -0,0 +1,3 @@
+-- Drop personal_access_tokens table and related objects
+DROP INDEX IF EXISTS idx_personal_access_tokens_user_id;
+DROP TABLE IF EXISTS personal_access_tokens;
@@ -0,0 +1,20 @@
+-- Create personal_access_tokens table
+-- Long-lived tokens for scripts and integrations. Only the SHA-256 hash of
+-- each token is stored, with a short prefix to tell tokens apart. A token
+-- with a project_id only works for that project.
+CREATE TABLE personal_access_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    token_prefix VARCHAR(32) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for personal_access_tokens table
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
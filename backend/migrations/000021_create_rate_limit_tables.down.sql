@@ -0,0 +1,5 @@
+-- Drop rate limit tables and related objects
+DROP INDEX IF EXISTS idx_rate_limit_lockouts_expires_at;
+DROP INDEX IF EXISTS idx_rate_limit_buckets_full_at;
+DROP TABLE IF EXISTS rate_limit_lockouts;
+DROP TABLE IF EXISTS rate_limit_buckets;
@@ -0,0 +1,24 @@
+-- Create rate_limit_buckets table
+-- Token buckets shared by all server instances when RATE_LIMIT_STORE is
+-- postgres. A bucket past full_at has refilled and can be deleted.
+CREATE TABLE rate_limit_buckets (
+    key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    full_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create rate_limit_lockouts table
+-- Failed attempts per key and the lockout they triggered. A row past
+-- expires_at no longer affects anything and can be deleted.
+CREATE TABLE rate_limit_lockouts (
+    key VARCHAR(255) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    window_started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Create indexes for rate limit tables
+CREATE INDEX idx_rate_limit_buckets_full_at ON rate_limit_buckets(full_at);
+CREATE INDEX idx_rate_limit_lockouts_expires_at ON rate_limit_lockouts(expires_at);
@@ -0,0 +1,3 @@
+-- Drop uploader from attachments
+DROP INDEX IF EXISTS idx_attachments_uploaded_by;
+ALTER TABLE attachments DROP COLUMN IF EXISTS uploaded_by;
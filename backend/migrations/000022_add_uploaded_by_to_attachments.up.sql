@@ -0,0 +1,12 @@
+-- Add uploader to attachments
+-- Attachment storage counts against the quota of the user who uploaded it.
+-- Existing attachments are attributed to the owner of their project.
+ALTER TABLE attachments ADD COLUMN uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+UPDATE attachments a SET uploaded_by = p.user_id
+FROM tasks t
+JOIN boards b ON t.board_id = b.id
+JOIN projects p ON b.project_id = p.id
+WHERE a.task_id = t.id;
+
+CREATE INDEX idx_attachments_uploaded_by ON attachments(uploaded_by);
@@ -0,0 +1,8 @@
+-- Drop checklist_items table and subtasks
+DROP TRIGGER IF EXISTS update_checklist_items_updated_at ON checklist_items;
+DROP INDEX IF EXISTS idx_checklist_items_task_id;
+DROP TABLE IF EXISTS checklist_items;
+
+DROP INDEX IF EXISTS idx_tasks_parent_task_id;
+ALTER TABLE tasks DROP COLUMN IF EXISTS subtask_position;
+ALTER TABLE tasks DROP COLUMN IF EXISTS parent_task_id;
@@ -0,0 +1,27 @@
+-- Add subtasks to tasks
+-- A subtask is a task with a parent in the same project. Subtasks are
+-- deleted with their parent; subtask_position orders them under it.
+ALTER TABLE tasks ADD COLUMN parent_task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE;
+ALTER TABLE tasks ADD COLUMN subtask_position INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_tasks_parent_task_id ON tasks(parent_task_id);
+
+-- Create checklist_items table
+CREATE TABLE checklist_items (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    text VARCHAR(500) NOT NULL,
+    done BOOLEAN NOT NULL DEFAULT FALSE,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for checklist_items table
+CREATE INDEX idx_checklist_items_task_id ON checklist_items(task_id, position);
+
+-- Add trigger for updated_at
+CREATE TRIGGER update_checklist_items_updated_at 
+    BEFORE UPDATE ON checklist_items 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,3 @@
+-- Drop task_dependencies table and related objects
+DROP INDEX IF EXISTS idx_task_dependencies_target_task_id;
+DROP TABLE IF EXISTS task_dependencies;
@@ -0,0 +1,17 @@
+-- Create task_dependencies table
+-- A "blocks" dependency means task_id has to be done before target_task_id
+-- can start. "relates_to" links have no direction and are stored with the
+-- lower task ID first. Both tasks belong to the same project.
+CREATE TABLE task_dependencies (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    target_task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('blocks', 'relates_to')),
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (task_id, target_task_id, type),
+    CHECK (task_id <> target_task_id)
+);
+
+-- Create indexes for task_dependencies table
+CREATE INDEX idx_task_dependencies_target_task_id ON task_dependencies(target_task_id);
@@ -0,0 +1,7 @@
+-- Drop recurrence from tasks
+DROP INDEX IF EXISTS idx_tasks_recurrence_rule;
+ALTER TABLE tasks DROP COLUMN IF EXISTS completed_at;
+ALTER TABLE tasks DROP COLUMN IF EXISTS recurs_from_task_id;
+ALTER TABLE tasks DROP COLUMN IF EXISTS recurrence_set_by;
+ALTER TABLE tasks DROP COLUMN IF EXISTS recur_after_completion;
+ALTER TABLE tasks DROP COLUMN IF EXISTS recurrence_rule;
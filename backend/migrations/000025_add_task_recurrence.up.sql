@@ -0,0 +1,15 @@
+-- Add recurrence to tasks
+-- recurrence_rule is an RRULE subset (see internal/recurrence). Only the
+-- latest instance of a series carries the rule; the scheduler copies it to
+-- the next instance once the task is completed or, unless the series repeats
+-- after completion, its due date arrives. recurrence_set_by is who set the
+-- rule, whom the scheduler's history entries are attributed to.
+ALTER TABLE tasks ADD COLUMN recurrence_rule VARCHAR(255);
+ALTER TABLE tasks ADD COLUMN recur_after_completion BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE tasks ADD COLUMN recurrence_set_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE tasks ADD COLUMN recurs_from_task_id INTEGER REFERENCES tasks(id) ON DELETE SET NULL;
+ALTER TABLE tasks ADD COLUMN completed_at TIMESTAMP;
+
+UPDATE tasks SET completed_at = updated_at WHERE status = 'done';
+
+CREATE INDEX idx_tasks_recurrence_rule ON tasks(due_date) WHERE recurrence_rule IS NOT NULL;
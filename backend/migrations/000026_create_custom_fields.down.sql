@@ -0,0 +1,5 @@
+-- Drop custom field tables
+DROP INDEX IF EXISTS idx_task_custom_field_values_field_id;
+DROP TABLE IF EXISTS task_custom_field_values;
+DROP TRIGGER IF EXISTS update_custom_fields_updated_at ON custom_fields;
+DROP TABLE IF EXISTS custom_fields;
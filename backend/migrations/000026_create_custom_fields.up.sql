@@ -0,0 +1,33 @@
+-- Create custom_fields table
+-- Fields a project defines for its tasks. options lists the choices of
+-- select fields as a JSON array of strings.
+CREATE TABLE custom_fields (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('text', 'number', 'date', 'single_select', 'multi_select', 'user', 'url', 'checkbox')),
+    options JSONB NOT NULL DEFAULT '[]',
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (project_id, name)
+);
+
+-- Add trigger for updated_at
+CREATE TRIGGER update_custom_fields_updated_at 
+    BEFORE UPDATE ON custom_fields 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Create task_custom_field_values table
+-- One JSON value per task and field; unset fields have no row.
+CREATE TABLE task_custom_field_values (
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    field_id INTEGER NOT NULL REFERENCES custom_fields(id) ON DELETE CASCADE,
+    value JSONB NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (task_id, field_id)
+);
+
+-- Create indexes for task_custom_field_values table
+CREATE INDEX idx_task_custom_field_values_field_id ON task_custom_field_values(field_id);
@@ -0,0 +1,8 @@
+-- Drop project statuses and transitions
+DROP TRIGGER IF EXISTS add_default_project_statuses_after_insert ON projects;
+DROP FUNCTION IF EXISTS add_default_project_statuses();
+ALTER TABLE boards DROP COLUMN IF EXISTS status_id;
+DROP INDEX IF EXISTS idx_status_transitions_to_status_id;
+DROP TABLE IF EXISTS status_transitions;
+DROP TRIGGER IF EXISTS update_project_statuses_updated_at ON project_statuses;
+DROP TABLE IF EXISTS project_statuses;
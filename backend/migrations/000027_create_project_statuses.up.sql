@@ -0,0 +1,68 @@
+-- Create project_statuses table
+-- The statuses tasks of a project can have; tasks.status holds the key.
+-- Tasks in a status of the done category are finished and have a
+-- completed_at.
+CREATE TABLE project_statuses (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    key VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    category VARCHAR(20) NOT NULL CHECK (category IN ('todo', 'in_progress', 'done')),
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (project_id, key)
+);
+
+-- Add trigger for updated_at
+CREATE TRIGGER update_project_statuses_updated_at 
+    BEFORE UPDATE ON project_statuses 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Create status_transitions table
+-- Once a project has transitions, tasks can only change status along them.
+CREATE TABLE status_transitions (
+    from_status_id INTEGER NOT NULL REFERENCES project_statuses(id) ON DELETE CASCADE,
+    to_status_id INTEGER NOT NULL REFERENCES project_statuses(id) ON DELETE CASCADE,
+    PRIMARY KEY (from_status_id, to_status_id),
+    CHECK (from_status_id <> to_status_id)
+);
+
+-- Create indexes for status_transitions table
+CREATE INDEX idx_status_transitions_to_status_id ON status_transitions(to_status_id);
+
+-- Tasks moved to a board mapped to a status take that status
+ALTER TABLE boards ADD COLUMN status_id INTEGER REFERENCES project_statuses(id) ON DELETE SET NULL;
+
+-- Every project starts with the default statuses
+CREATE OR REPLACE FUNCTION add_default_project_statuses()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO project_statuses (project_id, key, name, category, position)
+    VALUES (NEW.id, 'todo', 'To Do', 'todo', 0),
+           (NEW.id, 'in_progress', 'In Progress', 'in_progress', 1),
+           (NEW.id, 'done', 'Done', 'done', 2);
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER add_default_project_statuses_after_insert
+    AFTER INSERT ON projects
+    FOR EACH ROW
+    EXECUTE FUNCTION add_default_project_statuses();
+
+-- Existing projects get the default statuses, plus any other status their
+-- tasks already use
+INSERT INTO project_statuses (project_id, key, name, category, position)
+SELECT p.id, d.key, d.name, d.category, d.position
+FROM projects p
+CROSS JOIN (VALUES ('todo', 'To Do', 'todo', 0),
+                   ('in_progress', 'In Progress', 'in_progress', 1),
+                   ('done', 'Done', 'done', 2)) AS d(key, name, category, position);
+
+INSERT INTO project_statuses (project_id, key, name, category, position)
+SELECT DISTINCT b.project_id, t.status, t.status, 'todo', 3
+FROM tasks t
+JOIN boards b ON t.board_id = b.id
+WHERE t.status NOT IN ('todo', 'in_progress', 'done');
@@ -0,0 +1,6 @@
+-- Drop project priorities
+DROP TRIGGER IF EXISTS add_default_project_priorities_after_insert ON projects;
+DROP FUNCTION IF EXISTS add_default_project_priorities();
+DROP TRIGGER IF EXISTS update_project_priorities_updated_at ON project_priorities;
+DROP INDEX IF EXISTS idx_project_priorities_project_id_default;
+DROP TABLE IF EXISTS project_priorities;
@@ -0,0 +1,71 @@
+-- Create project_priorities table
+-- The priorities tasks of a project can have, ranked from least to most
+-- urgent; tasks.priority holds the key.
+CREATE TABLE project_priorities (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    key VARCHAR(20) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    color VARCHAR(7) NOT NULL DEFAULT '#607D8B',
+    rank INTEGER NOT NULL DEFAULT 0,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (project_id, key)
+);
+
+-- Each project has a single default priority
+CREATE UNIQUE INDEX idx_project_priorities_project_id_default ON project_priorities(project_id) WHERE is_default;
+
+-- Add trigger for updated_at
+CREATE TRIGGER update_project_priorities_updated_at 
+    BEFORE UPDATE ON project_priorities 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Every project starts with the default priorities
+CREATE OR REPLACE FUNCTION add_default_project_priorities()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO project_priorities (project_id, key, name, color, rank, is_default)
+    VALUES (NEW.id, 'low', 'Low', '#607D8B', 0, FALSE),
+           (NEW.id, 'medium', 'Medium', '#2196F3', 1, TRUE),
+           (NEW.id, 'high', 'High', '#FF9800', 2, FALSE),
+           (NEW.id, 'urgent', 'Urgent', '#F44336', 3, FALSE);
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER add_default_project_priorities_after_insert
+    AFTER INSERT ON projects
+    FOR EACH ROW
+    EXECUTE FUNCTION add_default_project_priorities();
+
+INSERT INTO project_priorities (project_id, key, name, color, rank, is_default)
+SELECT p.id, d.key, d.name, d.color, d.rank, d.is_default
+FROM projects p
+CROSS JOIN (VALUES ('low', 'Low', '#607D8B', 0, FALSE),
+                   ('medium', 'Medium', '#2196F3', 1, TRUE),
+                   ('high', 'High', '#FF9800', 2, FALSE),
+                   ('urgent', 'Urgent', '#F44336', 3, FALSE)) AS d(key, name, color, rank, is_default);
+
+-- Normalize existing priorities: case and spacing, common synonyms, and
+-- anything else falls back to the default. Each rewritten task gets a
+-- history entry with its previous priority, attributed to the project owner.
+WITH normalized AS (
+    UPDATE tasks t SET priority = CASE
+            WHEN LOWER(TRIM(old.priority)) IN ('low', 'medium', 'high', 'urgent') THEN LOWER(TRIM(old.priority))
+            WHEN LOWER(TRIM(old.priority)) IN ('lowest', 'minor', 'trivial') THEN 'low'
+            WHEN LOWER(TRIM(old.priority)) IN ('hi', 'hgih', 'major', 'important') THEN 'high'
+            WHEN LOWER(TRIM(old.priority)) IN ('highest', 'critical', 'blocker') THEN 'urgent'
+            ELSE 'medium'
+        END
+    FROM tasks old
+    WHERE old.id = t.id AND old.priority NOT IN ('low', 'medium', 'high', 'urgent')
+    RETURNING t.id, t.board_id, t.priority, old.priority AS previous_priority
+)
+INSERT INTO task_history (task_id, user_id, action, changes_json)
+SELECT n.id, p.user_id, 'updated', jsonb_build_object('priority', n.priority, 'previous_priority', n.previous_priority)
+FROM normalized n
+JOIN boards b ON n.board_id = b.id
+JOIN projects p ON b.project_id = p.id;
@@ -0,0 +1,7 @@
+-- Drop time_entries table and related objects
+DROP TRIGGER IF EXISTS update_time_entries_updated_at ON time_entries;
+DROP INDEX IF EXISTS idx_time_entries_user_id_running;
+DROP INDEX IF EXISTS idx_time_entries_started_at;
+DROP INDEX IF EXISTS idx_time_entries_user_id;
+DROP INDEX IF EXISTS idx_time_entries_task_id;
+DROP TABLE IF EXISTS time_entries;
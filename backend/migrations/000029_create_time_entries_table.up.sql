@@ -0,0 +1,28 @@
+-- Create time_entries table
+-- Time users spent on tasks, logged by hand or with a timer. The timer of an
+-- entry runs while ended_at is NULL.
+CREATE TABLE time_entries (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ended_at IS NULL OR ended_at > started_at)
+);
+
+-- Create indexes for time_entries table
+CREATE INDEX idx_time_entries_task_id ON time_entries(task_id);
+CREATE INDEX idx_time_entries_user_id ON time_entries(user_id, started_at);
+CREATE INDEX idx_time_entries_started_at ON time_entries(started_at);
+
+-- A user has at most one running timer
+CREATE UNIQUE INDEX idx_time_entries_user_id_running ON time_entries(user_id) WHERE ended_at IS NULL;
+
+-- Add trigger for updated_at
+CREATE TRIGGER update_time_entries_updated_at 
+    BEFORE UPDATE ON time_entries 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,4 @@
+-- Drop estimates from tasks
+ALTER TABLE tasks DROP COLUMN IF EXISTS remaining_estimate;
+ALTER TABLE tasks DROP COLUMN IF EXISTS original_estimate;
+ALTER TABLE projects DROP COLUMN IF EXISTS estimate_unit;
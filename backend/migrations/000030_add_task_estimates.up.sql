@@ -0,0 +1,8 @@
+-- Add estimates to tasks
+-- Projects estimate effort in hours or in points. original_estimate is the
+-- effort expected up front and remaining_estimate the effort still left;
+-- both are in the project's unit and optional.
+ALTER TABLE projects ADD COLUMN estimate_unit VARCHAR(10) NOT NULL DEFAULT 'hours'
+    CHECK (estimate_unit IN ('hours', 'points'));
+ALTER TABLE tasks ADD COLUMN original_estimate NUMERIC(10, 2) CHECK (original_estimate >= 0);
+ALTER TABLE tasks ADD COLUMN remaining_estimate NUMERIC(10, 2) CHECK (remaining_estimate >= 0);
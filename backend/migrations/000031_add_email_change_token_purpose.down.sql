@@ -0,0 +1,5 @@
+-- Turn pending email changes back into verification tokens
+UPDATE user_tokens SET purpose = 'email_verification' WHERE purpose = 'email_change';
+ALTER TABLE user_tokens DROP CONSTRAINT user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check
+    CHECK (purpose IN ('password_reset', 'email_verification'));
@@ -0,0 +1,5 @@
+-- Email changes get their own token purpose, so a new link to verify the
+-- current address does not cancel a pending change and vice versa.
+ALTER TABLE user_tokens DROP CONSTRAINT user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check
+    CHECK (purpose IN ('password_reset', 'email_verification', 'email_change'));
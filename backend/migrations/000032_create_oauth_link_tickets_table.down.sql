@@ -0,0 +1,7 @@
+-- Drop oauth_link_confirmations table and related objects
+DROP INDEX IF EXISTS idx_oauth_link_confirmations_user_id;
+DROP TABLE IF EXISTS oauth_link_confirmations;
+
+-- Drop oauth_link_tickets table and related objects
+DROP INDEX IF EXISTS idx_oauth_link_tickets_user_id;
+DROP TABLE IF EXISTS oauth_link_tickets;
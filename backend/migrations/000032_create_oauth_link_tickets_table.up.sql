@@ -0,0 +1,38 @@
+-- Create oauth_link_tickets table
+-- One-time tickets that carry a signed-in user from the API to a top-level
+-- browser navigation starting provider linking, since the frontend's bearer
+-- token cannot follow the browser and a state cookie set on an XHR is not
+-- kept across sites.
+CREATE TABLE oauth_link_tickets (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    ticket_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for oauth_link_tickets table
+CREATE INDEX idx_oauth_link_tickets_user_id ON oauth_link_tickets(user_id);
+
+-- Create oauth_link_confirmations table
+-- Provider accounts returned to a link callback, waiting for the user who
+-- started the link to confirm them from the frontend. Whoever opens a ticket
+-- signs in at the provider, so the link is only made once the same user
+-- confirms it.
+CREATE TABLE oauth_link_confirmations (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for oauth_link_confirmations table
+CREATE INDEX idx_oauth_link_confirmations_user_id ON oauth_link_confirmations(user_id);
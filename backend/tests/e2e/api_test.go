@@ -7,15 +7,27 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mochammadshenna/4me-backend/internal/auth"
 	"github.com/mochammadshenna/4me-backend/internal/config"
 	"github.com/mochammadshenna/4me-backend/internal/database"
 	"github.com/mochammadshenna/4me-backend/internal/handlers"
+	"github.com/mochammadshenna/4me-backend/internal/jwks"
+	"github.com/mochammadshenna/4me-backend/internal/mailer"
 	"github.com/mochammadshenna/4me-backend/internal/middleware"
 	"github.com/mochammadshenna/4me-backend/internal/models"
+	"github.com/mochammadshenna/4me-backend/internal/oauth"
+	"github.com/mochammadshenna/4me-backend/internal/ratelimit"
+	"github.com/mochammadshenna/4me-backend/internal/recurrence"
+	"github.com/mochammadshenna/4me-backend/internal/totp"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -23,19 +35,52 @@ type E2ETestSuite struct {
 	suite.Suite
 	router *gin.Engine
 	db     *database.Database
+	mail   *mailbox
 	token  string
 	userID int
 }
 
+// mailbox records sent mail so tests can follow emailed links.
+type mailbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *mailbox) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var mailTokenPattern = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+// lastToken returns the token in the last link mailed to address.
+func (m *mailbox) lastToken(address string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To[0] == address {
+			if match := mailTokenPattern.FindStringSubmatch(m.messages[i].Body); match != nil {
+				return match[1]
+			}
+		}
+	}
+	return ""
+}
+
 func (suite *E2ETestSuite) SetupSuite() {
 	gin.SetMode(gin.TestMode)
 
 	cfg := &config.Config{
-		DatabaseURL: "postgres://localhost:5432/4me_todos_test?sslmode=disable",
-		JWTSecret:   "test-secret-key",
-		SupabaseURL: "http://localhost:54321",
-		SupabaseKey: "test-key",
-		FrontendURL: "http://localhost:5173",
+		DatabaseURL:        "postgres://localhost:5432/4me_todos_test?sslmode=disable",
+		JWTSecret:          "test-secret-key",
+		TOTPEncryptionKey:  "test-totp-key",
+		SupabaseURL:        "http://localhost:54321",
+		SupabaseKey:        "test-key",
+		FrontendURL:        "http://localhost:5173",
+		CORSAllowedOrigins: []string{"http://localhost:5173"},
+		CORSMaxAge:         time.Hour,
 	}
 
 	var err error
@@ -51,55 +96,173 @@ func (suite *E2ETestSuite) SetupSuite() {
 
 	// Setup router
 	suite.router = gin.New()
-	suite.router.Use(middleware.CORSMiddleware(cfg.FrontendURL))
-
-	authHandler := handlers.NewAuthHandler(suite.db, cfg)
-	projectHandler := handlers.NewProjectHandler(suite.db)
+	cors, err := middleware.CORSMiddleware(cfg.CORSAllowedOrigins, cfg.CORSMaxAge)
+	suite.Require().NoError(err)
+	suite.router.Use(cors)
+
+	suite.mail = &mailbox{}
+	keys := jwks.NewHMAC(cfg.JWTSecret)
+	sessions := auth.NewSessions(suite.db)
+	tokens := auth.NewAccessTokens(suite.db)
+	// The suite logs in from one address far more often than a client would
+	limitStore := ratelimit.NewMemoryStore()
+	limiter := ratelimit.New(limitStore,
+		ratelimit.Limit{Requests: 1000, Per: time.Minute},
+		ratelimit.Limit{Requests: 100, Per: time.Minute},
+		ratelimit.Lockout{MaxFailures: 3, Window: 15 * time.Minute, Duration: 15 * time.Minute})
+	apiLimiter := ratelimit.NewAPI(limitStore,
+		ratelimit.Limit{Requests: 10000, Per: time.Minute},
+		ratelimit.Limit{Requests: 1000, Per: time.Minute},
+		ratelimit.Limit{Requests: 1000, Per: time.Minute})
+	authHandler := handlers.NewAuthHandler(suite.db, cfg, oauth.NewRegistry(), sessions, suite.mail, limiter, keys)
+	sessionHandler := handlers.NewSessionHandler(sessions, cfg)
+	tokenHandler := handlers.NewAccessTokenHandler(suite.db, tokens)
+	projectHandler := handlers.NewProjectHandler(suite.db, cfg)
+	memberHandler := handlers.NewMemberHandler(suite.db)
+	invitationHandler := handlers.NewInvitationHandler(suite.db, cfg, mailer.NewLogSender("test@localhost"))
 	boardHandler := handlers.NewBoardHandler(suite.db)
-	taskHandler := handlers.NewTaskHandler(suite.db)
+	taskHandler := handlers.NewTaskHandler(suite.db, cfg)
 	labelHandler := handlers.NewLabelHandler(suite.db)
+	customFieldHandler := handlers.NewCustomFieldHandler(suite.db)
+	statusHandler := handlers.NewStatusHandler(suite.db)
+	priorityHandler := handlers.NewPriorityHandler(suite.db)
+	timeEntryHandler := handlers.NewTimeEntryHandler(suite.db)
+	estimateHandler := handlers.NewEstimateHandler(suite.db)
+	checklistHandler := handlers.NewChecklistHandler(suite.db)
+	dependencyHandler := handlers.NewDependencyHandler(suite.db)
 	commentHandler := handlers.NewCommentHandler(suite.db)
 
-	api := suite.router.Group("/api")
+	api := suite.router.Group("/api", apiLimiter.ByIP())
 	{
-		auth := api.Group("/auth")
+		auth := api.Group("/auth", limiter.ByIP())
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/exchange", authHandler.Exchange)
+			auth.POST("/password/forgot", authHandler.ForgotPassword)
+			auth.POST("/password/reset", authHandler.ResetPassword)
+			auth.POST("/email/verify", authHandler.VerifyEmail)
+			auth.POST("/2fa/verify", middleware.MFAPendingMiddleware(cfg.JWTSecret), authHandler.VerifyTwoFactor)
 		}
 	}
 
 	protected := api.Group("")
-	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	protected.Use(middleware.AuthMiddleware(cfg, keys, sessions, tokens), apiLimiter.ByUser())
 	{
 		protected.GET("/auth/me", authHandler.Me)
-		protected.POST("/projects", projectHandler.Create)
-		protected.GET("/projects", projectHandler.List)
-		protected.GET("/projects/:id", projectHandler.Get)
-		protected.PUT("/projects/:id", projectHandler.Update)
-		protected.DELETE("/projects/:id", projectHandler.Delete)
+	}
+
+	account := protected.Group("", middleware.RequireSession())
+	{
+		account.PUT("/auth/password", authHandler.ChangePassword)
+		account.PUT("/auth/email", authHandler.ChangeEmail)
+		account.POST("/auth/email/verification", authHandler.ResendVerification)
+		account.GET("/auth/2fa", authHandler.TwoFactorStatus)
+		account.POST("/auth/2fa/setup", authHandler.SetupTwoFactor)
+		account.POST("/auth/2fa/enable", authHandler.EnableTwoFactor)
+		account.POST("/auth/2fa/disable", authHandler.DisableTwoFactor)
+		account.POST("/auth/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+		account.POST("/auth/logout", sessionHandler.Logout)
+		account.GET("/auth/sessions", sessionHandler.List)
+		account.DELETE("/auth/sessions", sessionHandler.LogoutAll)
+		account.DELETE("/auth/sessions/:id", sessionHandler.Revoke)
+		account.GET("/auth/identities", authHandler.ListIdentities)
+		account.POST("/auth/identities/:provider", authHandler.LinkIdentity)
+		account.DELETE("/auth/identities/:provider", authHandler.UnlinkIdentity)
+		account.POST("/auth/tokens", tokenHandler.Create)
+		account.GET("/auth/tokens", tokenHandler.List)
+		account.DELETE("/auth/tokens/:id", tokenHandler.Revoke)
+
+		account.POST("/invitations/:id/accept", invitationHandler.Accept)
+		account.POST("/invitations/:id/decline", invitationHandler.Decline)
+	}
 
-		protected.POST("/projects/:id/boards", boardHandler.Create)
-		protected.GET("/projects/:id/boards", boardHandler.List)
-		protected.PUT("/boards/:id", boardHandler.Update)
-		protected.DELETE("/boards/:id", boardHandler.Delete)
+	projectsRead := protected.Group("", middleware.RequireScope(auth.ScopeProjectsRead))
+	{
+		projectsRead.GET("/projects", projectHandler.List)
+		projectsRead.GET("/projects/:id", projectHandler.Get)
+		projectsRead.GET("/projects/:id/members", memberHandler.List)
+		projectsRead.GET("/projects/:id/boards", boardHandler.List)
+		projectsRead.GET("/projects/:id/labels", labelHandler.List)
+		projectsRead.GET("/projects/:id/custom-fields", customFieldHandler.List)
+		projectsRead.GET("/projects/:id/workflow", statusHandler.Workflow)
+		projectsRead.GET("/projects/:id/priorities", priorityHandler.List)
+	}
 
-		protected.POST("/boards/:id/tasks", taskHandler.Create)
-		protected.GET("/tasks/:id", taskHandler.Get)
-		protected.PUT("/tasks/:id", taskHandler.Update)
-		protected.PATCH("/tasks/:id/move", taskHandler.Move)
-		protected.DELETE("/tasks/:id", taskHandler.Delete)
-		protected.GET("/tasks/:id/history", taskHandler.GetHistory)
+	projectsWrite := protected.Group("", middleware.RequireScope(auth.ScopeProjectsWrite))
+	{
+		projectsWrite.POST("/projects", projectHandler.Create)
+		projectsWrite.PUT("/projects/:id", projectHandler.Update)
+		projectsWrite.POST("/projects/:id/boards", boardHandler.Create)
+		projectsWrite.PUT("/boards/:id", boardHandler.Update)
+		projectsWrite.DELETE("/boards/:id", boardHandler.Delete)
+		projectsWrite.POST("/projects/:id/labels", labelHandler.Create)
+		projectsWrite.PUT("/labels/:id", labelHandler.Update)
+		projectsWrite.DELETE("/labels/:id", labelHandler.Delete)
+		projectsWrite.POST("/projects/:id/custom-fields", customFieldHandler.Create)
+		projectsWrite.PUT("/custom-fields/:id", customFieldHandler.Update)
+		projectsWrite.DELETE("/custom-fields/:id", customFieldHandler.Delete)
+		projectsWrite.POST("/projects/:id/statuses", statusHandler.Create)
+		projectsWrite.PUT("/statuses/:id", statusHandler.Update)
+		projectsWrite.DELETE("/statuses/:id", statusHandler.Delete)
+		projectsWrite.PUT("/projects/:id/transitions", statusHandler.UpdateTransitions)
+		projectsWrite.POST("/projects/:id/priorities", priorityHandler.Create)
+		projectsWrite.PUT("/priorities/:id", priorityHandler.Update)
+		projectsWrite.DELETE("/priorities/:id", priorityHandler.Delete)
+	}
 
-		protected.POST("/projects/:id/labels", labelHandler.Create)
-		protected.GET("/projects/:id/labels", labelHandler.List)
-		protected.PUT("/labels/:id", labelHandler.Update)
-		protected.DELETE("/labels/:id", labelHandler.Delete)
+	projectsAdmin := protected.Group("", middleware.RequireScope(auth.ScopeProjectsAdmin))
+	{
+		projectsAdmin.DELETE("/projects/:id", projectHandler.Delete)
+		projectsAdmin.POST("/projects/:id/members", memberHandler.Add)
+		projectsAdmin.PUT("/projects/:id/members/:userId", memberHandler.Update)
+		projectsAdmin.DELETE("/projects/:id/members/:userId", memberHandler.Remove)
+		projectsAdmin.POST("/projects/:id/invitations", invitationHandler.Create)
+		projectsAdmin.GET("/projects/:id/invitations", invitationHandler.List)
+		projectsAdmin.DELETE("/invitations/:id", invitationHandler.Revoke)
+	}
 
-		protected.POST("/tasks/:id/comments", commentHandler.Create)
-		protected.GET("/tasks/:id/comments", commentHandler.List)
-		protected.PUT("/comments/:id", commentHandler.Update)
-		protected.DELETE("/comments/:id", commentHandler.Delete)
+	tasksRead := protected.Group("", middleware.RequireScope(auth.ScopeTasksRead))
+	{
+		tasksRead.GET("/projects/:id/tasks", taskHandler.ListByProject)
+		tasksRead.GET("/boards/:id/tasks", taskHandler.List)
+		tasksRead.GET("/tasks", taskHandler.ListAll)
+		tasksRead.GET("/tasks/:id", taskHandler.Get)
+		tasksRead.GET("/tasks/:id/history", taskHandler.GetHistory)
+		tasksRead.GET("/tasks/:id/subtasks", taskHandler.ListSubtasks)
+		tasksRead.GET("/tasks/:id/checklist", checklistHandler.List)
+		tasksRead.GET("/tasks/:id/dependencies", dependencyHandler.List)
+		tasksRead.GET("/projects/:id/dependencies", dependencyHandler.Graph)
+		tasksRead.GET("/projects/:id/estimates", estimateHandler.Rollup)
+		tasksRead.GET("/tasks/:id/comments", commentHandler.List)
+		tasksRead.GET("/tasks/:id/time-entries", timeEntryHandler.List)
+		tasksRead.GET("/timer", timeEntryHandler.RunningTimer)
+		tasksRead.GET("/timesheet", timeEntryHandler.Timesheet)
+	}
+
+	tasksWrite := protected.Group("", middleware.RequireScope(auth.ScopeTasksWrite))
+	{
+		tasksWrite.POST("/boards/:id/tasks", taskHandler.Create)
+		tasksWrite.PUT("/tasks/:id", taskHandler.Update)
+		tasksWrite.PATCH("/tasks/:id/move", taskHandler.Move)
+		tasksWrite.DELETE("/tasks/:id", taskHandler.Delete)
+		tasksWrite.POST("/tasks/:id/subtasks", taskHandler.CreateSubtask)
+		tasksWrite.PUT("/tasks/:id/subtasks/order", taskHandler.ReorderSubtasks)
+		tasksWrite.POST("/tasks/:id/checklist", checklistHandler.Create)
+		tasksWrite.PUT("/tasks/:id/checklist/order", checklistHandler.Reorder)
+		tasksWrite.PUT("/checklist-items/:id", checklistHandler.Update)
+		tasksWrite.DELETE("/checklist-items/:id", checklistHandler.Delete)
+		tasksWrite.POST("/tasks/:id/dependencies", dependencyHandler.Create)
+		tasksWrite.DELETE("/dependencies/:id", dependencyHandler.Delete)
+		tasksWrite.POST("/tasks/:id/comments", commentHandler.Create)
+		tasksWrite.PUT("/comments/:id", commentHandler.Update)
+		tasksWrite.DELETE("/comments/:id", commentHandler.Delete)
+		tasksWrite.POST("/tasks/:id/time-entries", timeEntryHandler.Create)
+		tasksWrite.PUT("/time-entries/:id", timeEntryHandler.Update)
+		tasksWrite.DELETE("/time-entries/:id", timeEntryHandler.Delete)
+		tasksWrite.POST("/tasks/:id/timer/start", timeEntryHandler.StartTimer)
+		tasksWrite.POST("/tasks/:id/timer/stop", timeEntryHandler.StopTimer)
 	}
 }
 
@@ -111,7 +274,7 @@ func (suite *E2ETestSuite) TearDownSuite() {
 
 func (suite *E2ETestSuite) SetupTest() {
 	// Clean database before each test
-	suite.db.Pool.Exec(context.Background(), "TRUNCATE users, projects, boards, tasks, labels, task_labels, comments, attachments, task_history CASCADE")
+	suite.db.Pool.Exec(context.Background(), "TRUNCATE users, sessions, refresh_tokens, user_identities, user_tokens, recovery_codes, personal_access_tokens, projects, project_members, project_invitations, boards, tasks, labels, task_labels, custom_fields, task_custom_field_values, project_statuses, status_transitions, project_priorities, checklist_items, time_entries, task_dependencies, comments, attachments, task_history CASCADE")
 }
 
 func (suite *E2ETestSuite) TestCompleteWorkflow() {
@@ -247,7 +410,35 @@ func (suite *E2ETestSuite) TestCompleteWorkflow() {
 	json.Unmarshal(w.Body.Bytes(), &history)
 	assert.NotEmpty(suite.T(), history)
 
-	// 9. Update task
+	// 9. List board tasks with labels and counts
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/boards/%d/tasks", board.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var boardTasks models.TaskPage
+	json.Unmarshal(w.Body.Bytes(), &boardTasks)
+	assert.Nil(suite.T(), boardTasks.NextCursor)
+	if assert.Len(suite.T(), boardTasks.Tasks, 1) {
+		assert.Len(suite.T(), boardTasks.Tasks[0].Labels, 1)
+		assert.Equal(suite.T(), 1, boardTasks.Tasks[0].CommentCount)
+	}
+
+	// 9b. Filter tasks by label and priority
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/tasks?label=%d&priority[ne]=high", label.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var filtered models.TaskPage
+	json.Unmarshal(w.Body.Bytes(), &filtered)
+	assert.Empty(suite.T(), filtered.Tasks)
+
+	// 10. Update task
 	updateReq := models.UpdateTaskRequest{
 		Title: stringPtr("Fix critical login bug"),
 	}
@@ -261,7 +452,7 @@ func (suite *E2ETestSuite) TestCompleteWorkflow() {
 
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
 
-	// 10. Delete task
+	// 11. Delete task
 	req = httptest.NewRequest("DELETE", fmt.Sprintf("/api/tasks/%d", task.ID), nil)
 	req.Header.Set("Authorization", "Bearer "+suite.token)
 	w = httptest.NewRecorder()
@@ -345,6 +536,1282 @@ func (suite *E2ETestSuite) TestProjectOwnership() {
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
 }
 
+func (suite *E2ETestSuite) TestProjectMembership() {
+	owner := suite.register("owner", "owner@example.com")
+	viewer := suite.register("viewer", "viewer@example.com")
+
+	// Owner creates a project and adds a viewer by email
+	w := suite.request("POST", "/api/projects", owner.Token, models.CreateProjectRequest{Name: "Shared Project"})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	var project models.Project
+	json.Unmarshal(w.Body.Bytes(), &project)
+	assert.Equal(suite.T(), models.RoleOwner, project.Role)
+
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/members", project.ID), owner.Token,
+		models.AddMemberRequest{Email: stringPtr("viewer@example.com"), Role: models.RoleViewer})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	// The viewer can read the project but not change it
+	w = suite.request("GET", fmt.Sprintf("/api/projects/%d", project.ID), viewer.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/boards", project.ID), viewer.Token, models.CreateBoardRequest{Name: "Nope"})
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	// The last owner cannot be demoted
+	w = suite.request("PUT", fmt.Sprintf("/api/projects/%d/members/%d", project.ID, owner.User.ID), owner.Token,
+		models.UpdateMemberRequest{Role: models.RoleAdmin})
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	// Promote the viewer to editor; now they can create boards
+	w = suite.request("PUT", fmt.Sprintf("/api/projects/%d/members/%d", project.ID, viewer.User.ID), owner.Token,
+		models.UpdateMemberRequest{Role: models.RoleEditor})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/boards", project.ID), viewer.Token, models.CreateBoardRequest{Name: "Doing"})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	// Members can leave on their own
+	w = suite.request("DELETE", fmt.Sprintf("/api/projects/%d/members/%d", project.ID, viewer.User.ID), viewer.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("GET", fmt.Sprintf("/api/projects/%d", project.ID), viewer.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *E2ETestSuite) TestProjectInvitations() {
+	owner := suite.register("owner", "owner@example.com")
+	member := suite.register("member", "member@example.com")
+
+	w := suite.request("POST", "/api/projects", owner.Token, models.CreateProjectRequest{Name: "Invite Project"})
+	var project models.Project
+	json.Unmarshal(w.Body.Bytes(), &project)
+
+	// Invite an existing user; the invitation shows up on /auth/me
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/invitations", project.ID), owner.Token,
+		models.CreateInvitationRequest{Email: "Member@example.com", Role: models.RoleEditor})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	var invitation models.ProjectInvitation
+	json.Unmarshal(w.Body.Bytes(), &invitation)
+
+	w = suite.request("GET", "/api/auth/me", member.Token, nil)
+	var me models.MeResponse
+	json.Unmarshal(w.Body.Bytes(), &me)
+	assert.Len(suite.T(), me.PendingInvitations, 1)
+
+	// Only the addressee can respond
+	w = suite.request("POST", fmt.Sprintf("/api/invitations/%d/accept", invitation.ID), owner.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	w = suite.request("POST", fmt.Sprintf("/api/invitations/%d/accept", invitation.ID), member.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("GET", fmt.Sprintf("/api/projects/%d", project.ID), member.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Invite an unknown address; signing up joins the project
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/invitations", project.ID), owner.Token,
+		models.CreateInvitationRequest{Email: "newcomer@example.com", Role: models.RoleViewer})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	newcomer := suite.register("newcomer", "newcomer@example.com")
+	w = suite.request("GET", fmt.Sprintf("/api/projects/%d", project.ID), newcomer.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *E2ETestSuite) TestSessions() {
+	laptop := suite.register("sessionuser", "session@example.com")
+
+	w := suite.request("POST", "/api/auth/login", "", models.LoginRequest{Username: "sessionuser", Password: "password123"})
+	var phone models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &phone)
+
+	w = suite.request("GET", "/api/auth/sessions", laptop.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var sessions []models.Session
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	assert.Len(suite.T(), sessions, 2)
+
+	// Revoking the phone's session locks out its token right away
+	var phoneSession int
+	for _, session := range sessions {
+		if !session.Current {
+			phoneSession = session.ID
+		}
+	}
+	w = suite.request("DELETE", fmt.Sprintf("/api/auth/sessions/%d", phoneSession), laptop.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("GET", "/api/auth/me", phone.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	w = suite.request("POST", "/api/auth/refresh", "", models.RefreshRequest{RefreshToken: phone.RefreshToken})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	// Logging out everywhere ends the remaining session
+	w = suite.request("DELETE", "/api/auth/sessions", laptop.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("GET", "/api/auth/me", laptop.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *E2ETestSuite) TestPasswordReset() {
+	user := suite.register("forgetful", "forgetful@example.com")
+
+	// Unknown addresses get the same answer
+	w := suite.request("POST", "/api/auth/password/forgot", "", models.ForgotPasswordRequest{Email: "nobody@example.com"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("POST", "/api/auth/password/forgot", "", models.ForgotPasswordRequest{Email: "Forgetful@example.com"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	token := suite.mail.lastToken("forgetful@example.com")
+	assert.NotEmpty(suite.T(), token)
+
+	w = suite.request("POST", "/api/auth/password/reset", "", models.ResetPasswordRequest{Token: token, Password: "newpassword"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// The token works once, and existing sessions are signed out
+	w = suite.request("POST", "/api/auth/password/reset", "", models.ResetPasswordRequest{Token: token, Password: "otherpassword"})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.request("GET", "/api/auth/me", user.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	w = suite.request("POST", "/api/auth/login", "", models.LoginRequest{Username: "forgetful", Password: "newpassword"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Receiving the reset email verified the address
+	var resp models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NotNil(suite.T(), resp.User.EmailVerifiedAt)
+}
+
+func (suite *E2ETestSuite) TestEmailVerification() {
+	user := suite.register("verifier", "verifier@example.com")
+	assert.Nil(suite.T(), user.User.EmailVerifiedAt)
+
+	w := suite.request("POST", "/api/auth/email/verify", "", models.VerifyEmailRequest{Token: suite.mail.lastToken("verifier@example.com")})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var verified models.User
+	json.Unmarshal(w.Body.Bytes(), &verified)
+	assert.NotNil(suite.T(), verified.EmailVerifiedAt)
+
+	w = suite.request("POST", "/api/auth/email/verification", user.Token, nil)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	// Changing the address needs the password and takes effect once the
+	// new address is verified
+	w = suite.request("PUT", "/api/auth/email", user.Token, models.ChangeEmailRequest{Email: "moved@example.com", CurrentPassword: "wrong"})
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w = suite.request("PUT", "/api/auth/email", user.Token, models.ChangeEmailRequest{Email: "moved@example.com", CurrentPassword: "password123"})
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+
+	w = suite.request("GET", "/api/auth/me", user.Token, nil)
+	var me models.MeResponse
+	json.Unmarshal(w.Body.Bytes(), &me)
+	assert.Equal(suite.T(), "verifier@example.com", me.Email)
+
+	w = suite.request("POST", "/api/auth/email/verify", "", models.VerifyEmailRequest{Token: suite.mail.lastToken("moved@example.com")})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &verified)
+	assert.Equal(suite.T(), "moved@example.com", verified.Email)
+}
+
+func (suite *E2ETestSuite) TestResendVerificationKeepsEmailChange() {
+	user := suite.register("pending", "pending@example.com")
+
+	w := suite.request("PUT", "/api/auth/email", user.Token, models.ChangeEmailRequest{Email: "next@example.com", CurrentPassword: "password123"})
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+	change := suite.mail.lastToken("next@example.com")
+
+	// A new link for the current address leaves the pending change alone
+	w = suite.request("POST", "/api/auth/email/verification", user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	current := suite.mail.lastToken("pending@example.com")
+
+	w = suite.request("POST", "/api/auth/email/verify", "", models.VerifyEmailRequest{Token: change})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var verified models.User
+	json.Unmarshal(w.Body.Bytes(), &verified)
+	assert.Equal(suite.T(), "next@example.com", verified.Email)
+
+	// Links for the previous address no longer change it back
+	w = suite.request("POST", "/api/auth/email/verify", "", models.VerifyEmailRequest{Token: current})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *E2ETestSuite) TestChangePassword() {
+	laptop := suite.register("changer", "changer@example.com")
+
+	w := suite.request("POST", "/api/auth/login", "", models.LoginRequest{Username: "changer", Password: "password123"})
+	var phone models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &phone)
+
+	w = suite.request("PUT", "/api/auth/password", laptop.Token, models.ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "newpassword"})
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w = suite.request("PUT", "/api/auth/password", laptop.Token, models.ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "newpassword"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Other sessions are signed out; the current one stays
+	w = suite.request("GET", "/api/auth/me", phone.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	w = suite.request("GET", "/api/auth/me", laptop.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *E2ETestSuite) TestPasswordlessReauthentication() {
+	user := suite.register("oauthonly", "oauthonly@example.com")
+	ctx := context.Background()
+	_, err := suite.db.Pool.Exec(ctx, "UPDATE users SET password_hash = '' WHERE id = $1", user.User.ID)
+	suite.Require().NoError(err)
+
+	// Without a password, only a recent sign-in allows credential changes
+	_, err = suite.db.Pool.Exec(ctx, "UPDATE sessions SET created_at = NOW() - INTERVAL '1 hour' WHERE user_id = $1", user.User.ID)
+	suite.Require().NoError(err)
+	w := suite.request("PUT", "/api/auth/password", user.Token, models.ChangePasswordRequest{NewPassword: "newpassword"})
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(suite.T(), models.ErrorCodeReauthRequired, resp["code"])
+	w = suite.request("PUT", "/api/auth/email", user.Token, models.ChangeEmailRequest{Email: "stolen@example.com"})
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	_, err = suite.db.Pool.Exec(ctx, "UPDATE sessions SET created_at = NOW() WHERE user_id = $1", user.User.ID)
+	suite.Require().NoError(err)
+	w = suite.request("PUT", "/api/auth/password", user.Token, models.ChangePasswordRequest{NewPassword: "newpassword"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *E2ETestSuite) TestTwoFactor() {
+	user := suite.register("twofactor", "twofactor@example.com")
+
+	w := suite.request("POST", "/api/auth/2fa/setup", user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var setup models.TwoFactorSetupResponse
+	json.Unmarshal(w.Body.Bytes(), &setup)
+
+	code, _ := totp.Code(setup.Secret, time.Now())
+	w = suite.request("POST", "/api/auth/2fa/enable", user.Token, models.TwoFactorCodeRequest{Code: code})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var recovery models.RecoveryCodesResponse
+	json.Unmarshal(w.Body.Bytes(), &recovery)
+	assert.Len(suite.T(), recovery.RecoveryCodes, 10)
+
+	// Login now stops at the second factor
+	w = suite.request("POST", "/api/auth/login", "", models.LoginRequest{Username: "twofactor", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var challenge models.MFAChallengeResponse
+	json.Unmarshal(w.Body.Bytes(), &challenge)
+	assert.True(suite.T(), challenge.MFARequired)
+
+	// The pending token works nowhere else
+	w = suite.request("GET", "/api/auth/me", challenge.MFAToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	// The code used for enrollment cannot be replayed
+	w = suite.request("POST", "/api/auth/2fa/verify", challenge.MFAToken, models.TwoFactorCodeRequest{Code: code})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.request("POST", "/api/auth/2fa/verify", challenge.MFAToken, models.TwoFactorCodeRequest{Code: strings.ToUpper(recovery.RecoveryCodes[0])})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var resp models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	w = suite.request("GET", "/api/auth/me", resp.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Recovery codes work once
+	w = suite.request("POST", "/api/auth/2fa/verify", challenge.MFAToken, models.TwoFactorCodeRequest{Code: recovery.RecoveryCodes[0]})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.request("GET", "/api/auth/2fa", resp.Token, nil)
+	var status models.TwoFactorStatus
+	json.Unmarshal(w.Body.Bytes(), &status)
+	assert.True(suite.T(), status.Enabled)
+	assert.Equal(suite.T(), 9, status.RecoveryCodesRemaining)
+
+	w = suite.request("POST", "/api/auth/2fa/disable", resp.Token, models.DisableTwoFactorRequest{Code: recovery.RecoveryCodes[1], CurrentPassword: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("POST", "/api/auth/login", "", models.LoginRequest{Username: "twofactor", Password: "password123"})
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NotEmpty(suite.T(), resp.Token)
+}
+
+func (suite *E2ETestSuite) TestLoginLockout() {
+	suite.register("guessed", "guessed@example.com")
+
+	for i := 0; i < 3; i++ {
+		w := suite.request("POST", "/api/auth/login", "", models.LoginRequest{Username: "guessed", Password: "wrong"})
+		assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	}
+
+	// Locked out even with the right password, whatever the username's case
+	w := suite.request("POST", "/api/auth/login", "", models.LoginRequest{Username: "Guessed", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(suite.T(), w.Header().Get("Retry-After"))
+
+	// Unknown usernames are locked out the same way
+	for i := 0; i < 3; i++ {
+		w = suite.request("POST", "/api/auth/login", "", models.LoginRequest{Username: "nobody", Password: "wrong"})
+		assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	}
+	w = suite.request("POST", "/api/auth/login", "", models.LoginRequest{Username: "nobody", Password: "wrong"})
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+}
+
+func (suite *E2ETestSuite) TestPostgresStoreLockout() {
+	ctx := context.Background()
+	store := ratelimit.NewPostgresStore(suite.db)
+	lockout := ratelimit.Lockout{MaxFailures: 3, Window: 10 * time.Minute, Duration: 15 * time.Minute}
+	suite.Require().NoError(store.Reset(ctx, "login:alice"))
+	suite.Require().NoError(store.Reset(ctx, "login:bob"))
+
+	for i := 0; i < 2; i++ {
+		locked, err := store.Fail(ctx, "login:alice", lockout)
+		suite.Require().NoError(err)
+		assert.Zero(suite.T(), locked)
+	}
+
+	// The failure reaching the limit locks the key
+	locked, err := store.Fail(ctx, "login:alice", lockout)
+	suite.Require().NoError(err)
+	assert.InDelta(suite.T(), (15 * time.Minute).Seconds(), locked.Seconds(), 5)
+	locked, err = store.Locked(ctx, "login:alice")
+	suite.Require().NoError(err)
+	assert.InDelta(suite.T(), (15 * time.Minute).Seconds(), locked.Seconds(), 5)
+
+	// Failures while locked keep the lock
+	locked, err = store.Fail(ctx, "login:alice", lockout)
+	suite.Require().NoError(err)
+	assert.InDelta(suite.T(), (15 * time.Minute).Seconds(), locked.Seconds(), 5)
+
+	locked, err = store.Locked(ctx, "login:bob")
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), locked)
+
+	// A limit of one locks on the first failure
+	locked, err = store.Fail(ctx, "login:bob", ratelimit.Lockout{MaxFailures: 1, Window: time.Minute, Duration: time.Minute})
+	suite.Require().NoError(err)
+	assert.InDelta(suite.T(), time.Minute.Seconds(), locked.Seconds(), 5)
+
+	suite.Require().NoError(store.Reset(ctx, "login:alice"))
+	locked, err = store.Locked(ctx, "login:alice")
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), locked)
+}
+
+func (suite *E2ETestSuite) TestAccessTokens() {
+	user := suite.register("scripter", "scripter@example.com")
+
+	w := suite.request("POST", "/api/projects", user.Token, models.CreateProjectRequest{Name: "CI Project"})
+	var project models.Project
+	json.Unmarshal(w.Body.Bytes(), &project)
+	w = suite.request("POST", "/api/projects", user.Token, models.CreateProjectRequest{Name: "Other Project"})
+	var other models.Project
+	json.Unmarshal(w.Body.Bytes(), &other)
+
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/boards", project.ID), user.Token, models.CreateBoardRequest{Name: "To Do"})
+	var board models.Board
+	json.Unmarshal(w.Body.Bytes(), &board)
+
+	w = suite.request("POST", "/api/auth/tokens", user.Token, models.CreateAccessTokenRequest{Name: "ci", Scopes: []string{"admin"}})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.request("POST", "/api/auth/tokens", user.Token, models.CreateAccessTokenRequest{
+		Name:      "ci",
+		Scopes:    []string{auth.ScopeTasksWrite, auth.ScopeProjectsRead},
+		ProjectID: &project.ID,
+	})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var created models.CreateAccessTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.True(suite.T(), strings.HasPrefix(created.Token, auth.AccessTokenPrefix))
+
+	// The token can do what its scopes allow in its project
+	w = suite.request("POST", fmt.Sprintf("/api/boards/%d/tasks", board.ID), created.Token, models.CreateTaskRequest{Title: "From CI"})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	w = suite.request("GET", "/api/projects", created.Token, nil)
+	var projects []models.Project
+	json.Unmarshal(w.Body.Bytes(), &projects)
+	assert.Len(suite.T(), projects, 1)
+
+	// but nothing beyond them
+	w = suite.request("GET", fmt.Sprintf("/api/projects/%d", other.ID), created.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	w = suite.request("DELETE", fmt.Sprintf("/api/projects/%d", project.ID), created.Token, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w = suite.request("GET", "/api/auth/tokens", created.Token, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	// Revoked tokens stop working
+	w = suite.request("DELETE", fmt.Sprintf("/api/auth/tokens/%d", created.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("GET", "/api/projects", created.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *E2ETestSuite) TestRateLimitHeaders() {
+	user := suite.register("counted", "counted@example.com")
+
+	w := suite.request("GET", "/api/auth/me", user.Token, nil)
+	assert.Equal(suite.T(), "1000", w.Header().Get("X-RateLimit-Limit"))
+	first := w.Header().Get("X-RateLimit-Remaining")
+
+	w = suite.request("GET", "/api/auth/me", user.Token, nil)
+	assert.NotEqual(suite.T(), first, w.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(suite.T(), w.Header().Get("X-RateLimit-Reset"))
+}
+
+func (suite *E2ETestSuite) TestCookieAuth() {
+	cfg := &config.Config{JWTSecret: "test-secret-key", AuthMode: "cookie", CookieSecure: true}
+	keys := jwks.NewHMAC(cfg.JWTSecret)
+	sessions := auth.NewSessions(suite.db)
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(),
+		ratelimit.Limit{Requests: 100, Per: time.Minute},
+		ratelimit.Limit{Requests: 100, Per: time.Minute},
+		ratelimit.Lockout{MaxFailures: 5, Window: time.Minute, Duration: time.Minute})
+	authHandler := handlers.NewAuthHandler(suite.db, cfg, oauth.NewRegistry(), sessions, suite.mail, limiter, keys)
+	sessionHandler := handlers.NewSessionHandler(sessions, cfg)
+	projectHandler := handlers.NewProjectHandler(suite.db, cfg)
+
+	router := gin.New()
+	api := router.Group("/api", middleware.CSRFMiddleware())
+	api.POST("/auth/register", authHandler.Register)
+	api.POST("/auth/refresh", authHandler.Refresh)
+	protected := api.Group("", middleware.AuthMiddleware(cfg, keys, sessions, auth.NewAccessTokens(suite.db)))
+	protected.GET("/auth/me", authHandler.Me)
+	protected.POST("/auth/logout", sessionHandler.Logout)
+	protected.POST("/projects", projectHandler.Create)
+
+	cookies := map[string]string{}
+	send := func(method, path, csrf string, payload interface{}) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		if payload != nil {
+			json.NewEncoder(&body).Encode(payload)
+		}
+		req := httptest.NewRequest(method, path, &body)
+		req.Header.Set("Content-Type", "application/json")
+		if csrf != "" {
+			req.Header.Set("X-CSRF-Token", csrf)
+		}
+		for name, value := range cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		for _, cookie := range w.Result().Cookies() {
+			assert.True(suite.T(), cookie.Secure)
+			if cookie.MaxAge < 0 {
+				delete(cookies, cookie.Name)
+			} else {
+				cookies[cookie.Name] = cookie.Value
+			}
+		}
+		return w
+	}
+
+	w := send("POST", "/api/auth/register", "", models.RegisterRequest{Username: "baker", Email: "baker@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var resp models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	// Tokens only travel in HttpOnly cookies
+	assert.Empty(suite.T(), resp.Token)
+	assert.Empty(suite.T(), resp.RefreshToken)
+	assert.Equal(suite.T(), cookies[auth.CSRFCookie], resp.CSRFToken)
+	for _, cookie := range w.Result().Cookies() {
+		assert.Equal(suite.T(), cookie.Name != auth.CSRFCookie, cookie.HttpOnly, cookie.Name)
+	}
+
+	w = send("GET", "/api/auth/me", "", nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Mutating requests need the CSRF token
+	w = send("POST", "/api/projects", "", models.CreateProjectRequest{Name: "Forged"})
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	w = send("POST", "/api/projects", "wrong", models.CreateProjectRequest{Name: "Forged"})
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	w = send("POST", "/api/projects", resp.CSRFToken, models.CreateProjectRequest{Name: "Baking"})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	// Refreshing reads the refresh token cookie and rotates the CSRF token
+	w = send("POST", "/api/auth/refresh", resp.CSRFToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var refreshed models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	assert.NotEqual(suite.T(), resp.CSRFToken, refreshed.CSRFToken)
+
+	w = send("POST", "/api/auth/logout", refreshed.CSRFToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Empty(suite.T(), cookies)
+
+	w = send("GET", "/api/auth/me", "", nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *E2ETestSuite) TestSubtasksAndChecklists() {
+	user := suite.register("planner", "planner@example.com")
+	project := suite.createProject(user.Token, "Launch")
+	todo := suite.createBoard(user.Token, project.ID, "To Do")
+	doing := suite.createBoard(user.Token, project.ID, "Doing")
+	parent := suite.createTask(user.Token, todo.ID, "Ship it")
+
+	// Subtasks
+	var subtasks [3]models.Task
+	for i, title := range []string{"Write docs", "Tag release", "Announce"} {
+		w := suite.request("POST", fmt.Sprintf("/api/tasks/%d/subtasks", parent.ID), user.Token, models.CreateTaskRequest{Title: title})
+		assert.Equal(suite.T(), http.StatusCreated, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &subtasks[i])
+		assert.Equal(suite.T(), parent.ID, *subtasks[i].ParentTaskID)
+		assert.Equal(suite.T(), todo.ID, subtasks[i].BoardID)
+	}
+
+	w := suite.request("POST", fmt.Sprintf("/api/tasks/%d/subtasks", subtasks[0].ID), user.Token, models.CreateTaskRequest{Title: "Nested"})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	done := "done"
+	w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d", subtasks[0].ID), user.Token, models.UpdateTaskRequest{Status: &done})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d/subtasks/order", parent.ID), user.Token, models.ReorderRequest{IDs: []int{subtasks[2].ID, subtasks[0].ID}})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d/subtasks/order", parent.ID), user.Token, models.ReorderRequest{IDs: []int{subtasks[2].ID, subtasks[0].ID, subtasks[1].ID}})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var ordered []models.Task
+	json.Unmarshal(w.Body.Bytes(), &ordered)
+	assert.Equal(suite.T(), []string{"Announce", "Write docs", "Tag release"}, []string{ordered[0].Title, ordered[1].Title, ordered[2].Title})
+
+	// Checklist
+	var items [2]models.ChecklistItem
+	for i, text := range []string{"Changelog", "Screenshots"} {
+		w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/checklist", parent.ID), user.Token, models.CreateChecklistItemRequest{Text: text})
+		assert.Equal(suite.T(), http.StatusCreated, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &items[i])
+		assert.Equal(suite.T(), i, items[i].Position)
+	}
+
+	checked := true
+	w = suite.request("PUT", fmt.Sprintf("/api/checklist-items/%d", items[1].ID), user.Token, models.UpdateChecklistItemRequest{Done: &checked})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d/checklist/order", parent.ID), user.Token, models.ReorderRequest{IDs: []int{items[1].ID, items[0].ID}})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", parent.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var task models.Task
+	json.Unmarshal(w.Body.Bytes(), &task)
+	assert.Equal(suite.T(), models.TaskProgress{ChecklistDone: 1, ChecklistTotal: 2, SubtasksDone: 1, SubtasksTotal: 3, Percent: 40}, task.Progress)
+	assert.Equal(suite.T(), "Screenshots", task.Checklist[0].Text)
+	assert.Len(suite.T(), task.Subtasks, 3)
+
+	var history []models.TaskHistory
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d/history", parent.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &history)
+	actions := []string{}
+	for _, entry := range history {
+		actions = append(actions, entry.Action)
+	}
+	assert.Subset(suite.T(), actions, []string{"subtask_added", "subtasks_reordered", "checklist_item_added", "checklist_item_updated", "checklist_reordered"})
+
+	// Subtasks on the parent's board move with it
+	w = suite.request("PATCH", fmt.Sprintf("/api/tasks/%d/move", subtasks[1].ID), user.Token, models.MoveTaskRequest{BoardID: doing.ID})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	shipped := suite.createBoard(user.Token, project.ID, "Done")
+	w = suite.request("PATCH", fmt.Sprintf("/api/tasks/%d/move", parent.ID), user.Token, models.MoveTaskRequest{BoardID: shipped.ID})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d/subtasks", parent.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &ordered)
+	boards := map[string]int{}
+	for _, subtask := range ordered {
+		boards[subtask.Title] = subtask.BoardID
+	}
+	assert.Equal(suite.T(), map[string]int{"Announce": shipped.ID, "Write docs": shipped.ID, "Tag release": doing.ID}, boards)
+
+	// Deleting the parent deletes its subtasks and checklist
+	w = suite.request("DELETE", fmt.Sprintf("/api/tasks/%d", parent.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", subtasks[1].ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	w = suite.request("DELETE", fmt.Sprintf("/api/checklist-items/%d", items[0].ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *E2ETestSuite) TestTaskDependencies() {
+	user := suite.register("scheduler", "scheduler@example.com")
+	project := suite.createProject(user.Token, "Release")
+	todo := suite.createBoard(user.Token, project.ID, "To Do")
+	review := suite.createBoard(user.Token, project.ID, "Review")
+	design := suite.createTask(user.Token, todo.ID, "Design")
+	build := suite.createTask(user.Token, todo.ID, "Build")
+	test := suite.createTask(user.Token, review.ID, "Test")
+	docs := suite.createTask(user.Token, review.ID, "Docs")
+
+	link := func(taskID int, depType string, otherID int) *httptest.ResponseRecorder {
+		return suite.request("POST", fmt.Sprintf("/api/tasks/%d/dependencies", taskID), user.Token,
+			models.CreateDependencyRequest{Type: depType, TaskID: otherID})
+	}
+
+	assert.Equal(suite.T(), http.StatusCreated, link(design.ID, "blocks", build.ID).Code)
+	assert.Equal(suite.T(), http.StatusCreated, link(test.ID, "blocked_by", build.ID).Code)
+	assert.Equal(suite.T(), http.StatusCreated, link(docs.ID, "relates_to", design.ID).Code)
+	assert.Equal(suite.T(), http.StatusConflict, link(design.ID, "relates_to", docs.ID).Code)
+	assert.Equal(suite.T(), http.StatusBadRequest, link(design.ID, "blocks", design.ID).Code)
+
+	// Closing the chain design -> build -> test into a loop is rejected
+	w := link(test.ID, "blocks", design.ID)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	var cycleErr struct {
+		Code  string `json:"code"`
+		Cycle []int  `json:"cycle"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &cycleErr)
+	assert.Equal(suite.T(), models.ErrorCodeDependencyCycle, cycleErr.Code)
+	assert.Equal(suite.T(), []int{design.ID, build.ID, test.ID, design.ID}, cycleErr.Cycle)
+
+	// Tasks of other projects cannot be linked
+	other := suite.createProject(user.Token, "Other")
+	stranger := suite.createTask(user.Token, suite.createBoard(user.Token, other.ID, "To Do").ID, "Elsewhere")
+	assert.Equal(suite.T(), http.StatusBadRequest, link(design.ID, "blocks", stranger.ID).Code)
+
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", build.ID), user.Token, nil)
+	var task models.Task
+	json.Unmarshal(w.Body.Bytes(), &task)
+	assert.True(suite.T(), task.IsBlocked)
+	assert.Equal(suite.T(), []models.TaskRef{{ID: design.ID, BoardID: todo.ID, Title: "Design", Status: "todo"}}, task.Blockers)
+
+	var deps []models.TaskDependency
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d/dependencies", build.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &deps)
+	assert.Equal(suite.T(), []string{"blocked_by", "blocks"}, []string{deps[0].Type, deps[1].Type})
+
+	w = suite.request("GET", fmt.Sprintf("/api/projects/%d/dependencies", project.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var graph models.DependencyGraph
+	json.Unmarshal(w.Body.Bytes(), &graph)
+	assert.Len(suite.T(), graph.Nodes, 4)
+	assert.Len(suite.T(), graph.Edges, 3)
+	assert.Equal(suite.T(), []int{design.ID, build.ID, test.ID}, graph.CriticalPath)
+
+	// Finishing the blocker unblocks the task
+	status := "done"
+	suite.request("PUT", fmt.Sprintf("/api/tasks/%d", design.ID), user.Token, models.UpdateTaskRequest{Status: &status})
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", build.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &task)
+	assert.False(suite.T(), task.IsBlocked)
+
+	w = suite.request("DELETE", fmt.Sprintf("/api/dependencies/%d", deps[1].ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", test.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &task)
+	assert.False(suite.T(), task.IsBlocked)
+}
+
+func (suite *E2ETestSuite) TestRecurringTasks() {
+	user := suite.register("gardener", "gardener@example.com")
+	project := suite.createProject(user.Token, "Garden")
+	board := suite.createBoard(user.Token, project.ID, "Chores")
+
+	create := func(req models.CreateTaskRequest) *httptest.ResponseRecorder {
+		return suite.request("POST", fmt.Sprintf("/api/boards/%d/tasks", board.ID), user.Token, req)
+	}
+
+	invalid := "FREQ=YEARLY"
+	assert.Equal(suite.T(), http.StatusBadRequest, create(models.CreateTaskRequest{Title: "Prune", RecurrenceRule: &invalid}).Code)
+
+	// A weekly task without a due date is due on the next Monday
+	rule := "freq=weekly;byday=mo"
+	w := create(models.CreateTaskRequest{Title: "Mow", RecurrenceRule: &rule})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var mow models.Task
+	json.Unmarshal(w.Body.Bytes(), &mow)
+	assert.Equal(suite.T(), "FREQ=WEEKLY;BYDAY=MO", *mow.RecurrenceRule)
+	require.NotNil(suite.T(), mow.DueDate)
+	assert.Equal(suite.T(), time.Monday, mow.DueDate.Weekday())
+
+	w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/checklist", mow.ID), user.Token,
+		models.CreateChecklistItemRequest{Text: "Empty the bag", Done: true})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	status := "done"
+	w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d", mow.ID), user.Token, models.UpdateTaskRequest{Status: &status})
+	json.Unmarshal(w.Body.Bytes(), &mow)
+	assert.NotNil(suite.T(), mow.CompletedAt)
+
+	scheduler := recurrence.NewScheduler(suite.db, time.Minute, 0)
+	created, err := scheduler.RunOnce(context.Background())
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, created)
+
+	// The rule moves to the next instance, a week later with the checklist reset
+	var history []models.TaskHistory
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d/history", mow.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &history)
+	nextID := 0
+	for _, entry := range history {
+		if entry.Action == "recurrence_continued" {
+			nextID = int(entry.ChangesJSON["next_task_id"].(float64))
+		}
+	}
+	require.NotZero(suite.T(), nextID)
+
+	var next models.Task
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", nextID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &next)
+	assert.Equal(suite.T(), "Mow", next.Title)
+	assert.Equal(suite.T(), "todo", next.Status)
+	assert.Equal(suite.T(), mow.ID, *next.RecursFromTaskID)
+	assert.Equal(suite.T(), "FREQ=WEEKLY;BYDAY=MO", *next.RecurrenceRule)
+	assert.Equal(suite.T(), mow.DueDate.AddDate(0, 0, 7), *next.DueDate)
+	require.Len(suite.T(), next.Checklist, 1)
+	assert.False(suite.T(), next.Checklist[0].Done)
+
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", mow.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &mow)
+	assert.Nil(suite.T(), mow.RecurrenceRule)
+
+	created, _ = scheduler.RunOnce(context.Background())
+	assert.Equal(suite.T(), 0, created)
+
+	// Recurrence edits are recorded in the history
+	none := ""
+	w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d", nextID), user.Token, models.UpdateTaskRequest{RecurrenceRule: &none})
+	json.Unmarshal(w.Body.Bytes(), &next)
+	assert.Nil(suite.T(), next.RecurrenceRule)
+
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d/history", nextID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &history)
+	assert.Equal(suite.T(), "recurrence_updated", history[0].Action)
+	assert.Equal(suite.T(), "FREQ=WEEKLY;BYDAY=MO", history[0].ChangesJSON["previous_rule"])
+}
+
+func (suite *E2ETestSuite) TestCustomFields() {
+	user := suite.register("support", "support@example.com")
+	project := suite.createProject(user.Token, "Support")
+	board := suite.createBoard(user.Token, project.ID, "Inbox")
+
+	define := func(req models.CreateCustomFieldRequest) models.CustomField {
+		w := suite.request("POST", fmt.Sprintf("/api/projects/%d/custom-fields", project.ID), user.Token, req)
+		assert.Equal(suite.T(), http.StatusCreated, w.Code)
+		var field models.CustomField
+		json.Unmarshal(w.Body.Bytes(), &field)
+		return field
+	}
+
+	customer := define(models.CreateCustomFieldRequest{Name: "Customer", Type: "text"})
+	points := define(models.CreateCustomFieldRequest{Name: "Story points", Type: "number"})
+	envs := define(models.CreateCustomFieldRequest{Name: "Environments", Type: "multi_select", Options: []string{"dev", "staging", "prod"}})
+	assert.Equal(suite.T(), 2, envs.Position)
+
+	w := suite.request("POST", fmt.Sprintf("/api/projects/%d/custom-fields", project.ID), user.Token,
+		models.CreateCustomFieldRequest{Name: "Customer", Type: "url"})
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/custom-fields", project.ID), user.Token,
+		models.CreateCustomFieldRequest{Name: "Severity", Type: "single_select"})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	values := func(pairs ...interface{}) map[int]json.RawMessage {
+		out := map[int]json.RawMessage{}
+		for i := 0; i < len(pairs); i += 2 {
+			out[pairs[i].(int)] = json.RawMessage(pairs[i+1].(string))
+		}
+		return out
+	}
+
+	w = suite.request("POST", fmt.Sprintf("/api/boards/%d/tasks", board.ID), user.Token, models.CreateTaskRequest{
+		Title:        "Login fails",
+		CustomFields: values(customer.ID, `"Acme"`, points.ID, `5`, envs.ID, `["prod", "dev"]`),
+	})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var task models.Task
+	json.Unmarshal(w.Body.Bytes(), &task)
+	other := suite.createTask(user.Token, board.ID, "Typo")
+
+	// Invalid values and fields of other projects are rejected
+	update := func(taskID int, fields map[int]json.RawMessage) *httptest.ResponseRecorder {
+		return suite.request("PUT", fmt.Sprintf("/api/tasks/%d", taskID), user.Token, models.UpdateTaskRequest{CustomFields: fields})
+	}
+	assert.Equal(suite.T(), http.StatusBadRequest, update(other.ID, values(points.ID, `"five"`)).Code)
+	assert.Equal(suite.T(), http.StatusBadRequest, update(other.ID, values(envs.ID, `["qa"]`)).Code)
+	assert.Equal(suite.T(), http.StatusBadRequest, update(other.ID, values(999999, `1`)).Code)
+	assert.Equal(suite.T(), http.StatusOK, update(other.ID, values(points.ID, `1`)).Code)
+
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", task.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &task)
+	assert.Equal(suite.T(), map[int]interface{}{
+		customer.ID: "Acme",
+		points.ID:   5.0,
+		envs.ID:     []interface{}{"dev", "prod"},
+	}, task.CustomFields)
+
+	// Filters
+	filter := func(query string) []int {
+		w := suite.request("GET", fmt.Sprintf("/api/boards/%d/tasks?%s", board.ID, query), user.Token, nil)
+		assert.Equal(suite.T(), http.StatusOK, w.Code, query)
+		var page models.TaskPage
+		json.Unmarshal(w.Body.Bytes(), &page)
+		ids := []int{}
+		for _, t := range page.Tasks {
+			ids = append(ids, t.ID)
+		}
+		return ids
+	}
+	assert.Equal(suite.T(), []int{task.ID}, filter(fmt.Sprintf("cf.%d[gt]=2", points.ID)))
+	assert.Equal(suite.T(), []int{task.ID}, filter(fmt.Sprintf("cf.%d=prod", envs.ID)))
+	assert.Equal(suite.T(), []int{other.ID}, filter(fmt.Sprintf("cf.%d[null]=true", customer.ID)))
+	w = suite.request("GET", fmt.Sprintf("/api/boards/%d/tasks?cf.%d[gt]=a", board.ID, customer.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// Changes are recorded in the history
+	assert.Equal(suite.T(), http.StatusOK, update(task.ID, values(customer.ID, `null`, points.ID, `5`)).Code)
+	var history []models.TaskHistory
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d/history", task.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &history)
+	assert.Equal(suite.T(), map[string]interface{}{"Customer": nil}, history[0].ChangesJSON["custom_fields"])
+
+	// Removing an option clears it from tasks
+	w = suite.request("PUT", fmt.Sprintf("/api/custom-fields/%d", envs.ID), user.Token,
+		models.UpdateCustomFieldRequest{Options: []string{"dev", "staging"}})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", task.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &task)
+	assert.Equal(suite.T(), []interface{}{"dev"}, task.CustomFields[envs.ID])
+}
+
+func (suite *E2ETestSuite) TestWorkflow() {
+	user := suite.register("flow", "flow@example.com")
+	project := suite.createProject(user.Token, "Releases")
+
+	// Projects start with the default statuses
+	var flow models.Workflow
+	w := suite.request("GET", fmt.Sprintf("/api/projects/%d/workflow", project.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &flow)
+	require.Len(suite.T(), flow.Statuses, 3)
+	assert.Equal(suite.T(), "todo", flow.Statuses[0].Key)
+	assert.Empty(suite.T(), flow.Transitions)
+
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/statuses", project.ID), user.Token,
+		models.CreateStatusRequest{Key: "review", Name: "In Review", Category: models.StatusCategoryInProgress})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var review models.ProjectStatus
+	json.Unmarshal(w.Body.Bytes(), &review)
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/statuses", project.ID), user.Token,
+		models.CreateStatusRequest{Key: "review", Name: "Review", Category: models.StatusCategoryInProgress})
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	w = suite.request("PUT", fmt.Sprintf("/api/projects/%d/transitions", project.ID), user.Token,
+		models.UpdateTransitionsRequest{Transitions: []models.StatusTransition{
+			{From: "todo", To: "in_progress"},
+			{From: "in_progress", To: "review"},
+			{From: "review", To: "in_progress"},
+			{From: "review", To: "done"},
+		}})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Boards mapped to a status set it on tasks created in or moved to them
+	doneStatus := flow.Statuses[2]
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/boards", project.ID), user.Token,
+		models.CreateBoardRequest{Name: "Shipped", StatusID: &doneStatus.ID})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var shipped models.Board
+	json.Unmarshal(w.Body.Bytes(), &shipped)
+	backlog := suite.createBoard(user.Token, project.ID, "Backlog")
+
+	task := suite.createTask(user.Token, backlog.ID, "Release notes")
+	assert.Equal(suite.T(), "todo", task.Status)
+
+	// Transitions outside the workflow are rejected
+	w = suite.request("PATCH", fmt.Sprintf("/api/tasks/%d/move", task.ID), user.Token,
+		models.MoveTaskRequest{BoardID: shipped.ID})
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	var conflict map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	assert.Equal(suite.T(), models.ErrorCodeInvalidTransition, conflict["code"])
+	assert.Equal(suite.T(), []interface{}{"in_progress"}, conflict["allowed"])
+
+	status := "shipped"
+	w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d", task.ID), user.Token, models.UpdateTaskRequest{Status: &status})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	for _, status := range []string{"in_progress", "review"} {
+		w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d", task.ID), user.Token, models.UpdateTaskRequest{Status: &status})
+		assert.Equal(suite.T(), http.StatusOK, w.Code)
+	}
+	w = suite.request("PATCH", fmt.Sprintf("/api/tasks/%d/move", task.ID), user.Token,
+		models.MoveTaskRequest{BoardID: shipped.ID})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &task)
+	assert.Equal(suite.T(), "done", task.Status)
+	assert.NotNil(suite.T(), task.CompletedAt)
+
+	w = suite.request("GET", fmt.Sprintf("/api/projects/%d/tasks?status_category=done", project.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Statuses in use cannot be deleted
+	w = suite.request("DELETE", fmt.Sprintf("/api/statuses/%d", doneStatus.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	w = suite.request("DELETE", fmt.Sprintf("/api/statuses/%d", review.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Recategorizing a status finishes its tasks, except recurring ones
+	plain := suite.createTask(user.Token, backlog.ID, "Changelog")
+	rule := "FREQ=DAILY"
+	w = suite.request("POST", fmt.Sprintf("/api/boards/%d/tasks", backlog.ID), user.Token,
+		models.CreateTaskRequest{Title: "Nightly build", RecurrenceRule: &rule})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var nightly models.Task
+	json.Unmarshal(w.Body.Bytes(), &nightly)
+
+	done := models.StatusCategoryDone
+	w = suite.request("PUT", fmt.Sprintf("/api/statuses/%d", flow.Statuses[0].ID), user.Token, models.UpdateStatusRequest{Category: &done})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", plain.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &plain)
+	assert.NotNil(suite.T(), plain.CompletedAt)
+	var history []models.TaskHistory
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d/history", plain.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &history)
+	assert.Equal(suite.T(), "status_recategorized", history[0].Action)
+
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", nightly.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &nightly)
+	assert.Nil(suite.T(), nightly.CompletedAt)
+}
+
+func (suite *E2ETestSuite) TestPriorities() {
+	user := suite.register("ranker", "ranker@example.com")
+	project := suite.createProject(user.Token, "Triage")
+	board := suite.createBoard(user.Token, project.ID, "Inbox")
+
+	var priorities []models.ProjectPriority
+	w := suite.request("GET", fmt.Sprintf("/api/projects/%d/priorities", project.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &priorities)
+	require.Len(suite.T(), priorities, 4)
+	assert.Equal(suite.T(), "low", priorities[0].Key)
+	assert.True(suite.T(), priorities[1].IsDefault)
+
+	// New tasks get the default priority and unknown priorities are rejected
+	task := suite.createTask(user.Token, board.ID, "Crash on start")
+	assert.Equal(suite.T(), "medium", task.Priority)
+	w = suite.request("POST", fmt.Sprintf("/api/boards/%d/tasks", board.ID), user.Token,
+		models.CreateTaskRequest{Title: "Typo", Priority: "hgih"})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// A new priority can become the default
+	w = suite.request("POST", fmt.Sprintf("/api/projects/%d/priorities", project.ID), user.Token,
+		models.CreatePriorityRequest{Key: "p0", Name: "P0", Color: "#000000", IsDefault: true})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var p0 models.ProjectPriority
+	json.Unmarshal(w.Body.Bytes(), &p0)
+	assert.Equal(suite.T(), 4, p0.Rank)
+	assert.Equal(suite.T(), "p0", suite.createTask(user.Token, board.ID, "Outage").Priority)
+	w = suite.request("DELETE", fmt.Sprintf("/api/priorities/%d", p0.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	low := "low"
+	w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d", task.ID), user.Token, models.UpdateTaskRequest{Priority: &low})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Priorities sort by rank
+	w = suite.request("GET", fmt.Sprintf("/api/boards/%d/tasks?sort=-priority", board.ID), user.Token, nil)
+	var page models.TaskPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	require.Len(suite.T(), page.Tasks, 2)
+	assert.Equal(suite.T(), "p0", page.Tasks[0].Priority)
+	assert.Equal(suite.T(), "low", page.Tasks[1].Priority)
+}
+
+func (suite *E2ETestSuite) TestTimeTracking() {
+	user := suite.register("billable", "billable@example.com")
+	project := suite.createProject(user.Token, "Client work")
+	board := suite.createBoard(user.Token, project.ID, "Sprint")
+	task := suite.createTask(user.Token, board.ID, "Integrate payments")
+	other := suite.createTask(user.Token, board.ID, "Fix invoice totals")
+
+	// Time logged by hand, with an end or a duration
+	start := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	end := start.Add(90 * time.Minute)
+	w := suite.request("POST", fmt.Sprintf("/api/tasks/%d/time-entries", task.ID), user.Token,
+		models.CreateTimeEntryRequest{StartedAt: start, EndedAt: &end})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var entry models.TimeEntry
+	json.Unmarshal(w.Body.Bytes(), &entry)
+	assert.Equal(suite.T(), 5400, entry.DurationSeconds)
+
+	duration := 1800
+	w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/time-entries", other.ID), user.Token,
+		models.CreateTimeEntryRequest{StartedAt: start.AddDate(0, 0, 1), DurationSeconds: &duration})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/time-entries", task.ID), user.Token,
+		models.CreateTimeEntryRequest{StartedAt: start, EndedAt: &start})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// Entries logged by hand last at most a day
+	tooLong := 86401
+	w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/time-entries", task.ID), user.Token,
+		models.CreateTimeEntryRequest{StartedAt: start, DurationSeconds: &tooLong})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	farEnd := start.AddDate(100, 0, 0)
+	w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/time-entries", task.ID), user.Token,
+		models.CreateTimeEntryRequest{StartedAt: start, EndedAt: &farEnd})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// One running timer per user
+	w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/timer/start", task.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/timer/start", other.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	var conflict map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	assert.Equal(suite.T(), models.ErrorCodeTimerRunning, conflict["code"])
+
+	w = suite.request("GET", "/api/timer", user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var running models.TimeEntry
+	json.Unmarshal(w.Body.Bytes(), &running)
+
+	// A running timer cannot be moved to start in the future
+	future := time.Now().Add(time.Hour)
+	w = suite.request("PUT", fmt.Sprintf("/api/time-entries/%d", running.ID), user.Token,
+		models.UpdateTimeEntryRequest{StartedAt: &future})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/timer/stop", task.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &entry)
+	assert.NotNil(suite.T(), entry.EndedAt)
+	w = suite.request("GET", "/api/timer", user.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	// Task payloads include the total
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d", task.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &task)
+	assert.GreaterOrEqual(suite.T(), task.TimeSpentSeconds, 5400)
+
+	// Timesheets add up time per day, user and task
+	w = suite.request("GET", "/api/timesheet?from=2025-03-01&to=2025-03-31", user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var sheet models.Timesheet
+	json.Unmarshal(w.Body.Bytes(), &sheet)
+	require.Len(suite.T(), sheet.Rows, 2)
+	assert.Equal(suite.T(), 1.5, sheet.Rows[0].Hours)
+	assert.Equal(suite.T(), int64(7200), sheet.TotalSeconds)
+	require.Len(suite.T(), sheet.Totals, 1)
+
+	w = suite.request("GET", "/api/timesheet?from=2025-03-01&to=2025-03-31&format=csv", user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(),
+		"date,user,project,task_id,task,hours\n"+
+			fmt.Sprintf("2025-03-03,billable,Client work,%d,Integrate payments,1.50\n", task.ID)+
+			fmt.Sprintf("2025-03-04,billable,Client work,%d,Fix invoice totals,0.50\n", other.ID),
+		w.Body.String())
+
+	w = suite.request("GET", "/api/timesheet?from=2025-03-31&to=2025-03-01", user.Token, nil)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// Times sent with an offset are stored in UTC, and counted on the UTC day
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	localStart := time.Date(2025, 4, 1, 5, 0, 0, 0, jakarta)
+	localEnd := localStart.Add(30 * time.Minute)
+	w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/time-entries", task.ID), user.Token,
+		models.CreateTimeEntryRequest{StartedAt: localStart, EndedAt: &localEnd})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &entry)
+	assert.True(suite.T(), localStart.Equal(entry.StartedAt), entry.StartedAt)
+	assert.Equal(suite.T(), 1800, entry.DurationSeconds)
+
+	w = suite.request("GET", "/api/timesheet?from=2025-03-31&to=2025-03-31", user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &sheet)
+	require.Len(suite.T(), sheet.Rows, 1)
+	assert.Equal(suite.T(), int64(1800), sheet.Rows[0].Seconds)
+	w = suite.request("GET", "/api/timesheet?from=2025-04-01&to=2025-04-30", user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &sheet)
+	assert.Empty(suite.T(), sheet.Rows)
+}
+
+func (suite *E2ETestSuite) TestEstimates() {
+	user := suite.register("planner", "planner@example.com")
+	project := suite.createProject(user.Token, "Estimated")
+	assert.Equal(suite.T(), models.EstimateUnitHours, project.EstimateUnit)
+	backlog := suite.createBoard(user.Token, project.ID, "Backlog")
+	doing := suite.createBoard(user.Token, project.ID, "Doing")
+
+	// The remaining estimate starts at the original one
+	original := 8.0
+	w := suite.request("POST", fmt.Sprintf("/api/boards/%d/tasks", doing.ID), user.Token,
+		models.CreateTaskRequest{Title: "Build importer", AssigneeID: &user.User.ID, OriginalEstimate: &original})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var task models.Task
+	json.Unmarshal(w.Body.Bytes(), &task)
+	require.NotNil(suite.T(), task.RemainingEstimate)
+	assert.Equal(suite.T(), 8.0, *task.RemainingEstimate)
+	suite.createTask(user.Token, backlog.ID, "Write docs")
+
+	negative := -1.0
+	w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d", task.ID), user.Token, models.UpdateTaskRequest{RemainingEstimate: &negative})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// Estimate changes get their own history entry
+	remaining := 3.5
+	w = suite.request("PUT", fmt.Sprintf("/api/tasks/%d", task.ID), user.Token, models.UpdateTaskRequest{RemainingEstimate: &remaining})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var history []models.TaskHistory
+	w = suite.request("GET", fmt.Sprintf("/api/tasks/%d/history", task.ID), user.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &history)
+	var changes map[string]interface{}
+	for _, entry := range history {
+		if entry.Action == "estimate_updated" {
+			changes = entry.ChangesJSON
+		}
+	}
+	require.NotNil(suite.T(), changes)
+	assert.Equal(suite.T(), 8.0, changes["previous_remaining_estimate"])
+	assert.Equal(suite.T(), 3.5, changes["remaining_estimate"])
+	assert.Equal(suite.T(), 8.0, changes["original_estimate"])
+
+	duration := 5400
+	w = suite.request("POST", fmt.Sprintf("/api/tasks/%d/time-entries", task.ID), user.Token,
+		models.CreateTimeEntryRequest{StartedAt: time.Now().Add(-2 * time.Hour), DurationSeconds: &duration})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	// Rollups compare estimates with logged time
+	w = suite.request("GET", fmt.Sprintf("/api/projects/%d/estimates", project.ID), user.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var report models.EstimateReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	assert.Equal(suite.T(), models.EstimateUnitHours, report.Unit)
+	assert.Equal(suite.T(), models.EstimateRollup{
+		TaskCount: 2, EstimatedTaskCount: 1, OriginalEstimate: 8, RemainingEstimate: 3.5, SpentSeconds: 5400, SpentHours: 1.5,
+	}, report.Total)
+	require.Len(suite.T(), report.Boards, 2)
+	assert.Equal(suite.T(), backlog.ID, report.Boards[0].BoardID)
+	assert.Equal(suite.T(), 0.0, report.Boards[0].OriginalEstimate)
+	assert.Equal(suite.T(), 8.0, report.Boards[1].OriginalEstimate)
+	require.Len(suite.T(), report.Assignees, 2)
+	assert.Equal(suite.T(), user.User.ID, *report.Assignees[0].AssigneeID)
+	assert.Equal(suite.T(), 1.5, report.Assignees[0].SpentHours)
+	assert.Nil(suite.T(), report.Assignees[1].AssigneeID)
+
+	// Estimates are not converted, so the unit is fixed while tasks have one
+	unit := models.EstimateUnitPoints
+	w = suite.request("PUT", fmt.Sprintf("/api/projects/%d", project.ID), user.Token, models.UpdateProjectRequest{EstimateUnit: &unit})
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	// Projects can estimate in points instead
+	sprint := suite.createProject(user.Token, "Sprint")
+	w = suite.request("PUT", fmt.Sprintf("/api/projects/%d", sprint.ID), user.Token, models.UpdateProjectRequest{EstimateUnit: &unit})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &sprint)
+	assert.Equal(suite.T(), models.EstimateUnitPoints, sprint.EstimateUnit)
+	unit = "days"
+	w = suite.request("PUT", fmt.Sprintf("/api/projects/%d", sprint.ID), user.Token, models.UpdateProjectRequest{EstimateUnit: &unit})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// A unit change waits for estimates being written in the project and
+	// then refuses to relabel them
+	ctx := context.Background()
+	board := suite.createBoard(user.Token, sprint.ID, "Sprint 1")
+	tx, err := suite.db.Pool.Begin(ctx)
+	require.NoError(suite.T(), err)
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, "SELECT 1 FROM projects WHERE id = $1 FOR SHARE", sprint.ID)
+	require.NoError(suite.T(), err)
+	_, err = tx.Exec(ctx, "INSERT INTO tasks (board_id, title, original_estimate, remaining_estimate) VALUES ($1, 'Spike', 3, 3)", board.ID)
+	require.NoError(suite.T(), err)
+
+	unit = models.EstimateUnitHours
+	done := make(chan int)
+	go func() {
+		w := suite.request("PUT", fmt.Sprintf("/api/projects/%d", sprint.ID), user.Token, models.UpdateProjectRequest{EstimateUnit: &unit})
+		done <- w.Code
+	}()
+	select {
+	case <-done:
+		suite.T().Fatal("the unit changed while an estimate was being written")
+	case <-time.After(200 * time.Millisecond):
+	}
+	require.NoError(suite.T(), tx.Commit(ctx))
+	assert.Equal(suite.T(), http.StatusConflict, <-done)
+}
+
+func (suite *E2ETestSuite) createProject(token, name string) models.Project {
+	w := suite.request("POST", "/api/projects", token, models.CreateProjectRequest{Name: name})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	var project models.Project
+	json.Unmarshal(w.Body.Bytes(), &project)
+	return project
+}
+
+func (suite *E2ETestSuite) createBoard(token string, projectID int, name string) models.Board {
+	w := suite.request("POST", fmt.Sprintf("/api/projects/%d/boards", projectID), token, models.CreateBoardRequest{Name: name})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	var board models.Board
+	json.Unmarshal(w.Body.Bytes(), &board)
+	return board
+}
+
+func (suite *E2ETestSuite) createTask(token string, boardID int, title string) models.Task {
+	w := suite.request("POST", fmt.Sprintf("/api/boards/%d/tasks", boardID), token, models.CreateTaskRequest{Title: title})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	var task models.Task
+	json.Unmarshal(w.Body.Bytes(), &task)
+	return task
+}
+
+// register creates a user through the API and returns the auth response.
+func (suite *E2ETestSuite) register(username, email string) models.AuthResponse {
+	w := suite.request("POST", "/api/auth/register", "", models.RegisterRequest{
+		Username: username,
+		Email:    email,
+		Password: "password123",
+	})
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	var authResp models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &authResp)
+	return authResp
+}
+
+// request sends a JSON request through the router, authenticated when a
+// token is given.
+func (suite *E2ETestSuite) request(method, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	if payload != nil {
+		json.NewEncoder(&body).Encode(payload)
+	}
+
+	req := httptest.NewRequest(method, path, &body)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
 func TestE2ETestSuite(t *testing.T) {
 	suite.Run(t, new(E2ETestSuite))
 }
@@ -1,20 +1,33 @@
 import axios from 'axios'
 import { useAuthStore } from '@/stores/auth'
 
+// In the cookie auth mode the API keeps the tokens in HttpOnly cookies, and
+// mutating requests echo the CSRF token in a header
+export const cookieMode = import.meta.env.VITE_AUTH_MODE === 'cookie'
+
+const safeMethods = ['get', 'head', 'options']
+
 const apiClient = axios.create({
   baseURL: import.meta.env.VITE_API_URL || 'http://localhost:8080/api',
   headers: {
     'Content-Type': 'application/json',
   },
+  withCredentials: cookieMode,
 })
 
-// Request interceptor to add auth token
+// Request interceptor to add auth token, or the CSRF token in cookie mode
 apiClient.interceptors.request.use(
-  (config) => {
+  async (config) => {
     const authStore = useAuthStore()
     if (authStore.token) {
       config.headers.Authorization = `Bearer ${authStore.token}`
     }
+    if (cookieMode && authStore.isAuthenticated && !safeMethods.includes((config.method || 'get').toLowerCase())) {
+      const csrfToken = await authStore.ensureCsrfToken()
+      if (csrfToken) {
+        config.headers['X-CSRF-Token'] = csrfToken
+      }
+    }
     return config
   },
   (error) => {
@@ -22,12 +35,26 @@ apiClient.interceptors.request.use(
   }
 )
 
-// Response interceptor to handle errors
+// Concurrent 401s share a single refresh request, since every refresh token
+// can only be used once
+let refreshRequest = null
+
+// Response interceptor to refresh expired tokens and handle errors
 apiClient.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const original = error.config
     if (error.response?.status === 401) {
       const authStore = useAuthStore()
+      if ((authStore.refreshToken || (cookieMode && authStore.isAuthenticated)) && original && !original._retry && original.url !== '/auth/refresh') {
+        original._retry = true
+        refreshRequest = refreshRequest || authStore.refresh().finally(() => {
+          refreshRequest = null
+        })
+        if (await refreshRequest) {
+          return apiClient(original)
+        }
+      }
       authStore.logout()
       window.location.href = '/login'
     }
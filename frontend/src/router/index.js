@@ -22,6 +22,18 @@ const router = createRouter({
       component: () => import('@/views/AuthCallbackView.vue'),
       meta: { requiresAuth: false },
     },
+    {
+      path: '/reset-password',
+      name: 'reset-password',
+      component: () => import('@/views/ResetPasswordView.vue'),
+      meta: { requiresAuth: false },
+    },
+    {
+      path: '/verify-email',
+      name: 'verify-email',
+      component: () => import('@/views/VerifyEmailView.vue'),
+      meta: { requiresAuth: false, allowAuthenticated: true },
+    },
     {
       path: '/',
       name: 'dashboard',
@@ -46,7 +58,7 @@ router.beforeEach((to, from, next) => {
   
   if (to.meta.requiresAuth && !authStore.isAuthenticated) {
     next('/login')
-  } else if (!to.meta.requiresAuth && authStore.isAuthenticated && to.name !== 'auth-callback') {
+  } else if (!to.meta.requiresAuth && authStore.isAuthenticated && to.name !== 'auth-callback' && !to.meta.allowAuthenticated) {
     next('/')
   } else {
     next()
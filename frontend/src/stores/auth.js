@@ -1,19 +1,24 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
-import apiClient from '@/api/client'
+import apiClient, { cookieMode } from '@/api/client'
 
 export const useAuthStore = defineStore('auth', () => {
   const user = ref(null)
   const token = ref(localStorage.getItem('token') || '')
   const refreshToken = ref(localStorage.getItem('refreshToken') || '')
+  // mfaToken is held between the password step and the two-factor step
+  const mfaToken = ref('')
+  // In cookie mode the tokens never reach JavaScript; signedIn remembers that
+  // the cookies were set, and csrfToken is echoed on mutating requests
+  const signedIn = ref(cookieMode && localStorage.getItem('signedIn') === 'true')
+  const csrfToken = ref('')
 
-  const isAuthenticated = computed(() => !!token.value)
+  const isAuthenticated = computed(() => !!token.value || signedIn.value)
 
   async function login(credentials) {
     try {
       const response = await apiClient.post('/auth/login', credentials)
-      setAuthData(response.data)
-      return { success: true }
+      return signIn(response.data)
     } catch (error) {
       return { success: false, error: error.response?.data?.error || 'Login failed' }
     }
@@ -38,52 +43,170 @@ export const useAuthStore = defineStore('auth', () => {
     }
   }
 
+  async function refresh() {
+    try {
+      const body = cookieMode ? {} : { refresh_token: refreshToken.value }
+      const response = await apiClient.post('/auth/refresh', body)
+      setAuthData({ ...response.data, user: user.value || response.data.user })
+      return true
+    } catch (error) {
+      return false
+    }
+  }
+
+  // signIn stores the tokens of a completed login, or keeps the MFA token
+  // when a two-factor code is still needed
+  function signIn(data) {
+    if (data.mfa_required) {
+      mfaToken.value = data.mfa_token
+      return { success: false, mfaRequired: true }
+    }
+    setAuthData(data)
+    return { success: true }
+  }
+
+  async function verifyTwoFactor(code) {
+    try {
+      const response = await apiClient.post('/auth/2fa/verify', { code }, {
+        headers: { Authorization: `Bearer ${mfaToken.value}` },
+      })
+      mfaToken.value = ''
+      setAuthData(response.data)
+      return { success: true }
+    } catch (error) {
+      return { success: false, error: error.response?.data?.error || 'Verification failed' }
+    }
+  }
+
+  // ensureCsrfToken fetches the CSRF token after a page load in cookie mode
+  async function ensureCsrfToken() {
+    if (!csrfToken.value) {
+      try {
+        const response = await apiClient.get('/auth/csrf')
+        csrfToken.value = response.data.csrf_token
+      } catch (error) {
+        return ''
+      }
+    }
+    return csrfToken.value
+  }
+
   function setAuthData(data) {
     user.value = data.user
+    if (cookieMode) {
+      signedIn.value = true
+      csrfToken.value = data.csrf_token
+      localStorage.setItem('signedIn', 'true')
+      return
+    }
     token.value = data.token
     refreshToken.value = data.refresh_token
     localStorage.setItem('token', data.token)
     localStorage.setItem('refreshToken', data.refresh_token)
   }
 
+  // signOut ends the session on the server before clearing local state
+  async function signOut() {
+    try {
+      await apiClient.post('/auth/logout')
+    } catch (error) {
+      // The session may already be gone; log out locally either way
+    }
+    logout()
+  }
+
   function logout() {
     user.value = null
     token.value = ''
     refreshToken.value = ''
+    signedIn.value = false
+    csrfToken.value = ''
+    localStorage.removeItem('signedIn')
     localStorage.removeItem('token')
     localStorage.removeItem('refreshToken')
   }
 
-  async function googleLogin() {
+  // oauthLogin sends the browser to the API, which sets the OAuth state
+  // cookie and redirects to the provider
+  function oauthLogin(provider) {
+    window.location.href = `${apiClient.defaults.baseURL}/auth/oauth/${provider}`
+  }
+
+  function googleLogin() {
+    oauthLogin('google')
+  }
+
+  async function fetchProviders() {
+    try {
+      const response = await apiClient.get('/auth/providers')
+      return response.data.providers
+    } catch (error) {
+      return []
+    }
+  }
+
+  // exchangeCode trades the one-time code from the OAuth callback for tokens
+  async function exchangeCode(code) {
+    try {
+      const response = await apiClient.post('/auth/exchange', { code })
+      return signIn(response.data)
+    } catch (error) {
+      return { success: false, error: error.response?.data?.error || 'Sign in failed' }
+    }
+  }
+
+  async function forgotPassword(email) {
+    try {
+      const response = await apiClient.post('/auth/password/forgot', { email })
+      return { success: true, message: response.data.message }
+    } catch (error) {
+      return { success: false, error: error.response?.data?.error || 'Request failed' }
+    }
+  }
+
+  async function resetPassword(token, password) {
     try {
-      const response = await apiClient.get('/auth/google')
-      window.location.href = response.data.url
+      await apiClient.post('/auth/password/reset', { token, password })
+      return { success: true }
     } catch (error) {
-      console.error('Google login failed:', error)
+      return { success: false, error: error.response?.data?.error || 'Password reset failed' }
     }
   }
 
-  function handleGoogleCallback(urlToken, urlRefreshToken) {
-    const authData = {
-      token: urlToken,
-      refresh_token: urlRefreshToken,
-      user: {} // Will be fetched separately
+  async function verifyEmail(token) {
+    try {
+      const response = await apiClient.post('/auth/email/verify', { token })
+      if (user.value?.id === response.data.id) {
+        user.value = response.data
+      }
+      return { success: true }
+    } catch (error) {
+      return { success: false, error: error.response?.data?.error || 'Verification failed' }
     }
-    setAuthData(authData)
-    fetchUser()
   }
 
   return {
     user,
     token,
     refreshToken,
+    mfaToken,
+    csrfToken,
     isAuthenticated,
+    ensureCsrfToken,
     login,
     register,
     fetchUser,
+    refresh,
+    signOut,
     logout,
+    oauthLogin,
     googleLogin,
-    handleGoogleCallback,
+    fetchProviders,
+    exchangeCode,
+    forgotPassword,
+    resetPassword,
+    verifyEmail,
+    verifyTwoFactor,
   }
 })
 